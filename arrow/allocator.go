@@ -0,0 +1,88 @@
+package arrow
+
+import (
+	"sync/atomic"
+
+	"github.com/apache/arrow/go/v14/arrow/memory"
+)
+
+// Allocator is a memory.Allocator that tracks the bytes allocated through it, and their peak.
+// Share one between ArrowRowBuilders, with WithAllocator, to bound their combined memory: each builder writes its
+// chunk early, before it reaches chunkSize rows, once it holds its share of the limit.
+// The limit is a target rather than a hard cap, as allocations are never refused, and the builders' sizes are estimates.
+// Allocator is threadsafe.
+type Allocator struct {
+	mem       memory.Allocator
+	limit     int64
+	allocated atomic.Int64
+	peak      atomic.Int64
+	// The number of ArrowRowBuilders sharing the limit
+	numBuilders atomic.Int64
+}
+
+// NewAllocator creates an Allocator that allocates from mem, e.g. a memory.CheckedAllocator in tests, or a
+// memory.GoAllocator if mem is nil. A limit of 0 tracks allocations without limiting them
+func NewAllocator(mem memory.Allocator, limit int64) *Allocator {
+	if mem == nil {
+		mem = memory.NewGoAllocator()
+	}
+
+	return &Allocator{mem: mem, limit: limit}
+}
+
+func (a *Allocator) Allocate(size int) []byte {
+	a.add(int64(size))
+	return a.mem.Allocate(size)
+}
+
+func (a *Allocator) Reallocate(size int, b []byte) []byte {
+	a.add(int64(size - len(b)))
+	return a.mem.Reallocate(size, b)
+}
+
+func (a *Allocator) Free(b []byte) {
+	a.add(-int64(len(b)))
+	a.mem.Free(b)
+}
+
+func (a *Allocator) add(size int64) {
+	allocated := a.allocated.Add(size)
+
+	for {
+		peak := a.peak.Load()
+		if allocated <= peak || a.peak.CompareAndSwap(peak, allocated) {
+			return
+		}
+	}
+}
+
+// Allocated returns the bytes currently allocated
+func (a *Allocator) Allocated() int64 {
+	return a.allocated.Load()
+}
+
+// Peak returns the most bytes allocated at once
+func (a *Allocator) Peak() int64 {
+	return a.peak.Load()
+}
+
+// Limit returns the limit, or 0 if there is none
+func (a *Allocator) Limit() int64 {
+	return a.limit
+}
+
+// shouldFlush returns true if a builder holding chunkBytes has reached its share of the limit, and should write its
+// chunk. Builders grow their buffers by doubling them, and copy them once more to trim them when writing a chunk,
+// so a chunk may briefly take up to 3 times its size
+func (a *Allocator) shouldFlush(chunkBytes int) bool {
+	if a.limit <= 0 {
+		return false
+	}
+
+	numBuilders := a.numBuilders.Load()
+	if numBuilders < 1 {
+		numBuilders = 1
+	}
+
+	return int64(chunkBytes) >= a.limit/(3*numBuilders)
+}
@@ -0,0 +1,123 @@
+package arrow
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+)
+
+func TestAllocatorTracksAndFrees(t *testing.T) {
+	checked := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer checked.AssertSize(t, 0)
+
+	allocator := NewAllocator(checked, 0)
+
+	var buf bytes.Buffer
+
+	writer, err := NewArrowIPCStreamWriter(&buf, []string{"locus", "dosage"},
+		[]arrow.DataType{arrow.BinaryTypes.String, arrow.PrimitiveTypes.Int8}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewArrowRowBuilder(writer, 10, WithAllocator(allocator))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 25; i++ {
+		if err := builder.WriteRow([]any{fmt.Sprintf("chr1:%d:A:T", i), int8(i % 3)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if allocator.Allocated() == 0 {
+		t.Error("NOT OK: Expected the buffered rows to be allocated from the allocator")
+	}
+
+	if err := builder.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if allocator.Allocated() != 0 {
+		t.Errorf("NOT OK: Expected every allocation to be freed, %d bytes are still allocated", allocator.Allocated())
+	}
+
+	if allocator.Peak() == 0 {
+		t.Error("NOT OK: Expected a peak allocation")
+	}
+}
+
+func TestAllocatorLimitShrinksChunks(t *testing.T) {
+	fieldNames := []string{"locus"}
+	fieldTypes := []arrow.DataType{arrow.BinaryTypes.String}
+	for i := 0; i < 1000; i++ {
+		fieldNames = append(fieldNames, fmt.Sprintf("S%d", i))
+		fieldTypes = append(fieldTypes, arrow.PrimitiveTypes.Int8)
+	}
+
+	writeRows := func(allocator *Allocator) (int, int64) {
+		var buf bytes.Buffer
+
+		writer, err := NewArrowIPCStreamWriter(&buf, fieldNames, fieldTypes, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Two builders share the limit
+		builders := make([]*ArrowRowBuilder, 2)
+		for i := range builders {
+			builders[i], err = NewArrowRowBuilder(writer, 2000, WithAllocator(allocator))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		row := make([]any, len(fieldNames))
+		for i := 0; i < 2000; i++ {
+			row[0] = fmt.Sprintf("chr1:%d:A:T", i)
+			for j := 1; j < len(row); j++ {
+				row[j] = int8(j % 3)
+			}
+
+			if err := builders[i%2].WriteRow(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, builder := range builders {
+			if err := builder.Release(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		return writer.NumRecordBatches(), allocator.Peak()
+	}
+
+	unlimitedBatches, unlimitedPeak := writeRows(NewAllocator(nil, 0))
+	limitedBatches, limitedPeak := writeRows(NewAllocator(nil, 1<<20))
+
+	if unlimitedBatches != 2 {
+		t.Errorf("NOT OK: Expected 2 record batches without a limit, got %d", unlimitedBatches)
+	}
+
+	if limitedBatches <= unlimitedBatches {
+		t.Errorf("NOT OK: Expected the limit to write more, smaller, record batches, got %d", limitedBatches)
+	}
+
+	if limitedPeak > 1<<20 || limitedPeak >= unlimitedPeak {
+		t.Errorf("NOT OK: Expected the limit to bound the peak allocation, got %d bytes, %d without a limit",
+			limitedPeak, unlimitedPeak)
+	}
+}
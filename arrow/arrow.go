@@ -1,8 +1,10 @@
 package arrow
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"reflect"
 	"sync"
 
 	"github.com/apache/arrow/go/v14/arrow"
@@ -11,33 +13,87 @@ import (
 	"github.com/apache/arrow/go/v14/arrow/memory"
 )
 
+// recordWriter is implemented by both the IPC file format and stream format writers
+type recordWriter interface {
+	Write(rec arrow.Record) error
+	Close() error
+}
+
 type ArrowWriter struct {
-	Schema *arrow.Schema
-	writer *ipc.FileWriter
-	mu     sync.Mutex
+	Schema     *arrow.Schema
+	writer     recordWriter
+	mu         sync.Mutex
+	numBatches int
+	// The IPC file format writes the schema again in its footer, on Close
+	hasFooter bool
+	// The values that the dictionaries of dictionary-encoded columns start with, by column
+	dictionaries map[string][]string
 }
 
+// ErrMetadataWritten is returned by SetMetadata once the schema metadata can no longer be changed
+var ErrMetadataWritten = errors.New("the schema metadata has already been written")
+
 // Create a new ArrowWriter. The number of fields in fieldNames and fieldTypes
 // must match. The number of rows in each chunk is determined by chunkSize.
-// The ArrowWriter will write to filePath.
+// The ArrowWriter will write to f, usually an *os.File.
 // This writing operation is threadsafe.
-func NewArrowIPCFileWriter(f *os.File, fieldNames []string, fieldTypes []arrow.DataType, nullable bool, options ...ipc.Option) (*ArrowWriter, error) {
-	return NewArrowIPCFileWriterWithSchema(f, makeSchema(fieldNames, fieldTypes, nullable), options...)
+func NewArrowIPCFileWriter(f io.WriteSeeker, fieldNames []string, fieldTypes []arrow.DataType, nullable bool, options ...ipc.Option) (*ArrowWriter, error) {
+	return NewArrowIPCFileWriterWithSchema(f, NewSchema(fieldNames, fieldTypes, nullable), options...)
 }
 
-func NewArrowIPCFileWriterWithSchema(f *os.File, schema *arrow.Schema, options ...ipc.Option) (*ArrowWriter, error) {
+// Use WithSchemaMetadata to write schema metadata
+func NewArrowIPCFileWriterWithSchema(f io.WriteSeeker, schema *arrow.Schema, options ...ipc.Option) (*ArrowWriter, error) {
 	schemaOption := ipc.WithSchema(schema)
 	writer, err := ipc.NewFileWriter(f, append([]ipc.Option{schemaOption}, options...)...)
 	if err != nil {
 		return nil, err
 	}
 
+	return &ArrowWriter{
+		Schema:    schema,
+		writer:    writer,
+		hasFooter: true,
+	}, nil
+}
+
+// Create a new ArrowWriter that writes the Arrow IPC stream format, rather than the file format.
+// The stream format has no footer, so unlike NewArrowIPCFileWriter, w needn't be seekable: it can be
+// stdout or a pipe, read with e.g. pyarrow.ipc.open_stream.
+// Close writes the end-of-stream marker, but doesn't close w.
+func NewArrowIPCStreamWriter(w io.Writer, fieldNames []string, fieldTypes []arrow.DataType, nullable bool, options ...ipc.Option) (*ArrowWriter, error) {
+	return NewArrowIPCStreamWriterWithSchema(w, NewSchema(fieldNames, fieldTypes, nullable), options...)
+}
+
+// Use WithSchemaMetadata to write schema metadata
+func NewArrowIPCStreamWriterWithSchema(w io.Writer, schema *arrow.Schema, options ...ipc.Option) (*ArrowWriter, error) {
+	schemaOption := ipc.WithSchema(schema)
+	writer := ipc.NewWriter(w, append([]ipc.Option{schemaOption}, options...)...)
+
 	return &ArrowWriter{
 		Schema: schema,
 		writer: writer,
 	}, nil
 }
 
+// SetMetadata adds metadata to the schema, as WithSchemaMetadata does, once writing has begun, e.g. for values only known
+// at the end of a run. The schema is written before the first chunk, and the file format writes it again in its
+// footer, which is where file readers read it from, so SetMetadata can be called until Close. The stream format
+// has no footer, so ErrMetadataWritten is returned once a chunk has been written.
+// It mustn't be called while ArrowRowBuilders of aw are building chunks, since they share the schema
+func (aw *ArrowWriter) SetMetadata(metadata map[string]string) error {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+
+	if !aw.hasFooter && aw.numBatches > 0 {
+		return ErrMetadataWritten
+	}
+
+	// The IPC writer keeps the schema it was given, to write it later, so it is updated in place
+	*aw.Schema = *WithSchemaMetadata(aw.Schema, metadata)
+
+	return nil
+}
+
 func (aw *ArrowWriter) WriteChunk(record arrow.Record) error {
 	aw.mu.Lock()
 	defer aw.mu.Unlock()
@@ -46,6 +102,43 @@ func (aw *ArrowWriter) WriteChunk(record arrow.Record) error {
 		return err
 	}
 
+	aw.numBatches++
+
+	return nil
+}
+
+// NumRecordBatches returns the number of record batches written so far
+func (aw *ArrowWriter) NumRecordBatches() int {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+
+	return aw.numBatches
+}
+
+// SetDictionary sets the values that the dictionary of the dictionary-encoded column starts with, in every
+// ArrowRowBuilder created afterwards.
+// The IPC file format allows only one dictionary per column, so when writing it, every value of a dictionary-encoded
+// column must be set here, e.g. the chromosomes or site types. Otherwise WriteChunk will fail once the chunks of
+// different ArrowRowBuilders, or consecutive chunks of one, have different dictionaries.
+// The IPC stream format has no such restriction, though setting the dictionary avoids replacing it with each chunk.
+func (aw *ArrowWriter) SetDictionary(column string, values []string) error {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+
+	indices := aw.Schema.FieldIndices(column)
+	if len(indices) == 0 {
+		return fmt.Errorf("no such column: %s", column)
+	}
+
+	if aw.Schema.Field(indices[0]).Type.ID() != arrow.DICTIONARY {
+		return fmt.Errorf("column %s isn't dictionary-encoded", column)
+	}
+
+	if aw.dictionaries == nil {
+		aw.dictionaries = make(map[string][]string)
+	}
+	aw.dictionaries[column] = values
+
 	return nil
 }
 
@@ -59,65 +152,152 @@ func (aw *ArrowWriter) Close() error {
 }
 
 type ArrowRowBuilder struct {
-	builders       []array.Builder
-	appendFuncs    []func(array.Builder, any) error
-	pool           *memory.GoAllocator
+	builders    []array.Builder
+	appendFuncs []func(array.Builder, any) error
+	pool        memory.Allocator
+	// The shared Allocator, if the builder was given one
+	allocator      *Allocator
+	released       bool
 	arrowWriter    *ArrowWriter
 	numRowsInChunk int
 	chunkSize      int
+	// The approximate size of the rows in the chunk, and the size at which it is written, if not 0
+	chunkBytes    int
+	maxChunkBytes int
+	// The bytes taken by the fixed-width columns of each row, and the indices of the other columns
+	fixedRowBytes   int
+	variableColumns []int
+	// Set once an append fails, after which the builder's columns may have different lengths
+	err error
+}
+
+// RowBuilderOption configures an ArrowRowBuilder
+type RowBuilderOption func(*ArrowRowBuilder)
+
+// WithMaxChunkBytes writes a chunk once its rows take approximately maxChunkBytes, even if it has fewer than
+// chunkSize rows, so that rows with many columns, e.g. one per sample, don't make chunks too large to hold in memory.
+// Sizes are those of the uncompressed values, not counting validity bitmaps.
+func WithMaxChunkBytes(maxChunkBytes int) RowBuilderOption {
+	return func(arb *ArrowRowBuilder) {
+		arb.maxChunkBytes = maxChunkBytes
+	}
+}
+
+// WithAllocator allocates the builder's memory from mem, rather than a memory.GoAllocator of its own.
+// If mem is an *Allocator with a limit, the builder writes its chunk early once the limit is exceeded.
+func WithAllocator(mem memory.Allocator) RowBuilderOption {
+	return func(arb *ArrowRowBuilder) {
+		arb.pool = mem
+		arb.allocator, _ = mem.(*Allocator)
+	}
 }
 
 // NewArrowRowBuilder creates a new ArrowRowBuilder. The ArrowRowBuilder will
-// write to the underlying ArrowWriter.
+// write to the underlying ArrowWriter, a chunk (record batch) at a time, once it has chunkSize rows.
 // ArrowRowBuilder is not threadsafe: it should only be used by one thread at a
 // time, though multiple ArrowRowBuilders writing to a single ArrowWriter concurrently is possible
 // This is done to enable fast, parallel accumulation of rows, delaying synchronization until enough rows are accumulated
 // to write a chunk.
-func NewArrowRowBuilder(aw *ArrowWriter, chunkSize int) (*ArrowRowBuilder, error) {
-	pool := memory.NewGoAllocator()
-	builders, appendFuncs, err := makeBuilders(aw.Schema, pool)
+func NewArrowRowBuilder(aw *ArrowWriter, chunkSize int, options ...RowBuilderOption) (*ArrowRowBuilder, error) {
+	arb := &ArrowRowBuilder{
+		arrowWriter:    aw,
+		numRowsInChunk: 0,
+		chunkSize:      chunkSize,
+	}
+
+	for _, option := range options {
+		option(arb)
+	}
+
+	if arb.pool == nil {
+		arb.pool = memory.NewGoAllocator()
+	}
+
+	builders, appendFuncs, err := makeBuilders(aw.Schema, arb.pool)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &ArrowRowBuilder{
-		builders:       builders,
-		appendFuncs:    appendFuncs,
-		pool:           pool,
-		arrowWriter:    aw,
-		numRowsInChunk: 0,
-		chunkSize:      chunkSize,
-	}, nil
+	arb.builders = builders
+	arb.appendFuncs = appendFuncs
+
+	if arb.allocator != nil {
+		arb.allocator.numBuilders.Add(1)
+	}
+
+	if err := aw.seedDictionaries(builders, arb.pool); err != nil {
+		arb.Release()
+		return nil, err
+	}
+
+	for i, field := range aw.Schema.Fields() {
+		if fixedWidth, ok := field.Type.(arrow.FixedWidthDataType); ok {
+			arb.fixedRowBytes += (fixedWidth.BitWidth() + 7) / 8
+		} else {
+			arb.variableColumns = append(arb.variableColumns, i)
+		}
+	}
+
+	return arb, nil
 }
 
 // WriteRow writes a row to the ArrowRowBuilder. The number of fields in the row
 // must match the number of fields in the schema.
+// The row is written to the ArrowWriter once its chunk is full, and any error writing it is returned.
+// If a value can't be appended, the error is returned, and the ArrowRowBuilder can't be used any further.
 func (arb *ArrowRowBuilder) WriteRow(row []any) error {
+	if arb.err != nil {
+		return arb.err
+	}
+
 	if len(row) != len(arb.builders) {
 		return fmt.Errorf("mismatch in number of fields: expected %d, got %d", len(arb.builders), len(row))
 	}
 
 	for i, val := range row {
 		if err := arb.appendFuncs[i](arb.builders[i], val); err != nil {
-			return fmt.Errorf("error appending to column %d: %v", i, err)
+			arb.err = fmt.Errorf("error appending to column %s: %w", arb.arrowWriter.Schema.Field(i).Name, err)
+			return arb.err
 		}
 	}
 
 	arb.numRowsInChunk++
 
-	if arb.numRowsInChunk == arb.chunkSize {
-		err := arb.writeChunk()
-		if err != nil {
-			return err
+	if arb.maxChunkBytes > 0 || arb.allocator != nil {
+		arb.chunkBytes += arb.fixedRowBytes
+		for _, i := range arb.variableColumns {
+			arb.chunkBytes += valueSize(row[i])
 		}
+	}
 
-		arb.numRowsInChunk = 0
+	if arb.numRowsInChunk == arb.chunkSize || (arb.maxChunkBytes > 0 && arb.chunkBytes >= arb.maxChunkBytes) ||
+		(arb.allocator != nil && arb.allocator.shouldFlush(arb.chunkBytes)) {
+		return arb.Flush()
 	}
 
 	return nil
 }
 
+// Flush writes the rows written since the last chunk to the ArrowWriter, as a chunk of their own.
+// The ArrowRowBuilder can still be used afterwards. Chunks are written automatically as they fill,
+// so Flush is only needed to make every row written so far visible in the output, e.g. before checkpointing it.
+func (arb *ArrowRowBuilder) Flush() error {
+	if arb.err != nil {
+		return arb.err
+	}
+
+	if arb.numRowsInChunk == 0 {
+		return nil
+	}
+
+	err := arb.writeChunk()
+	arb.numRowsInChunk = 0
+	arb.chunkBytes = 0
+
+	return err
+}
+
 func (arb *ArrowRowBuilder) writeChunk() error {
 	var cols []arrow.Array
 	for _, b := range arb.builders {
@@ -129,6 +309,11 @@ func (arb *ArrowRowBuilder) writeChunk() error {
 	record := array.NewRecord(arb.arrowWriter.Schema, cols, int64(arb.numRowsInChunk))
 	defer record.Release()
 
+	// The record holds its own references to the columns, which are freed once it is released
+	for _, col := range cols {
+		col.Release()
+	}
+
 	if err := arb.arrowWriter.WriteChunk(record); err != nil {
 		return err
 	}
@@ -136,25 +321,64 @@ func (arb *ArrowRowBuilder) writeChunk() error {
 	return nil
 }
 
+// valueSize returns the approximate size in bytes of a value of a variable width column
+func valueSize(val any) int {
+	switch v := val.(type) {
+	case nil:
+		return 0
+	case string:
+		// The value, and its offset
+		return len(v) + 4
+	case uint8, int8, bool:
+		return 1
+	case uint16, int16:
+		return 2
+	case uint32, int32, float32:
+		return 4
+	case uint64, int64, float64:
+		return 8
+	case map[string]any:
+		size := 0
+		for _, fieldVal := range v {
+			size += valueSize(fieldVal)
+		}
+		return size
+	}
+
+	values, err := listValues(val)
+	if err != nil {
+		return 0
+	}
+
+	size := 4
+	for _, elem := range values {
+		size += valueSize(elem)
+	}
+
+	return size
+}
+
 // Release releases the ArrowRowBuilder. This must be called to ensure that all
 // data is successfully written to the file.
 // Release will write any remaining rows to the file, and so must be called before
 // Close() on the underlying ArrowWriter.
 func (arb *ArrowRowBuilder) Release() error {
-	if arb.numRowsInChunk > 0 {
-		err := arb.writeChunk()
-		arb.numRowsInChunk = 0
-
-		if err != nil {
-			return err
-		}
+	if arb.released {
+		return nil
 	}
+	arb.released = true
+
+	err := arb.Flush()
 
 	for _, builder := range arb.builders {
 		builder.Release()
 	}
 
-	return nil
+	if arb.allocator != nil {
+		arb.allocator.numBuilders.Add(-1)
+	}
+
+	return err
 }
 
 func appendUint8(builder array.Builder, val any) error {
@@ -307,6 +531,152 @@ func appendString(builder array.Builder, val any) error {
 	return fmt.Errorf("type mismatch, expected string")
 }
 
+func appendLargeString(builder array.Builder, val any) error {
+	if val == nil {
+		builder.AppendNull()
+		return nil
+	}
+
+	if v, ok := val.(string); ok {
+		builder.(*array.LargeStringBuilder).Append(v)
+		return nil
+	}
+
+	return fmt.Errorf("type mismatch, expected string")
+}
+
+func appendDictionaryString(builder array.Builder, val any) error {
+	if val == nil {
+		builder.AppendNull()
+		return nil
+	}
+
+	if v, ok := val.(string); ok {
+		return builder.(*array.BinaryDictionaryBuilder).AppendString(v)
+	}
+
+	return fmt.Errorf("type mismatch, expected string")
+}
+
+// listValues returns the elements of val, which may be a slice or array of any type, e.g. []any or []string
+func listValues(val any) ([]any, error) {
+	if v, ok := val.([]any); ok {
+		return v, nil
+	}
+
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("type mismatch, expected a slice")
+	}
+
+	values := make([]any, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+
+	return values, nil
+}
+
+// makeAppendList returns the append func of a list, whose elements are appended by appendElem
+// Lists are written from slices, e.g. []any or []string
+func makeAppendList(appendElem func(array.Builder, any) error) func(array.Builder, any) error {
+	return func(builder array.Builder, val any) error {
+		if val == nil {
+			builder.AppendNull()
+			return nil
+		}
+
+		values, err := listValues(val)
+		if err != nil {
+			return err
+		}
+
+		listBuilder := builder.(*array.ListBuilder)
+		listBuilder.Append(true)
+
+		for _, elem := range values {
+			if err := appendElem(listBuilder.ValueBuilder(), elem); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// makeAppendFixedSizeList returns the append func of a list of size elements, appended by appendElem
+func makeAppendFixedSizeList(size int, appendElem func(array.Builder, any) error) func(array.Builder, any) error {
+	return func(builder array.Builder, val any) error {
+		if val == nil {
+			// Appends size null elements too
+			builder.AppendNull()
+			return nil
+		}
+
+		values, err := listValues(val)
+		if err != nil {
+			return err
+		}
+
+		if len(values) != size {
+			return fmt.Errorf("expected a list of %d values, got %d", size, len(values))
+		}
+
+		listBuilder := builder.(*array.FixedSizeListBuilder)
+		listBuilder.Append(true)
+
+		for _, elem := range values {
+			if err := appendElem(listBuilder.ValueBuilder(), elem); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// makeAppendStruct returns the append func of a struct, whose fields are appended by appendFields
+// Structs are written from a []any of field values, in schema order, or a map[string]any of field values by name,
+// in which missing fields are null
+func makeAppendStruct(structType *arrow.StructType, appendFields []func(array.Builder, any) error) func(array.Builder, any) error {
+	return func(builder array.Builder, val any) error {
+		structBuilder := builder.(*array.StructBuilder)
+
+		var values []any
+		switch v := val.(type) {
+		case nil:
+			values = make([]any, len(appendFields))
+		case []any:
+			if len(v) != len(appendFields) {
+				return fmt.Errorf("expected a struct of %d fields, got %d", len(appendFields), len(v))
+			}
+			values = v
+		case map[string]any:
+			values = make([]any, len(appendFields))
+			for name, fieldVal := range v {
+				idx, ok := structType.FieldIdx(name)
+				if !ok {
+					return fmt.Errorf("no such struct field: %s", name)
+				}
+				values[idx] = fieldVal
+			}
+		default:
+			return fmt.Errorf("type mismatch, expected []any or map[string]any")
+		}
+
+		// The fields of a null struct must still be appended to, to keep them aligned
+		structBuilder.Append(val != nil)
+
+		for i, fieldVal := range values {
+			if err := appendFields[i](structBuilder.FieldBuilder(i), fieldVal); err != nil {
+				return fmt.Errorf("field %s: %w", structType.Field(i).Name, err)
+			}
+		}
+
+		return nil
+	}
+}
+
 func appendBool(builder array.Builder, val any) error {
 	if val == nil {
 		builder.AppendNull()
@@ -321,7 +691,8 @@ func appendBool(builder array.Builder, val any) error {
 	return fmt.Errorf("type mismatch, expected bool")
 }
 
-func makeSchema(fieldNames []string, fieldTypes []arrow.DataType, nullable bool) *arrow.Schema {
+// NewSchema creates the schema that NewArrowIPCFileWriter uses, for use with NewArrowIPCFileWriterWithSchema
+func NewSchema(fieldNames []string, fieldTypes []arrow.DataType, nullable bool) *arrow.Schema {
 	fields := make([]arrow.Field, len(fieldTypes))
 	for i, dataType := range fieldTypes {
 		fields[i] = arrow.Field{Name: fieldNames[i], Type: dataType, Nullable: nullable}
@@ -332,51 +703,119 @@ func makeSchema(fieldNames []string, fieldTypes []arrow.DataType, nullable bool)
 	return schema
 }
 
-func makeBuilders(schema *arrow.Schema, pool *memory.GoAllocator) ([]array.Builder, []func(array.Builder, any) error, error) {
+// WithSchemaMetadata returns a copy of schema with metadata added, replacing the values of keys it already has, e.g.
+// to describe how the output was produced, for the NewArrowIPC*WriterWithSchema constructors
+// It is read back by ArrowRowReader.Metadata, or e.g. pyarrow's schema.metadata
+func WithSchemaMetadata(schema *arrow.Schema, metadata map[string]string) *arrow.Schema {
+	merged := schema.Metadata().ToMap()
+	for key, value := range metadata {
+		merged[key] = value
+	}
+
+	md := arrow.MetadataFrom(merged)
+
+	return arrow.NewSchemaWithEndian(schema.Fields(), &md, schema.Endianness())
+}
+
+func makeBuilders(schema *arrow.Schema, pool memory.Allocator) ([]array.Builder, []func(array.Builder, any) error, error) {
 	builders := make([]array.Builder, schema.NumFields())
 	appendFuncs := make([]func(array.Builder, any) error, schema.NumFields())
 
 	for i, field := range schema.Fields() {
-		switch field.Type {
-		case arrow.PrimitiveTypes.Uint8:
-			builders[i] = array.NewUint8Builder(pool)
-			appendFuncs[i] = appendUint8
-		case arrow.PrimitiveTypes.Uint16:
-			builders[i] = array.NewUint16Builder(pool)
-			appendFuncs[i] = appendUint16
-		case arrow.PrimitiveTypes.Uint32:
-			builders[i] = array.NewUint32Builder(pool)
-			appendFuncs[i] = appendUint32
-		case arrow.PrimitiveTypes.Uint64:
-			builders[i] = array.NewUint64Builder(pool)
-			appendFuncs[i] = appendUint64
-		case arrow.PrimitiveTypes.Int8:
-			builders[i] = array.NewInt8Builder(pool)
-			appendFuncs[i] = appendInt8
-		case arrow.PrimitiveTypes.Int16:
-			builders[i] = array.NewInt16Builder(pool)
-			appendFuncs[i] = appendInt16
-		case arrow.PrimitiveTypes.Int32:
-			builders[i] = array.NewInt32Builder(pool)
-			appendFuncs[i] = appendInt32
-		case arrow.PrimitiveTypes.Int64:
-			builders[i] = array.NewInt64Builder(pool)
-			appendFuncs[i] = appendInt64
-		case arrow.PrimitiveTypes.Float32:
-			builders[i] = array.NewFloat32Builder(pool)
-			appendFuncs[i] = appendFloat32
-		case arrow.PrimitiveTypes.Float64:
-			builders[i] = array.NewFloat64Builder(pool)
-			appendFuncs[i] = appendFloat64
-		case arrow.BinaryTypes.String:
-			builders[i] = array.NewStringBuilder(pool)
-			appendFuncs[i] = appendString
-		case arrow.FixedWidthTypes.Boolean:
-			builders[i] = array.NewBooleanBuilder(pool)
-			appendFuncs[i] = appendBool
-		default:
-			return nil, nil, fmt.Errorf("unsupported data type: %s", field.Type)
+		appendFunc, err := makeAppendFunc(field.Type)
+		if err != nil {
+			return nil, nil, err
 		}
+
+		builders[i] = array.NewBuilder(pool, field.Type)
+		appendFuncs[i] = appendFunc
 	}
 	return builders, appendFuncs, nil
 }
+
+// makeAppendFunc returns the func that appends values of dataType to its builder
+func makeAppendFunc(dataType arrow.DataType) (func(array.Builder, any) error, error) {
+	switch dataType.ID() {
+	case arrow.UINT8:
+		return appendUint8, nil
+	case arrow.UINT16:
+		return appendUint16, nil
+	case arrow.UINT32:
+		return appendUint32, nil
+	case arrow.UINT64:
+		return appendUint64, nil
+	case arrow.INT8:
+		return appendInt8, nil
+	case arrow.INT16:
+		return appendInt16, nil
+	case arrow.INT32:
+		return appendInt32, nil
+	case arrow.INT64:
+		return appendInt64, nil
+	case arrow.FLOAT32:
+		return appendFloat32, nil
+	case arrow.FLOAT64:
+		return appendFloat64, nil
+	case arrow.STRING:
+		return appendString, nil
+	case arrow.LARGE_STRING:
+		return appendLargeString, nil
+	case arrow.BOOL:
+		return appendBool, nil
+	case arrow.DICTIONARY:
+		valueType := dataType.(*arrow.DictionaryType).ValueType
+		if valueType.ID() != arrow.STRING {
+			return nil, fmt.Errorf("unsupported data type: %s, only dictionary-encoded strings are supported", dataType)
+		}
+		return appendDictionaryString, nil
+	case arrow.LIST:
+		appendElem, err := makeAppendFunc(dataType.(*arrow.ListType).Elem())
+		if err != nil {
+			return nil, err
+		}
+		return makeAppendList(appendElem), nil
+	case arrow.FIXED_SIZE_LIST:
+		listType := dataType.(*arrow.FixedSizeListType)
+		appendElem, err := makeAppendFunc(listType.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return makeAppendFixedSizeList(int(listType.Len()), appendElem), nil
+	case arrow.STRUCT:
+		structType := dataType.(*arrow.StructType)
+		appendFields := make([]func(array.Builder, any) error, len(structType.Fields()))
+		for i, field := range structType.Fields() {
+			appendField, err := makeAppendFunc(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			appendFields[i] = appendField
+		}
+		return makeAppendStruct(structType, appendFields), nil
+	default:
+		return nil, fmt.Errorf("unsupported data type: %s", dataType)
+	}
+}
+
+// seedDictionaries inserts the values set by SetDictionary into the dictionary builders of their columns
+func (aw *ArrowWriter) seedDictionaries(builders []array.Builder, pool memory.Allocator) error {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+
+	for column, values := range aw.dictionaries {
+		valuesBuilder := array.NewStringBuilder(pool)
+		valuesBuilder.AppendValues(values, nil)
+		dictionary := valuesBuilder.NewStringArray()
+		valuesBuilder.Release()
+
+		idx := aw.Schema.FieldIndices(column)[0]
+		err := builders[idx].(*array.BinaryDictionaryBuilder).InsertStringDictValues(dictionary)
+		dictionary.Release()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,7 +1,9 @@
 package arrow
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -172,7 +174,7 @@ func TestArrowWriteRead(t *testing.T) {
 		rows[i] = []any{uint16(i), uint16(i + 1), uint16(i + 2)}
 	}
 
-	writer, err := NewArrowIPCFileWriter(file, fieldNames, fieldTypes)
+	writer, err := NewArrowIPCFileWriter(file, fieldNames, fieldTypes, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -244,7 +246,7 @@ func TestArrowWriterHandlesNullValues(t *testing.T) {
 		fieldNames[i] = fmt.Sprintf("Field %d", i)
 	}
 
-	writer, err := NewArrowIPCFileWriter(file, fieldNames, fieldTypes)
+	writer, err := NewArrowIPCFileWriter(file, fieldNames, fieldTypes, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -284,9 +286,9 @@ func conncurentTestMaybeCompress(t *testing.T, compress bool) {
 
 	var writer *ArrowWriter
 	if compress {
-		writer, err = NewArrowIPCFileWriter(file, fieldNames, fieldTypes, ipc.WithZstd())
+		writer, err = NewArrowIPCFileWriter(file, fieldNames, fieldTypes, false, ipc.WithZstd())
 	} else {
-		writer, err = NewArrowIPCFileWriter(file, fieldNames, fieldTypes)
+		writer, err = NewArrowIPCFileWriter(file, fieldNames, fieldTypes, false)
 	}
 
 	if err != nil {
@@ -308,23 +310,26 @@ func conncurentTestMaybeCompress(t *testing.T, compress bool) {
 	for i := 0; i < numGoroutines; i++ {
 		wg.Add(1)
 		go func(writer *ArrowWriter, routineID int) {
+			defer wg.Done()
+
 			batchSize := 1 + routineID%10
 			builder, err := NewArrowRowBuilder(writer, batchSize)
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 
-			defer wg.Done()
 			for j := 0; j < numWritesPerRoutine; j++ {
 				rowToWrite := rows[routineID*numWritesPerRoutine+j]
 
 				if err := builder.WriteRow(rowToWrite); err != nil {
-					t.Fatal(err)
+					t.Error(err)
+					return
 				}
 			}
 
 			if err := builder.Release(); err != nil {
-				t.Fatal(err)
+				t.Error(err)
 			}
 		}(writer, i)
 	}
@@ -356,8 +361,406 @@ func TestNewArrowIPCFileWriterWithZstdOption(t *testing.T) {
 	fieldNames := []string{"field1", "field2"}
 	fieldTypes := []arrow.DataType{arrow.PrimitiveTypes.Int32, arrow.PrimitiveTypes.Float64}
 
-	_, err = NewArrowIPCFileWriter(file, fieldNames, fieldTypes, ipc.WithZstd())
+	_, err = NewArrowIPCFileWriter(file, fieldNames, fieldTypes, false, ipc.WithZstd())
 	if err != nil {
 		t.Errorf("Unexpected error when passing WithZstd as an option: %v", err)
 	}
 }
+
+func TestArrowStreamWriteRead(t *testing.T) {
+	var buf bytes.Buffer
+
+	fieldTypes := []arrow.DataType{arrow.BinaryTypes.String, arrow.PrimitiveTypes.Int8}
+	fieldNames := []string{"locus", "dosage"}
+	rows := make([][]any, 23)
+	for i := range rows {
+		rows[i] = []any{fmt.Sprintf("chr1:%d:A:T", i), int8(i % 3)}
+	}
+
+	writer, err := NewArrowIPCStreamWriter(&buf, fieldNames, fieldTypes, false, ipc.WithZstd())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewArrowRowBuilder(writer, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range rows {
+		if err := builder.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := builder.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if writer.NumRecordBatches() != 3 {
+		t.Errorf("Expected 3 record batches, got %d", writer.NumRecordBatches())
+	}
+
+	reader, err := ipc.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Release()
+
+	var readRows [][]any
+	for reader.Next() {
+		record := reader.Record()
+		loci := record.Column(0).(*array.String)
+		dosages := record.Column(1).(*array.Int8)
+
+		for i := 0; i < int(record.NumRows()); i++ {
+			readRows = append(readRows, []any{loci.Value(i), dosages.Value(i)})
+		}
+	}
+
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(readRows, rows) {
+		t.Errorf("Expected %v, got %v", rows, readRows)
+	}
+}
+
+func nestedTestSchema() *arrow.Schema {
+	return arrow.NewSchema([]arrow.Field{
+		{Name: "chrom", Type: &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Uint8, ValueType: arrow.BinaryTypes.String}, Nullable: true},
+		{Name: "samples", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: true},
+		{Name: "haplotypes", Type: arrow.FixedSizeListOf(2, arrow.PrimitiveTypes.Int8), Nullable: true},
+		{Name: "population", Type: arrow.StructOf(
+			arrow.Field{Name: "name", Type: arrow.BinaryTypes.LargeString, Nullable: true},
+			arrow.Field{Name: "af", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		), Nullable: true},
+	}, nil)
+}
+
+func TestArrowNestedTypesWriteRead(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "nested.feather")
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer, err := NewArrowIPCFileWriterWithSchema(file, nestedTestSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every chunk must share one dictionary in the file format
+	if err := writer.SetDictionary("chrom", []string{"chr1", "chr2", "chrX"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := [][]any{
+		{"chr1", []string{"S1", "S2"}, []int8{0, 1}, map[string]any{"name": "AFR", "af": 0.25}},
+		{"chrX", []any{}, []any{int8(1), nil}, []any{"EUR", nil}},
+		{nil, nil, nil, nil},
+		{"chr2", []any{"S3", nil}, []int8{1, 1}, map[string]any{"af": 0.5}},
+	}
+
+	// Two builders, as used by concurrent workers, whose chunks are interleaved
+	builders := make([]*ArrowRowBuilder, 2)
+	for i := range builders {
+		builders[i], err = NewArrowRowBuilder(writer, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, row := range rows {
+		if err := builders[i%2].WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, builder := range builders {
+		if err := builder.Release(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	readFile, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readFile.Close()
+
+	reader, err := NewArrowIPCFileReader(readFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var readRows [][]any
+	for reader.Next() {
+		row, err := reader.Row()
+		if err != nil {
+			t.Fatal(err)
+		}
+		readRows = append(readRows, row)
+	}
+
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]any{
+		{"chr1", []any{"S1", "S2"}, []any{int8(0), int8(1)}, map[string]any{"name": "AFR", "af": 0.25}},
+		{"chrX", []any{}, []any{int8(1), nil}, map[string]any{"name": "EUR", "af": nil}},
+		{nil, nil, nil, nil},
+		{"chr2", []any{"S3", nil}, []any{int8(1), int8(1)}, map[string]any{"name": nil, "af": 0.5}},
+	}
+
+	if !reflect.DeepEqual(readRows, expected) {
+		t.Errorf("NOT OK: Expected %v, got %v", expected, readRows)
+	}
+}
+
+func TestArrowDictionaryReplacement(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "type", Type: &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int8, ValueType: arrow.BinaryTypes.String}},
+	}, nil)
+
+	writeRows := func(writer *ArrowWriter) error {
+		builder, err := NewArrowRowBuilder(writer, 1)
+		if err != nil {
+			return err
+		}
+
+		for _, siteType := range []string{"SNP", "DEL", "SNP"} {
+			if err := builder.WriteRow([]any{siteType}); err != nil {
+				return err
+			}
+		}
+
+		return builder.Release()
+	}
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "dictionary.feather"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	fileWriter, err := NewArrowIPCFileWriterWithSchema(file, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeRows(fileWriter); err == nil {
+		t.Error("NOT OK: Expected an error growing the dictionary of an IPC file")
+	}
+
+	// The stream format allows the dictionary to change between chunks
+	var buf bytes.Buffer
+
+	streamWriter, err := NewArrowIPCStreamWriterWithSchema(&buf, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeRows(streamWriter); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := streamWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewArrowIPCStreamReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var siteTypes []any
+	for reader.Next() {
+		row, err := reader.Row()
+		if err != nil {
+			t.Fatal(err)
+		}
+		siteTypes = append(siteTypes, row[0])
+	}
+
+	if fmt.Sprint(siteTypes) != "[SNP DEL SNP]" || reader.Err() != nil {
+		t.Errorf("NOT OK: Expected [SNP DEL SNP], got %v, %v", siteTypes, reader.Err())
+	}
+
+	if err := streamWriter.SetDictionary("missing", nil); err == nil {
+		t.Error("NOT OK: Expected an error setting the dictionary of a missing column")
+	}
+}
+
+func TestArrowUnsupportedDictionary(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "count", Type: &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int8, ValueType: arrow.PrimitiveTypes.Int64}},
+	}, nil)
+
+	writer, err := NewArrowIPCStreamWriterWithSchema(io.Discard, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewArrowRowBuilder(writer, 1); err == nil {
+		t.Error("NOT OK: Expected an error building a dictionary of int64 values")
+	}
+}
+
+func TestArrowRowBuilderFlush(t *testing.T) {
+	var buf bytes.Buffer
+
+	writer, err := NewArrowIPCStreamWriter(&buf, []string{"locus", "dosage"},
+		[]arrow.DataType{arrow.BinaryTypes.String, arrow.PrimitiveTypes.Int8}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewArrowRowBuilder(writer, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := builder.WriteRow([]any{fmt.Sprintf("chr1:%d:A:T", i), int8(1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := builder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flushing nothing writes nothing
+	if err := builder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if writer.NumRecordBatches() != 1 {
+		t.Errorf("NOT OK: Expected Flush to write 1 record batch, got %d", writer.NumRecordBatches())
+	}
+
+	// The builder is still usable after flushing
+	if err := builder.WriteRow([]any{"chr1:3:A:T", int8(2)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := builder.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if writer.NumRecordBatches() != 2 {
+		t.Errorf("NOT OK: Expected Release to write a second record batch, got %d", writer.NumRecordBatches())
+	}
+}
+
+func TestArrowRowBuilderMaxChunkBytes(t *testing.T) {
+	var buf bytes.Buffer
+
+	// Each row takes 10 bytes of dosages, and 4 + 10 bytes of locus
+	fieldNames := []string{"locus"}
+	fieldTypes := []arrow.DataType{arrow.BinaryTypes.String}
+	for i := 0; i < 10; i++ {
+		fieldNames = append(fieldNames, fmt.Sprintf("S%d", i))
+		fieldTypes = append(fieldTypes, arrow.PrimitiveTypes.Int8)
+	}
+
+	writer, err := NewArrowIPCStreamWriter(&buf, fieldNames, fieldTypes, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewArrowRowBuilder(writer, 1000, WithMaxChunkBytes(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		row := []any{fmt.Sprintf("chr1:%03d:A", i)}
+		for j := 0; j < 10; j++ {
+			row = append(row, int8(j%3))
+		}
+
+		if err := builder.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := builder.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 24 bytes per row, so a chunk is written every 5 rows
+	if writer.NumRecordBatches() != 4 {
+		t.Errorf("NOT OK: Expected 4 record batches, got %d", writer.NumRecordBatches())
+	}
+
+	reader, err := NewArrowIPCStreamReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	numRows := 0
+	for reader.Next() {
+		numRows++
+	}
+
+	if numRows != 20 || reader.Err() != nil {
+		t.Errorf("NOT OK: Expected 20 rows, got %d, %v", numRows, reader.Err())
+	}
+}
+
+func TestArrowRowBuilderAppendError(t *testing.T) {
+	var buf bytes.Buffer
+
+	writer, err := NewArrowIPCStreamWriter(&buf, []string{"locus", "dosage"},
+		[]arrow.DataType{arrow.BinaryTypes.String, arrow.PrimitiveTypes.Int8}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewArrowRowBuilder(writer, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := builder.WriteRow([]any{"chr1:1:A:T", int8(1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := builder.WriteRow([]any{"chr1:2:A:T", 1}); err == nil {
+		t.Fatal("NOT OK: Expected an error appending an int to an int8 column")
+	}
+
+	// The locus of the failed row was appended, so the columns no longer line up
+	if err := builder.WriteRow([]any{"chr1:3:A:T", int8(1)}); err == nil {
+		t.Error("NOT OK: Expected the builder to be unusable after a failed append")
+	}
+
+	if err := builder.Release(); err == nil {
+		t.Error("NOT OK: Expected Release to return the append error")
+	}
+
+	if writer.NumRecordBatches() != 0 {
+		t.Errorf("NOT OK: Expected no record batches, got %d", writer.NumRecordBatches())
+	}
+}
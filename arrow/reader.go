@@ -0,0 +1,471 @@
+package arrow
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+)
+
+// ArrowRowReader reads the rows of an Arrow IPC file or stream, one at a time.
+// Call Next to advance to the next row, and Row or Decode to read it:
+//
+//	for reader.Next() {
+//		row, err := reader.Row()
+//		...
+//	}
+//	if err := reader.Err(); err != nil {
+//		...
+//	}
+//
+// An ArrowRowReader is not threadsafe.
+type ArrowRowReader struct {
+	Schema *arrow.Schema
+	// nextRecord returns the next record batch, or nil once there are no more
+	nextRecord func() (arrow.Record, error)
+	close      func()
+	record     arrow.Record
+	// The index of the current row in record
+	row int
+	err error
+	// Struct field indices by struct type, for Decode
+	decoders map[reflect.Type][]int
+}
+
+// Create a new ArrowRowReader that reads the Arrow IPC file format, e.g. an *os.File.
+func NewArrowIPCFileReader(r ipc.ReadAtSeeker) (*ArrowRowReader, error) {
+	reader, err := ipc.NewFileReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := 0
+	nextRecord := func() (arrow.Record, error) {
+		if batch >= reader.NumRecords() {
+			return nil, nil
+		}
+
+		// The record is owned by the reader, and valid until the next call to Record
+		record, err := reader.Record(batch)
+		batch++
+
+		return record, err
+	}
+
+	return &ArrowRowReader{
+		Schema:     reader.Schema(),
+		nextRecord: nextRecord,
+		close:      func() { reader.Close() },
+	}, nil
+}
+
+// Create a new ArrowRowReader that reads the Arrow IPC stream format, as written by NewArrowIPCStreamWriter.
+func NewArrowIPCStreamReader(r io.Reader) (*ArrowRowReader, error) {
+	reader, err := ipc.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	nextRecord := func() (arrow.Record, error) {
+		// The record is owned by the reader, and valid until the next call to Next
+		if reader.Next() {
+			return reader.Record(), nil
+		}
+
+		return nil, reader.Err()
+	}
+
+	return &ArrowRowReader{
+		Schema:     reader.Schema(),
+		nextRecord: nextRecord,
+		close:      reader.Release,
+	}, nil
+}
+
+// Metadata returns the schema metadata, e.g. as added by WithSchemaMetadata
+func (r *ArrowRowReader) Metadata() map[string]string {
+	return r.Schema.Metadata().ToMap()
+}
+
+// Next advances to the next row, returning false once there are no more rows, or on error
+func (r *ArrowRowReader) Next() bool {
+	if r.err != nil {
+		return false
+	}
+
+	r.row++
+
+	for r.record == nil || r.row >= int(r.record.NumRows()) {
+		record, err := r.nextRecord()
+		if err != nil {
+			r.err = err
+			r.record = nil
+			return false
+		}
+
+		if record == nil {
+			r.record = nil
+			return false
+		}
+
+		r.record = record
+		r.row = 0
+	}
+
+	return true
+}
+
+// Err returns the error that stopped Next, if any
+func (r *ArrowRowReader) Err() error {
+	return r.err
+}
+
+// Close releases the underlying reader, but doesn't close the file or stream it reads
+func (r *ArrowRowReader) Close() {
+	r.record = nil
+	r.close()
+}
+
+// Row returns the values of the current row, in schema order, with nil for null values.
+// The values have the Go types accepted by ArrowRowBuilder.WriteRow, e.g. int8 for an Int8 column, string for a
+// dictionary-encoded string column, []any for a list and map[string]any for a struct.
+func (r *ArrowRowReader) Row() ([]any, error) {
+	if r.record == nil {
+		return nil, errors.New("no current row, call Next first")
+	}
+
+	row := make([]any, r.record.NumCols())
+	for i, col := range r.record.Columns() {
+		val, err := value(col, r.row)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", r.Schema.Field(i).Name, err)
+		}
+
+		row[i] = val
+	}
+
+	return row, nil
+}
+
+// Decode stores the current row in the struct pointed to by dst.
+// Each column is stored in the exported field of the same name, or the field tagged `arrow:"name"`.
+// Columns without a field, and fields tagged `arrow:"-"`, are skipped.
+// A field must be assignable from the column's values (e.g. int8 or any for an Int8 column),
+// or a pointer to such a type, which is set to nil for null values. Other fields are zeroed if null.
+func (r *ArrowRowReader) Decode(dst any) error {
+	if r.record == nil {
+		return errors.New("no current row, call Next first")
+	}
+
+	dstVal := reflect.ValueOf(dst)
+	if dstVal.Kind() != reflect.Pointer || dstVal.IsNil() || dstVal.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected a non-nil pointer to a struct, got %T", dst)
+	}
+
+	dstVal = dstVal.Elem()
+
+	fieldIndices, err := r.decoder(dstVal.Type())
+	if err != nil {
+		return err
+	}
+
+	for i, col := range r.record.Columns() {
+		if fieldIndices[i] < 0 {
+			continue
+		}
+
+		val, err := value(col, r.row)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", r.Schema.Field(i).Name, err)
+		}
+
+		field := dstVal.Field(fieldIndices[i])
+
+		if val == nil {
+			field.SetZero()
+			continue
+		}
+
+		v := reflect.ValueOf(val)
+
+		if field.Kind() == reflect.Pointer && v.Type().AssignableTo(field.Type().Elem()) {
+			ptr := reflect.New(field.Type().Elem())
+			ptr.Elem().Set(v)
+			field.Set(ptr)
+			continue
+		}
+
+		field.Set(v)
+	}
+
+	return nil
+}
+
+// decoder returns the index of the struct field that each column is decoded into, or -1 if none,
+// checking that the fields can hold the column's values
+func (r *ArrowRowReader) decoder(structType reflect.Type) ([]int, error) {
+	if fieldIndices, ok := r.decoders[structType]; ok {
+		return fieldIndices, nil
+	}
+
+	byName := make(map[string]int)
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("arrow"); ok {
+			name = tag
+		}
+
+		if name == "-" {
+			continue
+		}
+
+		byName[name] = i
+	}
+
+	fieldIndices := make([]int, r.Schema.NumFields())
+	for i, column := range r.Schema.Fields() {
+		fieldIdx, ok := byName[column.Name]
+		if !ok {
+			fieldIndices[i] = -1
+			continue
+		}
+
+		valueType, err := goType(column.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", column.Name, err)
+		}
+
+		field := structType.Field(fieldIdx)
+		if !valueType.AssignableTo(field.Type) &&
+			!(field.Type.Kind() == reflect.Pointer && valueType.AssignableTo(field.Type.Elem())) {
+			return nil, fmt.Errorf("column %s: can't decode %s into field %s of type %s", column.Name, column.Type,
+				field.Name, field.Type)
+		}
+
+		fieldIndices[i] = fieldIdx
+	}
+
+	if r.decoders == nil {
+		r.decoders = make(map[reflect.Type][]int)
+	}
+	r.decoders[structType] = fieldIndices
+
+	return fieldIndices, nil
+}
+
+// goType returns the Go type of the values that Row returns for dataType
+func goType(dataType arrow.DataType) (reflect.Type, error) {
+	switch dataType.ID() {
+	case arrow.UINT8:
+		return reflect.TypeOf(uint8(0)), nil
+	case arrow.UINT16:
+		return reflect.TypeOf(uint16(0)), nil
+	case arrow.UINT32:
+		return reflect.TypeOf(uint32(0)), nil
+	case arrow.UINT64:
+		return reflect.TypeOf(uint64(0)), nil
+	case arrow.INT8:
+		return reflect.TypeOf(int8(0)), nil
+	case arrow.INT16:
+		return reflect.TypeOf(int16(0)), nil
+	case arrow.INT32:
+		return reflect.TypeOf(int32(0)), nil
+	case arrow.INT64:
+		return reflect.TypeOf(int64(0)), nil
+	case arrow.FLOAT32:
+		return reflect.TypeOf(float32(0)), nil
+	case arrow.FLOAT64:
+		return reflect.TypeOf(float64(0)), nil
+	case arrow.STRING, arrow.LARGE_STRING, arrow.DICTIONARY:
+		return reflect.TypeOf(""), nil
+	case arrow.BOOL:
+		return reflect.TypeOf(false), nil
+	case arrow.LIST, arrow.FIXED_SIZE_LIST:
+		return reflect.TypeOf([]any{}), nil
+	case arrow.STRUCT:
+		return reflect.TypeOf(map[string]any{}), nil
+	default:
+		return nil, fmt.Errorf("unsupported data type: %s", dataType)
+	}
+}
+
+// value returns the value of col at row, or nil if it is null
+func value(col arrow.Array, row int) (any, error) {
+	if col.IsNull(row) {
+		return nil, nil
+	}
+
+	switch v := col.(type) {
+	case *array.Uint8:
+		return v.Value(row), nil
+	case *array.Uint16:
+		return v.Value(row), nil
+	case *array.Uint32:
+		return v.Value(row), nil
+	case *array.Uint64:
+		return v.Value(row), nil
+	case *array.Int8:
+		return v.Value(row), nil
+	case *array.Int16:
+		return v.Value(row), nil
+	case *array.Int32:
+		return v.Value(row), nil
+	case *array.Int64:
+		return v.Value(row), nil
+	case *array.Float32:
+		return v.Value(row), nil
+	case *array.Float64:
+		return v.Value(row), nil
+	case *array.String:
+		return v.Value(row), nil
+	case *array.LargeString:
+		return v.Value(row), nil
+	case *array.Boolean:
+		return v.Value(row), nil
+	case *array.Dictionary:
+		return value(v.Dictionary(), v.GetValueIndex(row))
+	case *array.List:
+		start, end := v.ValueOffsets(row)
+		return listValue(v.ListValues(), start, end)
+	case *array.FixedSizeList:
+		start, end := v.ValueOffsets(row)
+		return listValue(v.ListValues(), start, end)
+	case *array.Struct:
+		structType := v.DataType().(*arrow.StructType)
+		fields := make(map[string]any, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			val, err := value(v.Field(i), row)
+			if err != nil {
+				return nil, err
+			}
+			fields[structType.Field(i).Name] = val
+		}
+		return fields, nil
+	default:
+		return nil, fmt.Errorf("unsupported data type: %s", col.DataType())
+	}
+}
+
+// listValue returns the elements of a list, from start to end of its values
+func listValue(values arrow.Array, start int64, end int64) ([]any, error) {
+	list := make([]any, 0, end-start)
+	for i := start; i < end; i++ {
+		val, err := value(values, int(i))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, val)
+	}
+
+	return list, nil
+}
+
+// DosageMatrix is a dosage matrix, as written by bystro-vcf's --dosageOutput, read into memory
+type DosageMatrix struct {
+	// The locus of each row, in file order, e.g. "chr1:1000:A:T"
+	Loci []string
+	// The row index of each locus
+	LocusIndex map[string]int
+	// The sample names, in file order
+	Samples []string
+	// Dosages[sampleIdx][locusIdx] is the sample's dosage, or -1 if its genotype is missing
+	Dosages [][]int8
+}
+
+// ReadDosageMatrix reads the dosage matrix read by reader, whose first column is the locus, followed by
+// an int8 dosage column per sample.
+// It must be called before reader.Next. Expected dosage matrices, with float32 dosages, aren't supported.
+func ReadDosageMatrix(reader *ArrowRowReader) (*DosageMatrix, error) {
+	if reader.record != nil || reader.err != nil {
+		return nil, errors.New("the dosage matrix has already been partly read")
+	}
+
+	fields := reader.Schema.Fields()
+	if len(fields) == 0 || fields[0].Name != "locus" || fields[0].Type.ID() != arrow.STRING {
+		return nil, errors.New("expected the first column of the dosage matrix to be a string locus")
+	}
+
+	matrix := &DosageMatrix{
+		LocusIndex: make(map[string]int),
+		Samples:    make([]string, 0, len(fields)-1),
+		Dosages:    make([][]int8, len(fields)-1),
+	}
+
+	for _, field := range fields[1:] {
+		if field.Type.ID() != arrow.INT8 {
+			return nil, fmt.Errorf("expected int8 dosages, sample %s has %s dosages", field.Name, field.Type)
+		}
+
+		matrix.Samples = append(matrix.Samples, field.Name)
+	}
+
+	// Read whole record batches at a time, rather than row by row, as there may be many samples
+	for {
+		record, err := reader.nextRecord()
+		if err != nil {
+			return nil, err
+		}
+
+		if record == nil {
+			break
+		}
+
+		loci := record.Column(0).(*array.String)
+		for row := 0; row < loci.Len(); row++ {
+			locus := loci.Value(row)
+			matrix.LocusIndex[locus] = len(matrix.Loci)
+			matrix.Loci = append(matrix.Loci, locus)
+		}
+
+		for i, col := range record.Columns()[1:] {
+			dosages := col.(*array.Int8)
+			for row := 0; row < dosages.Len(); row++ {
+				dosage := int8(-1)
+				if dosages.IsValid(row) {
+					dosage = dosages.Value(row)
+				}
+
+				matrix.Dosages[i] = append(matrix.Dosages[i], dosage)
+			}
+		}
+	}
+
+	return matrix, nil
+}
+
+// ReadDosageMatrixFile reads the dosage matrix in the Arrow IPC file at path
+func ReadDosageMatrixFile(path string) (*DosageMatrix, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := NewArrowIPCFileReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ReadDosageMatrix(reader)
+}
+
+// Dosage returns the dosage of sample sampleIdx at locus, and false if the matrix has no such locus
+func (m *DosageMatrix) Dosage(sampleIdx int, locus string) (int8, bool) {
+	locusIdx, ok := m.LocusIndex[locus]
+	if !ok {
+		return 0, false
+	}
+
+	return m.Dosages[sampleIdx][locusIdx], true
+}
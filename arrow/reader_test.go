@@ -0,0 +1,369 @@
+package arrow
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow"
+)
+
+func writeTestFile(t *testing.T, filePath string, fieldNames []string, fieldTypes []arrow.DataType, rows [][]any) {
+	file, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer, err := NewArrowIPCFileWriter(file, fieldNames, fieldTypes, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewArrowRowBuilder(writer, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range rows {
+		if err := builder.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := builder.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArrowRowReaderRows(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "test.feather")
+
+	fieldNames := []string{"locus", "count", "score", "pass"}
+	fieldTypes := []arrow.DataType{arrow.BinaryTypes.String, arrow.PrimitiveTypes.Uint32, arrow.PrimitiveTypes.Float64,
+		arrow.FixedWidthTypes.Boolean}
+	rows := [][]any{
+		{"chr1:100:A:T", uint32(1), 0.5, true},
+		{"chr1:200:C:G", nil, 1.5, false},
+		{"chr2:300:G:T", uint32(3), nil, nil},
+	}
+
+	writeTestFile(t, filePath, fieldNames, fieldTypes, rows)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	reader, err := NewArrowIPCFileReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var readRows [][]any
+	for reader.Next() {
+		row, err := reader.Row()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		readRows = append(readRows, row)
+	}
+
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(readRows, rows) {
+		t.Errorf("NOT OK: Expected %v, got %v", rows, readRows)
+	}
+}
+
+func TestArrowRowReaderDecode(t *testing.T) {
+	var buf bytes.Buffer
+
+	fieldNames := []string{"locus", "count", "score", "ignored"}
+	fieldTypes := []arrow.DataType{arrow.BinaryTypes.String, arrow.PrimitiveTypes.Uint32, arrow.PrimitiveTypes.Float64,
+		arrow.PrimitiveTypes.Int8}
+
+	writer, err := NewArrowIPCStreamWriter(&buf, fieldNames, fieldTypes, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewArrowRowBuilder(writer, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range [][]any{{"chr1:100:A:T", uint32(1), 0.5, int8(1)}, {"chr1:200:C:G", nil, nil, nil},
+		{"chr2:300:G:T", uint32(3), 2.5, int8(0)}} {
+		if err := builder.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := builder.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	type site struct {
+		Locus   string  `arrow:"locus"`
+		Count   *uint32 `arrow:"count"`
+		Score   float64 `arrow:"score"`
+		Ignored int8    `arrow:"-"`
+		Other   string
+	}
+
+	reader, err := NewArrowIPCStreamReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var sites []string
+	for reader.Next() {
+		s := site{Ignored: 9, Other: "kept"}
+		if err := reader.Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+
+		count := "nil"
+		if s.Count != nil {
+			count = fmt.Sprint(*s.Count)
+		}
+
+		sites = append(sites, fmt.Sprintf("%s %s %v %d %s", s.Locus, count, s.Score, s.Ignored, s.Other))
+	}
+
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"chr1:100:A:T 1 0.5 9 kept", "chr1:200:C:G nil 0 9 kept", "chr2:300:G:T 3 2.5 9 kept"}
+	if !reflect.DeepEqual(sites, expected) {
+		t.Errorf("NOT OK: Expected %v, got %v", expected, sites)
+	}
+}
+
+func TestArrowRowReaderDecodeTypeMismatch(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "test.feather")
+
+	writeTestFile(t, filePath, []string{"locus"}, []arrow.DataType{arrow.BinaryTypes.String}, [][]any{{"chr1:100:A:T"}})
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	reader, err := NewArrowIPCFileReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if !reader.Next() {
+		t.Fatal("NOT OK: Expected a row")
+	}
+
+	var s struct {
+		Locus int `arrow:"locus"`
+	}
+
+	if err := reader.Decode(&s); err == nil {
+		t.Error("NOT OK: Expected an error decoding a string column into an int field")
+	}
+
+	if err := reader.Decode(s); err == nil {
+		t.Error("NOT OK: Expected an error decoding into a struct that isn't a pointer")
+	}
+}
+
+func TestReadDosageMatrix(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "dosages.feather")
+
+	fieldNames := []string{"locus", "S1", "S2"}
+	fieldTypes := []arrow.DataType{arrow.BinaryTypes.String, arrow.PrimitiveTypes.Int8, arrow.PrimitiveTypes.Int8}
+
+	writeTestFile(t, filePath, fieldNames, fieldTypes, [][]any{
+		{"chr1:100:A:T", int8(2), int8(0)},
+		{"chr1:200:C:G", int8(-1), int8(1)},
+		{"chr2:300:G:T", nil, int8(2)},
+	})
+
+	matrix, err := ReadDosageMatrixFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(matrix.Samples, []string{"S1", "S2"}) {
+		t.Errorf("NOT OK: Unexpected samples %v", matrix.Samples)
+	}
+
+	if !reflect.DeepEqual(matrix.Loci, []string{"chr1:100:A:T", "chr1:200:C:G", "chr2:300:G:T"}) {
+		t.Errorf("NOT OK: Unexpected loci %v", matrix.Loci)
+	}
+
+	if !reflect.DeepEqual(matrix.Dosages, [][]int8{{2, -1, -1}, {0, 1, 2}}) {
+		t.Errorf("NOT OK: Unexpected dosages %v", matrix.Dosages)
+	}
+
+	if dosage, ok := matrix.Dosage(1, "chr1:200:C:G"); !ok || dosage != 1 {
+		t.Errorf("NOT OK: Expected S2 to have a dosage of 1 at chr1:200:C:G, got %d", dosage)
+	}
+
+	if _, ok := matrix.Dosage(0, "chr3:1:A:T"); ok {
+		t.Error("NOT OK: Expected no dosage for a missing locus")
+	}
+}
+
+func TestReadDosageMatrixExpectedDosages(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "dosages.feather")
+
+	writeTestFile(t, filePath, []string{"locus", "S1"}, []arrow.DataType{arrow.BinaryTypes.String,
+		arrow.PrimitiveTypes.Float32}, [][]any{{"chr1:100:A:T", float32(0.5)}})
+
+	if _, err := ReadDosageMatrixFile(filePath); err == nil {
+		t.Error("NOT OK: Expected an error reading float32 dosages")
+	}
+}
+
+func TestArrowRowReaderMetadata(t *testing.T) {
+	var buf bytes.Buffer
+
+	schema := NewSchema([]string{"locus"}, []arrow.DataType{arrow.BinaryTypes.String}, false)
+	schema = WithSchemaMetadata(schema, map[string]string{"source": "test", "samples": "1"})
+	schema = WithSchemaMetadata(schema, map[string]string{"samples": "2"})
+
+	writer, err := NewArrowIPCStreamWriterWithSchema(&buf, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewArrowIPCStreamReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	expected := map[string]string{"source": "test", "samples": "2"}
+	if !reflect.DeepEqual(reader.Metadata(), expected) {
+		t.Errorf("NOT OK: Expected metadata %v, got %v", expected, reader.Metadata())
+	}
+}
+
+// Metadata set after chunks are written is in the file format's footer, but can't be added to a stream
+func TestSetMetadata(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metadata.feather")
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	fieldNames := []string{"locus"}
+	fieldTypes := []arrow.DataType{arrow.BinaryTypes.String}
+
+	schema := WithSchemaMetadata(NewSchema(fieldNames, fieldTypes, false),
+		map[string]string{"source": "test", "checksum": ""})
+
+	writer, err := NewArrowIPCFileWriterWithSchema(file, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewArrowRowBuilder(writer, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, locus := range []string{"chr1:100:A:T", "chr1:200:C:G"} {
+		if err := builder.WriteRow([]any{locus}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := builder.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.SetMetadata(map[string]string{"checksum": "abc123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewArrowIPCFileReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	expected := map[string]string{"source": "test", "checksum": "abc123"}
+	if !reflect.DeepEqual(reader.Metadata(), expected) {
+		t.Errorf("NOT OK: Expected metadata %v, got %v", expected, reader.Metadata())
+	}
+
+	numRows := 0
+	for reader.Next() {
+		numRows++
+	}
+
+	if reader.Err() != nil || numRows != 2 {
+		t.Errorf("NOT OK: Expected 2 rows, got %d, %v", numRows, reader.Err())
+	}
+
+	var buf bytes.Buffer
+	streamWriter, err := NewArrowIPCStreamWriter(&buf, fieldNames, fieldTypes, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := streamWriter.SetMetadata(map[string]string{"checksum": "abc123"}); err != nil {
+		t.Errorf("NOT OK: Expected metadata to be set before the stream is written, got %v", err)
+	}
+
+	streamBuilder, err := NewArrowRowBuilder(streamWriter, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := streamBuilder.WriteRow([]any{"chr1:100:A:T"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := streamWriter.SetMetadata(map[string]string{"checksum": "def456"}); !errors.Is(err, ErrMetadataWritten) {
+		t.Errorf("NOT OK: Expected ErrMetadataWritten once the stream is written, got %v", err)
+	}
+
+	if err := streamBuilder.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
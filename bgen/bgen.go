@@ -0,0 +1,447 @@
+package bgen
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// BGEN v1.2, layout 2, as described in https://www.well.ox.ac.uk/~gav/bgen_format/spec/latest.html
+
+type Compression uint32
+
+const (
+	NoCompression   Compression = 0
+	ZlibCompression Compression = 1
+	ZstdCompression Compression = 2
+)
+
+// ParseCompression converts a compression name (none, zlib, zstd) to a Compression
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "none", "":
+		return NoCompression, nil
+	case "zlib":
+		return ZlibCompression, nil
+	case "zstd":
+		return ZstdCompression, nil
+	default:
+		return 0, fmt.Errorf("unsupported BGEN compression: %s", name)
+	}
+}
+
+const (
+	headerLength     uint32 = 20
+	layout2          uint32 = 2 << 2
+	sampleIdentifier uint32 = 1 << 31
+	bitsPerProb      uint8  = 8
+	maxProb          byte   = math.MaxUint8
+	missingPloidy    byte   = 0x80
+	maxPloidy        uint8  = 63
+)
+
+// Byte offset of the variant count in the file: it follows the first variant offset and the header block length
+const variantCountOffset int64 = 8
+
+var magic = []byte("bgen")
+
+// IndexMagic begins every offset index file written by BgenWriter
+var IndexMagic = []byte("bgix")
+
+// IndexVersion is the version of the offset index format
+const IndexVersion uint32 = 1
+
+// Variant identifies a biallelic variant. Alleles[0] is the first (reference) allele,
+// and Alleles[1] the second (alternate) allele
+type Variant struct {
+	ID      string
+	RSID    string
+	Chrom   string
+	Pos     uint32
+	Alleles [2]string
+}
+
+// Genotypes are the hard-called genotypes of every sample at a biallelic variant
+type Genotypes struct {
+	// Alleles holds one entry per haplotype, in sample order:
+	// 0 for the first allele, 1 for the second allele, -1 if missing
+	Alleles []int8
+	// Ploidy holds the number of haplotypes of each sample
+	Ploidy []uint8
+	// Phased is true when the genotypes of every sample are phased, not counting missing samples
+	Phased bool
+}
+
+// BgenWriter writes BGEN v1.2 files with layout 2 genotype blocks, 8 bits per probability,
+// and a sample identifier block.
+// Optionally, it writes an offset index, holding the same fields as the Variant table
+// of a .bgi index, without requiring SQLite:
+//
+//	magic "bgix", version (uint32)
+//	then one record per variant, until EOF:
+//	  chromosome (uint16 length + bytes), position (uint32), rsid (uint16 length + bytes),
+//	  number of alleles (uint16), allele1 (uint32 length + bytes), allele2 (uint32 length + bytes),
+//	  file start position (uint64), size in bytes (uint64)
+//
+// All integers are little endian.
+// This writing operation is threadsafe.
+type BgenWriter struct {
+	file        *os.File
+	writer      *bufio.Writer
+	index       *bufio.Writer
+	compression Compression
+	zstdEncoder *zstd.Encoder
+	numSamples  int
+	numVariants uint32
+	offset      uint64
+	mu          sync.Mutex
+}
+
+// NewBgenWriter writes the BGEN header and sample identifier block to f, and returns a
+// BgenWriter ready to accept variants. If index is not nil, an offset index is written to it
+func NewBgenWriter(f *os.File, index io.Writer, sampleNames []string, compression Compression) (*BgenWriter, error) {
+	bw := &BgenWriter{
+		file:        f,
+		writer:      bufio.NewWriterSize(f, 1024*1024),
+		compression: compression,
+		numSamples:  len(sampleNames),
+	}
+
+	if compression == ZstdCompression {
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		bw.zstdEncoder = encoder
+	}
+
+	var buf bytes.Buffer
+
+	sampleBlockLength := uint32(8)
+	for _, name := range sampleNames {
+		if len(name) > math.MaxUint16 {
+			return nil, fmt.Errorf("sample identifier too long: %s", name)
+		}
+
+		sampleBlockLength += 2 + uint32(len(name))
+	}
+
+	// Offset of the first variant block, relative to the 5th byte of the file
+	writeUint32(&buf, headerLength+sampleBlockLength)
+
+	// Header block; the number of variants is updated on Close
+	writeUint32(&buf, headerLength)
+	writeUint32(&buf, 0)
+	writeUint32(&buf, uint32(len(sampleNames)))
+	buf.Write(magic)
+	writeUint32(&buf, uint32(compression)|layout2|sampleIdentifier)
+
+	// Sample identifier block
+	writeUint32(&buf, sampleBlockLength)
+	writeUint32(&buf, uint32(len(sampleNames)))
+	for _, name := range sampleNames {
+		writeUint16(&buf, uint16(len(name)))
+		buf.WriteString(name)
+	}
+
+	if _, err := bw.writer.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	bw.offset = uint64(buf.Len())
+
+	if index != nil {
+		bw.index = bufio.NewWriter(index)
+
+		var header bytes.Buffer
+		header.Write(IndexMagic)
+		writeUint32(&header, IndexVersion)
+
+		if _, err := bw.index.Write(header.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	return bw, nil
+}
+
+// WriteVariant encodes and writes a single variant block
+func (bw *BgenWriter) WriteVariant(variant Variant, genotypes Genotypes) error {
+	if len(genotypes.Ploidy) != bw.numSamples {
+		return fmt.Errorf("mismatch in number of samples: expected %d, got %d", bw.numSamples, len(genotypes.Ploidy))
+	}
+
+	block, err := bw.encodeVariant(variant, genotypes)
+	if err != nil {
+		return err
+	}
+
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	if _, err := bw.writer.Write(block); err != nil {
+		return err
+	}
+
+	if bw.index != nil {
+		if err := writeIndexRecord(bw.index, variant, bw.offset, uint64(len(block))); err != nil {
+			return err
+		}
+	}
+
+	bw.offset += uint64(len(block))
+	bw.numVariants++
+
+	return nil
+}
+
+// Close flushes all variants, records the number of variants in the header block,
+// and closes the underlying file, even if an earlier step fails, returning the first error.
+// This must be called to ensure that all data is successfully written
+func (bw *BgenWriter) Close() error {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	if bw.zstdEncoder != nil {
+		bw.zstdEncoder.Close()
+	}
+
+	var firstErr error
+	if bw.index != nil {
+		firstErr = bw.index.Flush()
+	}
+
+	if err := bw.writer.Flush(); err != nil {
+		if firstErr == nil {
+			firstErr = err
+		}
+	} else {
+		var count [4]byte
+		binary.LittleEndian.PutUint32(count[:], bw.numVariants)
+
+		if _, err := bw.file.WriteAt(count[:], variantCountOffset); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if err := bw.file.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	return firstErr
+}
+
+func (bw *BgenWriter) encodeVariant(variant Variant, genotypes Genotypes) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, field := range []string{variant.ID, variant.RSID, variant.Chrom} {
+		if len(field) > math.MaxUint16 {
+			return nil, fmt.Errorf("variant identifier too long: %s", field)
+		}
+
+		writeUint16(&buf, uint16(len(field)))
+		buf.WriteString(field)
+	}
+
+	writeUint32(&buf, variant.Pos)
+	writeUint16(&buf, uint16(len(variant.Alleles)))
+
+	for _, allele := range variant.Alleles {
+		writeUint32(&buf, uint32(len(allele)))
+		buf.WriteString(allele)
+	}
+
+	probabilities, err := encodeProbabilities(genotypes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch bw.compression {
+	case NoCompression:
+		writeUint32(&buf, uint32(len(probabilities)))
+		buf.Write(probabilities)
+	case ZlibCompression:
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+
+		if _, err := zw.Write(probabilities); err != nil {
+			return nil, err
+		}
+
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+		writeUint32(&buf, uint32(compressed.Len()+4))
+		writeUint32(&buf, uint32(len(probabilities)))
+		buf.Write(compressed.Bytes())
+	case ZstdCompression:
+		compressed := bw.zstdEncoder.EncodeAll(probabilities, nil)
+
+		writeUint32(&buf, uint32(len(compressed)+4))
+		writeUint32(&buf, uint32(len(probabilities)))
+		buf.Write(compressed)
+	default:
+		return nil, fmt.Errorf("unsupported BGEN compression: %d", bw.compression)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encodeProbabilities creates the (uncompressed) layout 2 genotype probability data
+// Since genotypes are hard calls, every stored probability is either 0 or 1
+// Phased data stores, per haplotype, the probability of the first allele
+// Unphased data stores, per sample, the probability of each genotype
+// with 0 through ploidy-1 copies of the second allele
+// Missing samples have all probabilities set to 0
+func encodeProbabilities(genotypes Genotypes) ([]byte, error) {
+	numSamples := len(genotypes.Ploidy)
+
+	var buf bytes.Buffer
+
+	minPloidy := maxPloidy
+	maxObservedPloidy := uint8(0)
+	for _, ploidy := range genotypes.Ploidy {
+		if ploidy > maxPloidy {
+			return nil, fmt.Errorf("ploidy %d exceeds the BGEN maximum of %d", ploidy, maxPloidy)
+		}
+
+		if ploidy < minPloidy {
+			minPloidy = ploidy
+		}
+
+		if ploidy > maxObservedPloidy {
+			maxObservedPloidy = ploidy
+		}
+	}
+
+	if numSamples == 0 {
+		minPloidy = 0
+	}
+
+	writeUint32(&buf, uint32(numSamples))
+	writeUint16(&buf, 2)
+	buf.WriteByte(minPloidy)
+	buf.WriteByte(maxObservedPloidy)
+
+	missing := make([]bool, numSamples)
+
+	hapIdx := 0
+	for i, ploidy := range genotypes.Ploidy {
+		if hapIdx+int(ploidy) > len(genotypes.Alleles) {
+			return nil, fmt.Errorf("sample %d: ploidy %d exceeds the number of alleles", i, ploidy)
+		}
+
+		for _, allele := range genotypes.Alleles[hapIdx : hapIdx+int(ploidy)] {
+			if allele < 0 {
+				missing[i] = true
+				break
+			}
+		}
+
+		if missing[i] {
+			buf.WriteByte(ploidy | missingPloidy)
+		} else {
+			buf.WriteByte(ploidy)
+		}
+
+		hapIdx += int(ploidy)
+	}
+
+	if hapIdx != len(genotypes.Alleles) {
+		return nil, fmt.Errorf("mismatch in number of alleles: expected %d, got %d", hapIdx, len(genotypes.Alleles))
+	}
+
+	if genotypes.Phased {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+
+	buf.WriteByte(bitsPerProb)
+
+	hapIdx = 0
+	for i, ploidy := range genotypes.Ploidy {
+		alleles := genotypes.Alleles[hapIdx : hapIdx+int(ploidy)]
+		hapIdx += int(ploidy)
+
+		if genotypes.Phased {
+			for _, allele := range alleles {
+				if !missing[i] && allele == 0 {
+					buf.WriteByte(maxProb)
+				} else {
+					buf.WriteByte(0)
+				}
+			}
+
+			continue
+		}
+
+		altCount := 0
+		for _, allele := range alleles {
+			if allele == 1 {
+				altCount++
+			}
+		}
+
+		for copies := 0; copies < int(ploidy); copies++ {
+			if !missing[i] && copies == altCount {
+				buf.WriteByte(maxProb)
+			} else {
+				buf.WriteByte(0)
+			}
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeIndexRecord(w io.Writer, variant Variant, offset uint64, size uint64) error {
+	var buf bytes.Buffer
+
+	writeUint16(&buf, uint16(len(variant.Chrom)))
+	buf.WriteString(variant.Chrom)
+	writeUint32(&buf, variant.Pos)
+	writeUint16(&buf, uint16(len(variant.RSID)))
+	buf.WriteString(variant.RSID)
+	writeUint16(&buf, uint16(len(variant.Alleles)))
+
+	for _, allele := range variant.Alleles {
+		writeUint32(&buf, uint32(len(allele)))
+		buf.WriteString(allele)
+	}
+
+	writeUint64(&buf, offset)
+	writeUint64(&buf, size)
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+func writeUint16(buf *bytes.Buffer, val uint16) {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], val)
+	buf.Write(b[:])
+}
+
+func writeUint32(buf *bytes.Buffer, val uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], val)
+	buf.Write(b[:])
+}
+
+func writeUint64(buf *bytes.Buffer, val uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], val)
+	buf.Write(b[:])
+}
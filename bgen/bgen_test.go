@@ -0,0 +1,376 @@
+package bgen
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type decodedVariant struct {
+	variant       Variant
+	probabilities []byte
+}
+
+type decodedBgen struct {
+	numVariants uint32
+	flags       uint32
+	samples     []string
+	variants    []decodedVariant
+}
+
+// decodeBgen reads back the subset of BGEN v1.2 that BgenWriter produces
+func decodeBgen(t *testing.T, data []byte) decodedBgen {
+	var decoded decodedBgen
+
+	firstVariant := binary.LittleEndian.Uint32(data[0:4]) + 4
+	headerLength := binary.LittleEndian.Uint32(data[4:8])
+	decoded.numVariants = binary.LittleEndian.Uint32(data[8:12])
+	numSamples := binary.LittleEndian.Uint32(data[12:16])
+
+	if string(data[16:20]) != "bgen" {
+		t.Fatalf("NOT OK: Expected bgen magic, got %q", data[16:20])
+	}
+
+	decoded.flags = binary.LittleEndian.Uint32(data[headerLength : headerLength+4])
+
+	r := bytes.NewReader(data[headerLength+4+8 : firstVariant])
+	for i := uint32(0); i < numSamples; i++ {
+		decoded.samples = append(decoded.samples, readString16(t, r))
+	}
+
+	r = bytes.NewReader(data[firstVariant:])
+	for r.Len() > 0 {
+		var v decodedVariant
+
+		v.variant.ID = readString16(t, r)
+		v.variant.RSID = readString16(t, r)
+		v.variant.Chrom = readString16(t, r)
+		v.variant.Pos = readUint32(t, r)
+
+		if numAlleles := readUint16(t, r); numAlleles != 2 {
+			t.Fatalf("NOT OK: Expected 2 alleles, got %d", numAlleles)
+		}
+
+		v.variant.Alleles[0] = readString32(t, r)
+		v.variant.Alleles[1] = readString32(t, r)
+
+		blockLength := readUint32(t, r)
+		block := make([]byte, blockLength)
+		if _, err := io.ReadFull(r, block); err != nil {
+			t.Fatal(err)
+		}
+
+		switch Compression(decoded.flags & 3) {
+		case NoCompression:
+			v.probabilities = block
+		case ZlibCompression:
+			zr, err := zlib.NewReader(bytes.NewReader(block[4:]))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v.probabilities, err = io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+		case ZstdCompression:
+			decoder, err := zstd.NewReader(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v.probabilities, err = decoder.DecodeAll(block[4:], nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoder.Close()
+		}
+
+		decoded.variants = append(decoded.variants, v)
+	}
+
+	return decoded
+}
+
+func readUint16(t *testing.T, r io.Reader) uint16 {
+	var val uint16
+	if err := binary.Read(r, binary.LittleEndian, &val); err != nil {
+		t.Fatal(err)
+	}
+	return val
+}
+
+func readUint32(t *testing.T, r io.Reader) uint32 {
+	var val uint32
+	if err := binary.Read(r, binary.LittleEndian, &val); err != nil {
+		t.Fatal(err)
+	}
+	return val
+}
+
+func readUint64(t *testing.T, r io.Reader) uint64 {
+	var val uint64
+	if err := binary.Read(r, binary.LittleEndian, &val); err != nil {
+		t.Fatal(err)
+	}
+	return val
+}
+
+func readString16(t *testing.T, r io.Reader) string {
+	buf := make([]byte, readUint16(t, r))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func readString32(t *testing.T, r io.Reader) string {
+	buf := make([]byte, readUint32(t, r))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func TestEncodeProbabilitiesPhased(t *testing.T) {
+	genotypes := Genotypes{
+		// 0|1, 1|1, 1|., 1
+		Alleles: []int8{0, 1, 1, 1, 1, -1, 1},
+		Ploidy:  []uint8{2, 2, 2, 1},
+		Phased:  true,
+	}
+
+	probabilities, err := encodeProbabilities(genotypes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		// N
+		4, 0, 0, 0,
+		// K
+		2, 0,
+		// Pmin, Pmax
+		1, 2,
+		// ploidy and missingness
+		2, 2, 2 | 0x80, 1,
+		// phased, B
+		1, 8,
+		// P(first allele) per haplotype
+		255, 0,
+		0, 0,
+		0, 0,
+		0,
+	}
+
+	if !bytes.Equal(probabilities, expected) {
+		t.Errorf("NOT OK: Expected %v, got %v", expected, probabilities)
+	}
+}
+
+func TestEncodeProbabilitiesUnphased(t *testing.T) {
+	genotypes := Genotypes{
+		// 0/0, 0/1, 1/1, ./., 1, 0/0/1/1
+		Alleles: []int8{0, 0, 0, 1, 1, 1, -1, -1, 1, 0, 0, 1, 1},
+		Ploidy:  []uint8{2, 2, 2, 2, 1, 4},
+		Phased:  false,
+	}
+
+	probabilities, err := encodeProbabilities(genotypes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		6, 0, 0, 0,
+		2, 0,
+		1, 4,
+		2, 2, 2, 2 | 0x80, 1, 4,
+		0, 8,
+		// P(0 alt copies), P(1 alt copy) ...
+		255, 0,
+		0, 255,
+		0, 0,
+		0, 0,
+		0,
+		0, 0, 255, 0,
+	}
+
+	if !bytes.Equal(probabilities, expected) {
+		t.Errorf("NOT OK: Expected %v, got %v", expected, probabilities)
+	}
+}
+
+func TestEncodeProbabilitiesErrors(t *testing.T) {
+	if _, err := encodeProbabilities(Genotypes{Alleles: []int8{0}, Ploidy: []uint8{2}}); err == nil {
+		t.Error("NOT OK: Expected error when ploidy exceeds number of alleles")
+	}
+
+	if _, err := encodeProbabilities(Genotypes{Alleles: []int8{0, 0, 0}, Ploidy: []uint8{2}}); err == nil {
+		t.Error("NOT OK: Expected error when alleles exceed ploidy")
+	}
+
+	if _, err := encodeProbabilities(Genotypes{Alleles: make([]int8, 64), Ploidy: []uint8{64}}); err == nil {
+		t.Error("NOT OK: Expected error when ploidy exceeds 63")
+	}
+}
+
+func TestBgenWriter(t *testing.T) {
+	for _, compression := range []Compression{NoCompression, ZlibCompression, ZstdCompression} {
+		path := filepath.Join(t.TempDir(), "test.bgen")
+
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var index bytes.Buffer
+
+		writer, err := NewBgenWriter(file, &index, []string{"S1", "Sample2"}, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		variants := []Variant{
+			{ID: "chr1:1000:A:T", RSID: "rs1", Chrom: "chr1", Pos: 1000, Alleles: [2]string{"A", "T"}},
+			{ID: "chr2:200:C:+GG", RSID: ".", Chrom: "chr2", Pos: 200, Alleles: [2]string{"C", "+GG"}},
+		}
+		genotypes := []Genotypes{
+			{Alleles: []int8{0, 1, 1, 1}, Ploidy: []uint8{2, 2}, Phased: true},
+			{Alleles: []int8{1, 0, -1, -1}, Ploidy: []uint8{2, 2}, Phased: false},
+		}
+
+		for i := range variants {
+			if err := writer.WriteVariant(variants[i], genotypes[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := writer.WriteVariant(variants[0], Genotypes{Alleles: []int8{0, 0}, Ploidy: []uint8{2}}); err == nil {
+			t.Error("NOT OK: Expected error for mismatched sample count")
+		}
+
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded := decodeBgen(t, data)
+
+		if decoded.numVariants != 2 {
+			t.Errorf("NOT OK: Expected 2 variants in header, got %d", decoded.numVariants)
+		}
+
+		if expectedFlags := uint32(compression) | 2<<2 | 1<<31; decoded.flags != expectedFlags {
+			t.Errorf("NOT OK: Expected flags %b, got %b", expectedFlags, decoded.flags)
+		}
+
+		if !reflect.DeepEqual(decoded.samples, []string{"S1", "Sample2"}) {
+			t.Errorf("NOT OK: Unexpected samples %v", decoded.samples)
+		}
+
+		if len(decoded.variants) != 2 {
+			t.Fatalf("NOT OK: Expected 2 variant blocks, got %d", len(decoded.variants))
+		}
+
+		for i, v := range decoded.variants {
+			if v.variant != variants[i] {
+				t.Errorf("NOT OK: Expected variant %v, got %v", variants[i], v.variant)
+			}
+
+			expected, err := encodeProbabilities(genotypes[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(v.probabilities, expected) {
+				t.Errorf("NOT OK: Expected probabilities %v, got %v", expected, v.probabilities)
+			}
+		}
+
+		// The index should point at each variant block
+		r := bytes.NewReader(index.Bytes())
+
+		magic := make([]byte, 4)
+		io.ReadFull(r, magic)
+		if !bytes.Equal(magic, IndexMagic) || readUint32(t, r) != IndexVersion {
+			t.Fatalf("NOT OK: Unexpected index header")
+		}
+
+		for i := 0; r.Len() > 0; i++ {
+			chrom := readString16(t, r)
+			pos := readUint32(t, r)
+			rsid := readString16(t, r)
+			readUint16(t, r)
+			allele1 := readString32(t, r)
+			allele2 := readString32(t, r)
+			offset := readUint64(t, r)
+			size := readUint64(t, r)
+
+			if chrom != variants[i].Chrom || pos != variants[i].Pos || rsid != variants[i].RSID ||
+				allele1 != variants[i].Alleles[0] || allele2 != variants[i].Alleles[1] {
+				t.Errorf("NOT OK: Unexpected index record %s %d %s %s %s", chrom, pos, rsid, allele1, allele2)
+			}
+
+			id := data[offset+2 : offset+2+uint64(len(variants[i].ID))]
+			if string(id) != variants[i].ID {
+				t.Errorf("NOT OK: Expected index offset to point at %s, found %s", variants[i].ID, id)
+			}
+
+			if i == 1 && offset+size != uint64(len(data)) {
+				t.Errorf("NOT OK: Expected last variant to end at %d, ends at %d", len(data), offset+size)
+			}
+		}
+	}
+}
+
+// failingWriter fails every write, as a full disk would
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestBgenWriterCloseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.bgen")
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := NewBgenWriter(file, failingWriter{}, []string{"S1"}, NoCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err == nil || err.Error() != "disk full" {
+		t.Errorf("NOT OK: Expected the index error, got %v", err)
+	}
+
+	// The file is closed, and its variant count written, despite the index error
+	if _, err := file.Write([]byte{0}); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("NOT OK: Expected the BGEN file to be closed, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded := decodeBgen(t, data); decoded.numVariants != 0 || len(decoded.samples) != 1 {
+		t.Errorf("NOT OK: Expected a complete BGEN file, got %+v", decoded)
+	}
+}
@@ -0,0 +1,261 @@
+package plink
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SNP-major PLINK 1.9 .bed magic number
+// See: https://www.cog-genomics.org/plink/1.9/formats#bed
+var bedMagic = []byte{0x6c, 0x1b, 0x01}
+
+// 2-bit genotype codes, where the first .bim allele (A1) is the counted (alt) allele
+const (
+	homA1   byte = 0x0
+	missing byte = 0x1
+	het     byte = 0x2
+	homA2   byte = 0x3
+)
+
+// ErrNotDiploid is returned by WriteVariant for variants with a called genotype of more than 2 alleles, which PLINK 1
+// binary files can't represent. Nothing is written for them
+var ErrNotDiploid = errors.New("PLINK 1 binary files are diploid only")
+
+// FamRecord is a single line of a PLINK .fam file
+type FamRecord struct {
+	FamilyID     string
+	IndividualID string
+	FatherID     string
+	MotherID     string
+	Sex          string
+	Phenotype    string
+}
+
+func (r FamRecord) String() string {
+	return strings.Join([]string{r.FamilyID, r.IndividualID, r.FatherID, r.MotherID, r.Sex, r.Phenotype}, "\t")
+}
+
+// DefaultFamRecord creates a .fam record for a sample with no pedigree information
+func DefaultFamRecord(sampleName string) FamRecord {
+	return FamRecord{
+		FamilyID:     sampleName,
+		IndividualID: sampleName,
+		FatherID:     "0",
+		MotherID:     "0",
+		Sex:          "0",
+		Phenotype:    "-9",
+	}
+}
+
+// ReadFamFile reads a PLINK .fam file, returning the records keyed by individual id
+func ReadFamFile(path string) (map[string]FamRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := make(map[string]FamRecord)
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("%s line %d: expected 6 fields, found %d", path, lineNum, len(fields))
+		}
+
+		records[fields[1]] = FamRecord{
+			FamilyID:     fields[0],
+			IndividualID: fields[1],
+			FatherID:     fields[2],
+			MotherID:     fields[3],
+			Sex:          fields[4],
+			Phenotype:    fields[5],
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// MakeFamRecords creates one .fam record per sample, in sample order.
+// Samples found in famRecords (which may be nil) keep their pedigree information,
+// the remainder are given default records
+func MakeFamRecords(sampleNames []string, famRecords map[string]FamRecord) []FamRecord {
+	records := make([]FamRecord, len(sampleNames))
+
+	for i, name := range sampleNames {
+		if record, ok := famRecords[name]; ok {
+			records[i] = record
+			continue
+		}
+
+		records[i] = DefaultFamRecord(name)
+	}
+
+	return records
+}
+
+// PlinkWriter writes PLINK 1.9 binary filesets (.bed, .bim, .fam)
+// Variants are written in SNP-major order, one .bim line per .bed row
+// This writing operation is threadsafe.
+type PlinkWriter struct {
+	numSamples int
+	bedFile    *os.File
+	bimFile    *os.File
+	bed        *bufio.Writer
+	bim        *bufio.Writer
+	mu         sync.Mutex
+}
+
+// NewPlinkWriter creates prefix.bed, prefix.bim and prefix.fam, writing the .fam
+// immediately from the given records
+func NewPlinkWriter(prefix string, famRecords []FamRecord) (*PlinkWriter, error) {
+	famFile, err := os.Create(prefix + ".fam")
+	if err != nil {
+		return nil, err
+	}
+
+	fam := bufio.NewWriter(famFile)
+	for _, record := range famRecords {
+		fam.WriteString(record.String())
+		fam.WriteByte('\n')
+	}
+
+	if err := fam.Flush(); err != nil {
+		famFile.Close()
+		return nil, err
+	}
+
+	if err := famFile.Close(); err != nil {
+		return nil, err
+	}
+
+	bedFile, err := os.Create(prefix + ".bed")
+	if err != nil {
+		return nil, err
+	}
+
+	bimFile, err := os.Create(prefix + ".bim")
+	if err != nil {
+		bedFile.Close()
+		return nil, err
+	}
+
+	pw := &PlinkWriter{
+		numSamples: len(famRecords),
+		bedFile:    bedFile,
+		bimFile:    bimFile,
+		bed:        bufio.NewWriterSize(bedFile, 1024*1024),
+		bim:        bufio.NewWriterSize(bimFile, 1024*1024),
+	}
+
+	if _, err := pw.bed.Write(bedMagic); err != nil {
+		pw.Close()
+		return nil, err
+	}
+
+	return pw, nil
+}
+
+// WriteVariant writes one variant to the .bim and .bed files
+// dosages must contain one int8 alt allele count per sample, with -1 for missing genotypes,
+// as returned by makeHetHomozygotes, and ploidy the number of alleles in each sample's genotype
+// The alt allele is written as A1, and the ref allele as A2
+// Haploid genotypes, e.g. of males on chrX, are written as homozygous, as PLINK does when importing a VCF
+// Variants with a called genotype of more than 2 alleles return an error wrapping ErrNotDiploid
+func (pw *PlinkWriter) WriteVariant(chrom string, pos string, id string, ref string, alt string, dosages []any,
+	ploidy []uint8) error {
+	if len(dosages) != pw.numSamples || len(ploidy) != pw.numSamples {
+		return fmt.Errorf("mismatch in number of samples: expected %d, got %d dosages and %d ploidies", pw.numSamples,
+			len(dosages), len(ploidy))
+	}
+
+	row, err := packDosages(dosages, ploidy)
+	if err != nil {
+		return err
+	}
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	if _, err := pw.bed.Write(row); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(pw.bim, "%s\t%s\t0\t%s\t%s\t%s\n", chrom, id, pos, alt, ref)
+
+	return err
+}
+
+// Close flushes and closes the .bed and .bim files. This must be called to ensure
+// that all data is successfully written
+func (pw *PlinkWriter) Close() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	var firstErr error
+	for _, err := range []error{pw.bed.Flush(), pw.bim.Flush(), pw.bedFile.Close(), pw.bimFile.Close()} {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// packDosages encodes one variant's alt allele dosages as a .bed row
+// Each sample takes 2 bits, 4 samples to a byte, with the first sample in the lowest-order bits
+// Missing genotypes may have any ploidy, but called genotypes must be haploid or diploid
+// A haploid call is written as homozygous: hom ref for 0, hom alt for 1
+func packDosages(dosages []any, ploidy []uint8) ([]byte, error) {
+	row := make([]byte, (len(dosages)+3)/4)
+
+	for i, val := range dosages {
+		dosage, ok := val.(int8)
+		if !ok {
+			return nil, fmt.Errorf("type mismatch for sample %d, expected int8", i)
+		}
+
+		if dosage != -1 && ploidy[i] > 2 {
+			return nil, fmt.Errorf("%w: sample %d has ploidy %d", ErrNotDiploid, i, ploidy[i])
+		}
+
+		if ploidy[i] == 1 && dosage == 1 {
+			dosage = 2
+		}
+
+		var code byte
+		switch dosage {
+		case 0:
+			code = homA2
+		case 1:
+			code = het
+		case 2:
+			code = homA1
+		case -1:
+			code = missing
+		default:
+			return nil, fmt.Errorf("unsupported dosage %d for sample %d", dosage, i)
+		}
+
+		row[i/4] |= code << (2 * (i % 4))
+	}
+
+	return row, nil
+}
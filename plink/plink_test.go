@@ -0,0 +1,170 @@
+package plink
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPackDosages(t *testing.T) {
+	dosages := []any{int8(0), int8(1), int8(2), int8(-1), int8(2)}
+
+	row, err := packDosages(dosages, []uint8{2, 2, 2, 2, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sample 0 (hom ref) = 11, sample 1 (het) = 10, sample 2 (hom alt) = 00, sample 3 (missing) = 01
+	// packed from the lowest-order bits: 01 00 10 11
+	// sample 4 (hom alt) = 00, padded with 0 bits
+	expected := []byte{0x4b, 0x00}
+
+	if !bytes.Equal(row, expected) {
+		t.Errorf("NOT OK: Expected %08b, got %08b", expected, row)
+	}
+}
+
+func TestPackDosagesRejectsPolyploid(t *testing.T) {
+	if _, err := packDosages([]any{int8(3)}, []uint8{2}); err == nil {
+		t.Error("NOT OK: Expected error for dosage > 2")
+	}
+
+	if _, err := packDosages([]any{1}, []uint8{2}); err == nil {
+		t.Error("NOT OK: Expected error for non-int8 dosage")
+	}
+
+	// Triploid and tetraploid genotypes with 0 to 2 alt alleles don't fit the diploid codes either
+	for _, ploidy := range []uint8{3, 4} {
+		if _, err := packDosages([]any{int8(0), int8(1)}, []uint8{2, ploidy}); !errors.Is(err, ErrNotDiploid) {
+			t.Errorf("NOT OK: Expected ErrNotDiploid for ploidy %d, got %v", ploidy, err)
+		}
+	}
+
+	// Missing genotypes are written as missing, whatever their ploidy
+	if _, err := packDosages([]any{int8(-1), int8(1)}, []uint8{4, 2}); err != nil {
+		t.Errorf("NOT OK: Expected a missing tetraploid genotype to be written, got %v", err)
+	}
+}
+
+func TestPackDosagesHaploid(t *testing.T) {
+	// A haploid male's chrX calls, among diploid female calls
+	dosages := []any{int8(0), int8(1), int8(1), int8(-1)}
+
+	row, err := packDosages(dosages, []uint8{1, 1, 2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sample 0 (haploid ref) = 11, sample 1 (haploid alt) = 00, sample 2 (het) = 10, sample 3 (missing) = 01
+	// packed from the lowest-order bits: 01 10 00 11
+	expected := []byte{0x63}
+
+	if !bytes.Equal(row, expected) {
+		t.Errorf("NOT OK: Expected %08b, got %08b", expected, row)
+	}
+}
+
+func TestPlinkWriter(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "test")
+
+	famRecords := MakeFamRecords([]string{"S1", "S2", "S3"}, map[string]FamRecord{
+		"S2": {FamilyID: "F1", IndividualID: "S2", FatherID: "S1", MotherID: "0", Sex: "2", Phenotype: "1"},
+	})
+
+	writer, err := NewPlinkWriter(prefix, famRecords)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writer.WriteVariant("chr1", "1000", "chr1:1000:A:T", "A", "T", []any{int8(2), int8(1), int8(0)},
+		[]uint8{2, 2, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writer.WriteVariant("chr2", "200", "chr2:200:C:G", "C", "G", []any{int8(-1), int8(0), int8(2)},
+		[]uint8{1, 2, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.WriteVariant("chr2", "300", "chr2:300:C:G", "C", "G", []any{int8(0)}, []uint8{2}); err == nil {
+		t.Error("NOT OK: Expected error for mismatched sample count")
+	}
+
+	err = writer.WriteVariant("chr2", "400", "chr2:400:C:G", "C", "G", []any{int8(0), int8(2), int8(1)},
+		[]uint8{2, 2, 3})
+	if !errors.Is(err, ErrNotDiploid) {
+		t.Errorf("NOT OK: Expected ErrNotDiploid for a triploid genotype, got %v", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bed, err := os.ReadFile(prefix + ".bed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// magic number, then 1 byte per variant for 3 samples
+	expectedBed := []byte{0x6c, 0x1b, 0x01, 0x38, 0x0d}
+	if !bytes.Equal(bed, expectedBed) {
+		t.Errorf("NOT OK: Expected .bed %x, got %x", expectedBed, bed)
+	}
+
+	bim, err := os.ReadFile(prefix + ".bim")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedBim := "chr1\tchr1:1000:A:T\t0\t1000\tT\tA\nchr2\tchr2:200:C:G\t0\t200\tG\tC\n"
+	if string(bim) != expectedBim {
+		t.Errorf("NOT OK: Expected .bim %q, got %q", expectedBim, string(bim))
+	}
+
+	fam, err := os.ReadFile(prefix + ".fam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFam := []string{
+		"S1\tS1\t0\t0\t0\t-9",
+		"F1\tS2\tS1\t0\t2\t1",
+		"S3\tS3\t0\t0\t0\t-9",
+	}
+	if !reflect.DeepEqual(strings.Split(strings.TrimSpace(string(fam)), "\n"), expectedFam) {
+		t.Errorf("NOT OK: Expected .fam %v, got %q", expectedFam, string(fam))
+	}
+}
+
+func TestReadFamFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.fam")
+
+	err := os.WriteFile(path, []byte("F1 S1 0 0 1 -9\n\nF1\tS2\tS1\t0\t2\t2\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ReadFamFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 || records["S1"].Sex != "1" || records["S2"].FatherID != "S1" {
+		t.Errorf("NOT OK: Unexpected fam records %v", records)
+	}
+
+	err = os.WriteFile(path, []byte("F1 S1 0 0\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadFamFile(path); err == nil {
+		t.Error("NOT OK: Expected error for malformed fam file")
+	}
+}
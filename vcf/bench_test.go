@@ -0,0 +1,205 @@
+package vcf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func benchmarkReader(b *testing.B, inPath string) {
+	config := &Options{}
+
+	outFh, err := os.OpenFile("/dev/null", os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		panic(err)
+	}
+	writer := bufio.NewWriter(outFh)
+	// make sure it gets closed
+	defer outFh.Close()
+
+	info, err := os.Stat(inPath)
+	if err != nil {
+		panic(err)
+	}
+
+	b.SetBytes(info.Size())
+
+	for n := 0; n < b.N; n++ {
+		inFh, err := os.Open(inPath)
+		if err != nil {
+			panic(err)
+		}
+
+		reader := bufio.NewReader(inFh)
+
+		if err := ReadVcf(context.Background(), config, reader, writer); err != nil {
+			panic(err)
+		}
+
+		inFh.Close()
+	}
+
+	writer.Flush()
+	outFh.Close()
+}
+
+// writeWideVcf writes a VCF of numRows records of numSamples samples, like the 2,504 of the 1000 Genomes Project,
+// with FORMAT values after GT, and some multiallelic, polyploid and missing genotypes
+func writeWideVcf(b *testing.B, numSamples int, numRows int) string {
+	random := rand.New(rand.NewSource(1))
+
+	var vcf bytes.Buffer
+	vcf.WriteString("##fileformat=VCFv4.1\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT")
+	for i := 0; i < numSamples; i++ {
+		fmt.Fprintf(&vcf, "\tS%d", i)
+	}
+	vcf.WriteByte('\n')
+
+	genotypes := []string{"0|0", "0|0", "0|0", "0|0", "0|1", "1|0", "1|1", "./.", "0/1/1", "0|2"}
+
+	for row := 0; row < numRows; row++ {
+		alt := "T"
+		if row%4 == 0 {
+			alt = "T,G"
+		}
+
+		fmt.Fprintf(&vcf, "chr1\t%d\trs%d\tC\t%s\t100\tPASS\tAC=1\tGT:DP", 1000+row*10, row, alt)
+		for i := 0; i < numSamples; i++ {
+			fmt.Fprintf(&vcf, "\t%s:%d", genotypes[random.Intn(len(genotypes))], random.Intn(60))
+		}
+		vcf.WriteByte('\n')
+	}
+
+	path := filepath.Join(b.TempDir(), "wide.vcf")
+	if err := os.WriteFile(path, vcf.Bytes(), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	return path
+}
+
+func BenchmarkLazy(b *testing.B) { benchmarkReader(b, "../examples/test.query.vcf") }
+
+// BenchmarkWide is BenchmarkLazy for cohorts with thousands of samples, where the genotypes dominate
+func BenchmarkWide(b *testing.B) {
+	path := writeWideVcf(b, 2504, 200)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	benchmarkReader(b, path)
+}
+
+func BenchmarkSplitRecord(b *testing.B) {
+	path := writeWideVcf(b, 2504, 1)
+
+	vcf, err := os.ReadFile(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(vcf), []byte{'\n'})
+	row := lines[len(lines)-1]
+
+	b.Run("strings.Split", func(b *testing.B) {
+		b.SetBytes(int64(len(row)))
+		b.ReportAllocs()
+
+		for n := 0; n < b.N; n++ {
+			_ = strings.Split(string(row), "\t")
+		}
+	})
+
+	b.Run("splitRecord", func(b *testing.B) {
+		b.SetBytes(int64(len(row)))
+		b.ReportAllocs()
+
+		var fields []string
+		for n := 0; n < b.N; n++ {
+			fields = splitRecord(row, fields)
+		}
+	})
+}
+
+// BenchmarkMultiallelic summarizes a site of 30 alt alleles in 2,504 samples, parsing the genotypes once, as Decompose
+// does, or once per allele, as MakeHetHomozygotes does
+func BenchmarkMultiallelic(b *testing.B) {
+	random := rand.New(rand.NewSource(1))
+
+	header := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT"}
+	alts := make([]string, 30)
+	for i := range alts {
+		alts[i] = strings.Repeat("A", i+2)
+	}
+
+	record := []string{"chr1", "1000", ".", "A", strings.Join(alts, ","), "100", "PASS", ".", "GT:DP"}
+	for i := 0; i < 2504; i++ {
+		header = append(header, fmt.Sprintf("S%d", i))
+
+		if random.Intn(4) == 0 {
+			record = append(record, fmt.Sprintf("%d|%d:10", random.Intn(len(alts)+1), random.Intn(len(alts)+1)))
+		} else {
+			record = append(record, "0|0:10")
+		}
+	}
+
+	b.Run("Decompose", func(b *testing.B) {
+		decomposer := NewDecomposer(header, &Options{DosageMatrixOutPath: "dosages.feather"})
+		b.ReportAllocs()
+
+		for n := 0; n < b.N; n++ {
+			if _, err := decomposer.decompose(record, func(rejection) {}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("MakeHetHomozygotes", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for n := 0; n < b.N; n++ {
+			for i := range alts {
+				MakeHetHomozygotes(record, header, strconv.Itoa(i+1), true, true, false, false)
+			}
+		}
+	})
+}
+
+// BenchmarkFillWorkQueue measures the reader alone, which should keep up with the workers on fast storage
+func BenchmarkFillWorkQueue(b *testing.B) {
+	vcf, err := os.ReadFile(writeWideVcf(b, 2504, 200))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(vcf)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		queue := make(chan batch, 16)
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			for lines := range queue {
+				lines.release()
+			}
+		}()
+
+		err := fillWorkQueue(context.Background(), bufio.NewReader(bytes.NewReader(vcf)), '\n', 1, nil, queue)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		close(queue)
+		<-done
+	}
+}
@@ -0,0 +1,290 @@
+package vcf
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	bystroArrow "github.com/bystrogenomics/bystro-vcf/arrow"
+)
+
+// Checkpoint records how far a run got, so that it can be resumed
+// Every record before InputOffset has been written to the outputs, and nothing after it
+type Checkpoint struct {
+	// Bytes of records read, following the header
+	InputOffset int64 `json:"inputOffset"`
+	// The line number of the next record
+	Line int `json:"line"`
+	// Bytes written to the TSV output by ReadVcf, not counting anything written before it was called, such as the header
+	OutputBytes int64 `json:"outputBytes"`
+	// Record batches written to the dosage matrix
+	DosageBatches int `json:"dosageBatches"`
+}
+
+// ReadCheckpoint reads the checkpoint written to path, returning nil if there is none
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &Checkpoint{}
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("couldn't read checkpoint %s: %w", path, err)
+	}
+
+	return checkpoint, nil
+}
+
+// write replaces the checkpoint at path, so that it is never left half written
+func (c *Checkpoint) write(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// checkpointable returns an error if config asks for outputs that can't be resumed
+func checkpointable(config *Options) error {
+	if config.SparseDosagePrefix != "" || config.SampleMajorPrefix != "" || config.HaplotypeOutPath != "" ||
+		config.PlinkOutPrefix != "" || config.BgenOutPath != "" || config.RejectsPath != "" {
+		return errors.New("checkpoints only support the TSV output and the dosage matrix")
+	}
+
+	if config.DosageMatrixOutPath == dosageMatrixStdout {
+		return errors.New("checkpoints can't resume a dosage matrix written to stdout")
+	}
+
+	return nil
+}
+
+// orderedWriter writes the output of each batch in input order, and periodically records a checkpoint
+// Batches are committed by the processLines workers, which wait for the preceding batches to be committed first
+type orderedWriter struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// The sequence number of the next batch to commit
+	next      int
+	stopped   bool
+	watchOnce sync.Once
+
+	tsv            *bufio.Writer
+	dosages        *bystroArrow.ArrowWriter
+	dosageBuilder  *bystroArrow.ArrowRowBuilder
+	allocator      *bystroArrow.Allocator
+	checkpoint     Checkpoint
+	path           string
+	interval       time.Duration
+	lastCheckpoint time.Time
+}
+
+// newOrderedWriter creates an orderedWriter, continuing from checkpoint unless it is nil
+func newOrderedWriter(tsv *bufio.Writer, dosages *bystroArrow.ArrowWriter, allocator *bystroArrow.Allocator,
+	config *Options, firstLine int, checkpoint *Checkpoint) *orderedWriter {
+	w := &orderedWriter{
+		tsv:            tsv,
+		dosages:        dosages,
+		allocator:      allocator,
+		checkpoint:     Checkpoint{Line: firstLine},
+		path:           config.CheckpointPath,
+		interval:       config.CheckpointInterval,
+		lastCheckpoint: time.Now(),
+	}
+	w.cond = sync.NewCond(&w.mu)
+
+	if checkpoint != nil {
+		w.checkpoint = *checkpoint
+	}
+
+	return w
+}
+
+// watch stops waiting for turns once ctx is cancelled, as the batches waited for may never be committed
+// Every worker calls watch with the same ctx, which is only watched once
+func (w *orderedWriter) watch(ctx context.Context) {
+	w.watchOnce.Do(func() {
+		go func() {
+			<-ctx.Done()
+
+			w.mu.Lock()
+			w.stopped = true
+			w.mu.Unlock()
+
+			w.cond.Broadcast()
+		}()
+	})
+}
+
+// commit writes the TSV output and dosage rows of lines, once every preceding batch has been committed
+func (w *orderedWriter) commit(ctx context.Context, lines batch, tsvOutput []byte, dosageRows [][]any) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.next != lines.seq && !w.stopped {
+		w.cond.Wait()
+	}
+
+	if w.stopped {
+		return ctx.Err()
+	}
+
+	if w.tsv != nil && len(tsvOutput) > 0 {
+		if _, err := w.tsv.Write(tsvOutput); err != nil {
+			return err
+		}
+	}
+
+	if w.dosages != nil && len(dosageRows) > 0 {
+		if w.dosageBuilder == nil {
+			builder, err := bystroArrow.NewArrowRowBuilder(w.dosages, 5e3, bystroArrow.WithMaxChunkBytes(maxChunkBytes),
+				bystroArrow.WithAllocator(w.allocator))
+			if err != nil {
+				return err
+			}
+			w.dosageBuilder = builder
+		}
+
+		for _, row := range dosageRows {
+			if err := w.dosageBuilder.WriteRow(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	w.checkpoint.InputOffset += lines.numBytes
+	w.checkpoint.Line = lines.firstLine + lines.numRows
+	w.checkpoint.OutputBytes += int64(len(tsvOutput))
+
+	w.next++
+	w.cond.Broadcast()
+
+	if time.Since(w.lastCheckpoint) >= w.interval {
+		return w.writeCheckpoint()
+	}
+
+	return nil
+}
+
+// flush writes out the buffered dosage rows and TSV output
+func (w *orderedWriter) flush() error {
+	if w.dosageBuilder != nil {
+		if err := w.dosageBuilder.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if w.tsv != nil {
+		return w.tsv.Flush()
+	}
+
+	return nil
+}
+
+// writeCheckpoint flushes the outputs, so that they hold everything committed so far, and records the checkpoint
+func (w *orderedWriter) writeCheckpoint() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	if w.dosages != nil {
+		w.checkpoint.DosageBatches = w.dosages.NumRecordBatches()
+	}
+
+	w.lastCheckpoint = time.Now()
+
+	return w.checkpoint.write(w.path)
+}
+
+// finish flushes the outputs once every batch has been committed
+func (w *orderedWriter) finish() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	if w.dosageBuilder != nil {
+		return w.dosageBuilder.Release()
+	}
+
+	return nil
+}
+
+// resumeDosages copies the first numBatches record batches of the dosage matrix at path, written by an
+// interrupted run, to writer, which replaces it
+// The interrupted run's file is moved aside to path + ".partial" until it has been copied, so that it isn't lost
+// if resuming is itself interrupted
+func resumeDosages(path string, numBatches int, createWriter func() (*bystroArrow.ArrowWriter, error)) (*bystroArrow.ArrowWriter, error) {
+	partialPath := path + ".partial"
+
+	if _, err := os.Stat(partialPath); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(path, partialPath); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	writer, err := createWriter()
+	if err != nil {
+		return nil, err
+	}
+
+	partial, err := os.Open(partialPath)
+	if err != nil {
+		return nil, err
+	}
+	defer partial.Close()
+
+	info, err := partial.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// The file format is the stream format, preceded by 8 bytes of magic number and padding, and followed by a footer
+	// that an interrupted run won't have written
+	reader, err := ipc.NewReader(io.NewSectionReader(partial, 8, info.Size()-8))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the dosage matrix to resume: %w", err)
+	}
+	defer reader.Release()
+
+	if !reader.Schema().Equal(writer.Schema) {
+		return nil, errors.New("the dosage matrix to resume has a different schema")
+	}
+
+	for i := 0; i < numBatches; i++ {
+		if !reader.Next() {
+			if err := reader.Err(); err != nil {
+				return nil, fmt.Errorf("couldn't read the dosage matrix to resume: %w", err)
+			}
+
+			return nil, fmt.Errorf("the dosage matrix to resume has %d record batches, expected %d", i, numBatches)
+		}
+
+		if err := writer.WriteChunk(reader.Record()); err != nil {
+			return nil, err
+		}
+	}
+
+	partial.Close()
+
+	return writer, os.Remove(partialPath)
+}
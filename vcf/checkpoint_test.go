@@ -0,0 +1,181 @@
+package vcf
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	bystroArrow "github.com/bystrogenomics/bystro-vcf/arrow"
+)
+
+func checkpointTestVcf(numRecords int, malformedRecord int) string {
+	genotypes := []string{"0|0", "0|1", "1|0", "1|1", ".|."}
+
+	var vcf strings.Builder
+	vcf.WriteString("##fileformat=VCFv4.x\n")
+	vcf.WriteString(strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT",
+		"S1", "S2", "S3"}, "\t") + "\n")
+
+	for i := 0; i < numRecords; i++ {
+		record := []string{"1", strconv.Itoa(100 + i), "rs" + strconv.Itoa(i), "A", "T", ".", "PASS", ".", "GT",
+			genotypes[i%5], genotypes[(i+1)%5], genotypes[(i+3)%5]}
+
+		if i == malformedRecord {
+			record = record[:10]
+		}
+
+		vcf.WriteString(strings.Join(record, "\t") + "\n")
+	}
+
+	return vcf.String()
+}
+
+// readDosageRows reads every row of the dosage matrix at path, as strings
+func readDosageRows(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	reader, err := bystroArrow.NewArrowIPCFileReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var rows []string
+	for reader.Next() {
+		row, err := reader.Row()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows = append(rows, fmt.Sprint(row...))
+	}
+
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return rows
+}
+
+func runCheckpointed(t *testing.T, config Options, in string, outPath string) error {
+	outFh, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outFh.Close()
+
+	if _, err := outFh.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+
+	w := bufio.NewWriter(outFh)
+
+	err = ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(in)), w)
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func TestCheckpointResume(t *testing.T) {
+	dir := t.TempDir()
+
+	baseConfig := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: map[string]bool{"PASS": true},
+		Strict: true}
+
+	// An uninterrupted run, whose output is in input order
+	cleanConfig := baseConfig
+	cleanConfig.DosageMatrixOutPath = filepath.Join(dir, "clean.feather")
+	cleanConfig.CheckpointPath = filepath.Join(dir, "clean.checkpoint")
+
+	good := checkpointTestVcf(1000, -1)
+
+	if err := runCheckpointed(t, cleanConfig, good, filepath.Join(dir, "clean.tsv")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(cleanConfig.CheckpointPath); !errors.Is(err, os.ErrNotExist) {
+		t.Error("NOT OK: Expected the checkpoint to be removed once the run completes")
+	}
+
+	// A run that fails part way through
+	config := baseConfig
+	config.DosageMatrixOutPath = filepath.Join(dir, "resumed.feather")
+	config.CheckpointPath = filepath.Join(dir, "resumed.checkpoint")
+	outPath := filepath.Join(dir, "resumed.tsv")
+
+	err := runCheckpointed(t, config, checkpointTestVcf(1000, 700), outPath)
+	if !errors.Is(err, ErrMalformedRecord) {
+		t.Fatalf("NOT OK: Expected ErrMalformedRecord, got %v", err)
+	}
+
+	checkpoint, err := ReadCheckpoint(config.CheckpointPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if checkpoint == nil || checkpoint.Line > 703 {
+		t.Fatalf("NOT OK: Expected a checkpoint before the malformed record, got %+v", checkpoint)
+	}
+
+	// Resume, from the same input, fixed
+	if err := os.Truncate(outPath, checkpoint.OutputBytes); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Resume = true
+
+	if err := runCheckpointed(t, config, good, outPath); err != nil {
+		t.Fatal(err)
+	}
+
+	clean, err := os.ReadFile(filepath.Join(dir, "clean.tsv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(clean) != string(resumed) {
+		t.Error("NOT OK: Expected the resumed TSV output to match the uninterrupted one")
+	}
+
+	cleanRows := readDosageRows(t, cleanConfig.DosageMatrixOutPath)
+	resumedRows := readDosageRows(t, config.DosageMatrixOutPath)
+
+	if len(cleanRows) == 0 || fmt.Sprint(cleanRows) != fmt.Sprint(resumedRows) {
+		t.Errorf("NOT OK: Expected the resumed dosage matrix to match the uninterrupted one, got %d rows, expected %d",
+			len(resumedRows), len(cleanRows))
+	}
+
+	if _, err := os.Stat(config.DosageMatrixOutPath + ".partial"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("NOT OK: Expected the interrupted dosage matrix to be removed")
+	}
+}
+
+func TestCheckpointUnsupportedOutputs(t *testing.T) {
+	config := Options{EmptyField: "!", FieldDelimiter: ";", CheckpointPath: filepath.Join(t.TempDir(), "checkpoint"),
+		PlinkOutPrefix: filepath.Join(t.TempDir(), "plink")}
+
+	w := bufio.NewWriter(io.Discard)
+	err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(checkpointTestVcf(10, -1))), w)
+
+	if err == nil {
+		t.Error("NOT OK: Expected an error checkpointing PLINK output")
+	}
+}
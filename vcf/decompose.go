@@ -0,0 +1,300 @@
+package vcf
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Site is a single VCF record, decomposed into the alleles that passed validation
+type Site struct {
+	// The CHROM field, with a "chr" prefix added if absent
+	Chrom string
+	// The original VCF POS field
+	Pos  string
+	ID   string
+	Info string
+	// The site type: SNP, DEL, INS, MNP or MULTIALLELIC
+	Type string
+	// The tab-split VCF record, for access to fields like QUAL, FILTER and FORMAT
+	Record  []string
+	Alleles []Allele
+	// The number of alleles in each sample's genotype
+	// Only collected when Decomposer.Ploidy is set
+	Ploidy []uint8
+}
+
+// Allele is a single alt allele of a Site, normalized to bystro's representation, along with
+// the summary of its genotypes
+// Deletions have a negative Alt, giving the number of deleted bases, with Pos and Ref pointing at the first deleted base
+// Insertions have an Alt of "+" followed by the inserted bases, which occur after Pos and Ref
+type Allele struct {
+	// The site the allele was decomposed from
+	Site *Site
+
+	Pos string
+	Ref string
+	Alt string
+	// The 0-based index of the allele in the VCF ALT field; the bases of an MNP share the same index
+	Index int
+
+	// Only collected when Decomposer.Labels is set
+	Homozygotes   []string
+	Heterozygotes []string
+	Partials      []string
+	Missing       []string
+
+	// The count of the alt allele in each sample's genotype, -1 if missing
+	// Only collected when Decomposer.Dosages is set
+	Dosages []any
+	// The expected count of the alt allele in each sample, as float32, computed from Decomposer.DosageSource
+	// nil unless DosageSource is DS, GP, GL or PL
+	ExpectedDosages []any
+	// Only collected when Decomposer.Haplotypes is set
+	Haplotypes *Haplotypes
+	// Set for alleles that no sample's GT carries, which are only kept for their ExpectedDosages, and are left out
+	// of the TSV output, the statistics, and the genotype outputs
+	NoCarrier bool
+
+	// The number of alt alleles, and the number of called alleles, across all samples
+	AC int
+	AN int
+}
+
+// Locus returns the chrom:pos:ref:alt identifier of the allele
+func (a *Allele) Locus() string {
+	return fmt.Sprintf("%s:%s:%s:%s", a.Site.Chrom, a.Pos, a.Ref, a.Alt)
+}
+
+// VcfAlt returns the allele's ALT, as written in the VCF record, before normalization
+// The bases of an MNP share the same VcfAlt
+func (a *Allele) VcfAlt() string {
+	alts := a.Site.Record[altIdx]
+
+	for i := 0; i < a.Index; i++ {
+		next := strings.IndexByte(alts, ',')
+		if next == -1 {
+			return ""
+		}
+
+		alts = alts[next+1:]
+	}
+
+	if end := strings.IndexByte(alts, ','); end != -1 {
+		return alts[:end]
+	}
+
+	return alts
+}
+
+// VcfLocus returns the chrom:pos:ref:alt identifier of the allele, using the VCF record's POS, REF and ALT, as
+// other tools that read the VCF would
+func (a *Allele) VcfLocus() string {
+	return fmt.Sprintf("%s:%s:%s:%s", a.Site.Chrom, a.Site.Pos, a.Site.Record[refIdx], a.VcfAlt())
+}
+
+// Decomposer splits VCF records into their alleles, and summarizes their genotypes
+// The exported fields select which genotype summaries are collected; the rest are left empty
+// A Decomposer is safe for concurrent use, as long as its fields aren't modified
+type Decomposer struct {
+	header          []string
+	numSamples      int
+	allowedFilters  map[string]bool
+	excludedFilters map[string]bool
+	// Parsed genotypes, reused across records, as they only back a record's summaries while they are made
+	genotypes *sync.Pool
+
+	// Collect the homozygous, heterozygous and missing sample names of each allele
+	Labels bool
+	// Label polyploid samples carrying the allele on fewer than half of their haplotypes as partial, rather than heterozygous
+	LabelPartials bool
+	Dosages       bool
+	Haplotypes    bool
+	// Collect the ploidy of each sample's genotype, in Site.Ploidy
+	Ploidy bool
+	// The FORMAT field ExpectedDosages are computed from: DS, GP, GL or PL
+	// Empty, or GT, to skip them
+	DosageSource string
+	// Return an error for records whose number of fields doesn't match the header, rather than skipping them
+	Strict bool
+}
+
+// NewDecomposer creates a Decomposer for records following header, as returned by ReadHeader
+// The genotype summaries collected are those needed by the outputs config asks for
+func NewDecomposer(header []string, config *Options) *Decomposer {
+	if len(header) == sampleIdx {
+		log.Printf("Found 9 header fields. When genotypes present, we expect 1+ samples after FORMAT (10 fields minimum)")
+	}
+
+	d := &Decomposer{
+		header:          header,
+		allowedFilters:  config.AllowedFilters,
+		excludedFilters: config.ExcludedFilters,
+		genotypes:       &sync.Pool{New: func() any { return &siteGenotypes{} }},
+		Labels:          !config.NoOut,
+		LabelPartials:   config.LabelPartials,
+		Dosages: config.DosageMatrixOutPath != "" || config.SparseDosagePrefix != "" || config.SampleMajorPrefix != "" ||
+			config.PlinkOutPrefix != "",
+		Haplotypes: config.BgenOutPath != "" || config.HaplotypeOutPath != "",
+		Ploidy:     config.PlinkOutPrefix != "",
+		Strict:     config.Strict,
+	}
+
+	if len(header) > sampleIdx {
+		d.numSamples = len(header) - sampleIdx
+	}
+
+	if config.DosageMatrixOutPath != "" && expectsExpectedDosages(config) {
+		d.DosageSource = config.DosageSource
+	}
+
+	return d
+}
+
+// Decompose splits a tab-split VCF record into its alleles
+// It returns a nil Site if the record is empty, doesn't pass the FILTER criteria, or has no valid alleles
+// When samples are present, alleles that no sample carries are skipped, unless the dosage matrix is derived from
+// DS, GP, GL or PL, whose imputed dosages don't need a sample called with the allele: those are kept, as NoCarrier
+// Records missing any of the 8 fixed fields, or, when samples are present, whose number of fields doesn't match
+// the header, are rejected, or, if Strict is set, return an error wrapping ErrMalformedRecord
+// Rejected alleles are logged
+func (d *Decomposer) Decompose(record []string) (*Site, error) {
+	return d.decompose(record, logRejection)
+}
+
+// decompose is Decompose, calling reject with each rejected allele, or with the record if it is rejected as a whole
+func (d *Decomposer) decompose(record []string, reject func(rejection)) (*Site, error) {
+	if len(record) == 1 && record[0] == "" {
+		return nil, nil
+	}
+
+	if len(record) <= infoIdx || (d.numSamples > 0 && len(record) != len(d.header)) {
+		if d.Strict {
+			return nil, fmt.Errorf("%w: expected %d fields, found %d", ErrMalformedRecord, len(d.header), len(record))
+		}
+
+		reject(rejection{recordField(record, chromIdx), recordField(record, posIdx), recordField(record, refIdx),
+			recordField(record, altIdx), -1, reasonFieldsError})
+
+		return nil, nil
+	}
+
+	if !linePasses(record, d.header, d.allowedFilters, d.excludedFilters) {
+		// Sites-only records with a trailing FORMAT field are skipped, not filtered
+		if len(record) == len(d.header) {
+			reject(rejection{record[chromIdx], record[posIdx], record[refIdx], record[altIdx], -1, reasonFilterError})
+		}
+
+		return nil, nil
+	}
+
+	siteType, positions, refs, alts, altIndices := getAlleles(record[chromIdx], record[posIdx], record[refIdx], record[altIdx], reject)
+
+	if len(altIndices) == 0 {
+		return nil, nil
+	}
+
+	site := &Site{
+		Chrom:   normalizeChrom(record[chromIdx]),
+		Pos:     record[posIdx],
+		ID:      record[idIdx],
+		Info:    record[infoIdx],
+		Type:    siteType,
+		Record:  record,
+		Alleles: make([]Allele, 0, len(alts)),
+	}
+
+	needsExpectedDosages := d.numSamples > 0 && d.DosageSource != "" && d.DosageSource != dosageSourceGT
+
+	// Each sample's imputed values are parsed once, for every alt allele
+	var expectedDosages [][]any
+	if needsExpectedDosages {
+		expectedDosages = makeExpectedDosages(record, d.header, d.DosageSource,
+			formatKeyIndex(record[formatIdx], d.DosageSource), strings.Count(record[altIdx], ",")+2)
+	}
+
+	// Every allele is summarized from the same parsed genotypes, rather than scanning them for each allele
+	var genotypes *siteGenotypes
+	if d.numSamples > 0 {
+		genotypes = d.genotypes.Get().(*siteGenotypes)
+		defer d.genotypes.Put(genotypes)
+
+		genotypes.parse(record, d.numSamples, altIndices[len(altIndices)-1]+1)
+
+		if d.Ploidy {
+			site.Ploidy = genotypes.ploidy()
+		}
+	}
+
+	for i := range alts {
+		allele := Allele{
+			Site:  site,
+			Pos:   positions[i],
+			Ref:   string(refs[i]),
+			Alt:   alts[i],
+			Index: altIndices[i],
+		}
+
+		// If no samples are provided, annotate what we can, skipping hets and homs
+		// If samples are provided, but only missing genotypes, skip the allele altogether
+		if d.numSamples > 0 {
+			// Alleles that no sample carries are skipped before summarizing them, unless their imputed dosages are kept
+			if genotypes.alleleCount(altIndices[i]+1) == 0 {
+				reject(rejection{record[chromIdx], record[posIdx], record[refIdx], alts[i], altIndices[i], reasonNoCarrierNotice})
+
+				if !needsExpectedDosages {
+					continue
+				}
+
+				allele.NoCarrier = true
+			}
+
+			allele.Homozygotes, allele.Heterozygotes, allele.Partials, allele.Missing, allele.Dosages, allele.Haplotypes,
+				allele.AC, allele.AN = genotypes.summarize(altIndices[i]+1, d.header, d.Labels, d.Dosages, d.Haplotypes,
+				d.LabelPartials)
+
+			if needsExpectedDosages {
+				allele.ExpectedDosages = expectedDosages[altIndices[i]]
+			}
+		}
+
+		site.Alleles = append(site.Alleles, allele)
+	}
+
+	if len(site.Alleles) == 0 {
+		return nil, nil
+	}
+
+	return site, nil
+}
+
+// numCarried returns the number of the site's alleles that some sample carries, or that are kept for want of
+// samples, as opposed to those kept as NoCarrier
+func (s *Site) numCarried() int {
+	numCarried := 0
+	for i := range s.Alleles {
+		if !s.Alleles[i].NoCarrier {
+			numCarried++
+		}
+	}
+
+	return numCarried
+}
+
+// recordField returns the idx-th field of a tab-split record, or an empty string if it has fewer fields
+func recordField(record []string, idx int) string {
+	if idx >= len(record) {
+		return ""
+	}
+
+	return record[idx]
+}
+
+func normalizeChrom(chrom string) string {
+	if len(chrom) < 4 || chrom[0] != chrByte {
+		return "chr" + chrom
+	}
+
+	return chrom
+}
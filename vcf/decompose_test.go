@@ -0,0 +1,101 @@
+package vcf
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bystrogenomics/bystro-utils/parse"
+)
+
+func TestDecompose(t *testing.T) {
+	header := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3"}
+
+	decomposer := NewDecomposer(header, &Options{AllowedFilters: map[string]bool{"PASS": true}})
+	decomposer.Dosages = true
+
+	// The 3rd allele is invalid, and the 2nd isn't carried by any sample
+	record := []string{"1", "1000", "rs1", "C", "T,G,N", "100", "PASS", "AC=3", "GT", "0|1", "1|1", "0|0"}
+
+	site, err := decomposer.Decompose(record)
+
+	if err != nil || site == nil {
+		t.Fatal("NOT OK: Expected a site", err)
+	}
+
+	if site.Chrom != "chr1" || site.Pos != "1000" || site.ID != "rs1" || site.Info != "AC=3" || site.Type != parse.Multi {
+		t.Errorf("NOT OK: Unexpected site %v", site)
+	}
+
+	if len(site.Alleles) != 1 {
+		t.Fatalf("NOT OK: Expected 1 allele, got %d", len(site.Alleles))
+	}
+
+	allele := &site.Alleles[0]
+
+	if allele.Site != site || allele.Pos != "1000" || allele.Ref != "C" || allele.Alt != "T" || allele.Index != 0 {
+		t.Errorf("NOT OK: Unexpected allele %v", allele)
+	}
+
+	if !reflect.DeepEqual(allele.Heterozygotes, []string{"S1"}) || !reflect.DeepEqual(allele.Homozygotes, []string{"S2"}) {
+		t.Errorf("NOT OK: Unexpected hets %v, homs %v", allele.Heterozygotes, allele.Homozygotes)
+	}
+
+	if !reflect.DeepEqual(allele.Dosages, []any{int8(1), int8(2), int8(0)}) {
+		t.Errorf("NOT OK: Unexpected dosages %v", allele.Dosages)
+	}
+
+	if allele.AC != 3 || allele.AN != 6 {
+		t.Errorf("NOT OK: Expected AC 3 and AN 6, got %d and %d", allele.AC, allele.AN)
+	}
+
+	if allele.Haplotypes != nil || allele.ExpectedDosages != nil {
+		t.Error("NOT OK: Expected haplotypes and expected dosages to be skipped")
+	}
+
+	if locus := allele.Locus(); locus != "chr1:1000:C:T" {
+		t.Errorf("NOT OK: Expected locus chr1:1000:C:T, got %s", locus)
+	}
+
+	record[filterIdx] = "LowQual"
+	if site, err := decomposer.Decompose(record); site != nil || err != nil {
+		t.Error("NOT OK: Expected filtered record to be skipped", err)
+	}
+
+	record = []string{"1", "1000", "rs1", "C", "T", "100", "PASS", "AC=0", "GT", "0|0", "0|0", "./."}
+	if site, err := decomposer.Decompose(record); site != nil || err != nil {
+		t.Error("NOT OK: Expected record with no carriers to be skipped", err)
+	}
+
+	if site, err := decomposer.Decompose([]string{""}); site != nil || err != nil {
+		t.Error("NOT OK: Expected empty record to be skipped", err)
+	}
+
+	record = []string{"1", "1000", "rs1", "C", "T", "100", "PASS", "AC=0", "GT", "0|1"}
+	if site, err := decomposer.Decompose(record); site != nil || err != nil {
+		t.Error("NOT OK: Expected truncated record to be skipped", err)
+	}
+
+	decomposer.Strict = true
+	if _, err := decomposer.Decompose(record); !errors.Is(err, ErrMalformedRecord) {
+		t.Error("NOT OK: Expected ErrMalformedRecord for truncated record, got", err)
+	}
+}
+
+func TestDecomposeDeletionWithoutSamples(t *testing.T) {
+	header := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO"}
+
+	decomposer := NewDecomposer(header, &Options{})
+
+	site, err := decomposer.Decompose([]string{"chrX", "100", ".", "ACGT", "A", "100", "PASS", "."})
+
+	if err != nil || site == nil || len(site.Alleles) != 1 {
+		t.Fatal("NOT OK: Expected a single allele", err)
+	}
+
+	allele := site.Alleles[0]
+
+	if site.Type != parse.Del || allele.Pos != "101" || allele.Ref != "C" || allele.Alt != "-3" || allele.AC != 0 {
+		t.Errorf("NOT OK: Unexpected deletion %v", allele)
+	}
+}
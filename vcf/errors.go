@@ -0,0 +1,30 @@
+package vcf
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotVCF is returned when the input doesn't start with a ##fileformat=VCFv4 line
+	ErrNotVCF = errors.New("not a VCF file")
+	// ErrNoHeader is returned when the input ends before the #CHROM header line
+	ErrNoHeader = errors.New("no #CHROM header line found")
+	// ErrMalformedRecord is returned, wrapped in a RecordError, for records that can't be parsed when
+	// Options.Strict is set, e.g. because their number of fields doesn't match the header
+	ErrMalformedRecord = errors.New("malformed record")
+)
+
+// RecordError is an error processing the record found at Line (1-based) of the input
+type RecordError struct {
+	Line int
+	Err  error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,124 @@
+package vcf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestReadVcfNotVcf(t *testing.T) {
+	config := Options{EmptyField: "!", FieldDelimiter: ";"}
+
+	for _, in := range []string{"", "chrom\tpos\n", "##fileformat=BCFv2\n#CHROM\n"} {
+		w := bufio.NewWriter(new(bytes.Buffer))
+		err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(in)), w)
+
+		if !errors.Is(err, ErrNotVCF) {
+			t.Errorf("NOT OK: Expected ErrNotVCF for %q, got %v", in, err)
+		}
+	}
+}
+
+func TestReadVcfNoHeader(t *testing.T) {
+	config := Options{EmptyField: "!", FieldDelimiter: ";"}
+
+	in := "##fileformat=VCFv4.x\n##INFO=<ID=DP>\n"
+	w := bufio.NewWriter(new(bytes.Buffer))
+	err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(in)), w)
+
+	if !errors.Is(err, ErrNoHeader) {
+		t.Errorf("NOT OK: Expected ErrNoHeader, got %v", err)
+	}
+}
+
+// test that a malformed record is reported with its line number, and that no partial outputs are left behind
+func TestReadVcfMalformedRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2"}, "\t")
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T", ".", "PASS", ".", "GT", "0|1", "0|0"}, "\t")
+	row2 := strings.Join([]string{"1", "1001", "rs2", "A", "T", ".", "PASS", ".", "GT", "0|1"}, "\t")
+
+	lines := versionLine + "\n##INFO=<ID=DP>\n" + header + "\n" + row1 + "\n" + row2 + "\n"
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: map[string]bool{"PASS": true}, Strict: true,
+		DosageMatrixOutPath: filepath.Join(dir, "dosages.feather"),
+		SparseDosagePrefix:  filepath.Join(dir, "sparse"),
+		SampleMajorPrefix:   filepath.Join(dir, "sample_major"),
+		HaplotypeOutPath:    filepath.Join(dir, "haplotypes.feather"),
+		PlinkOutPrefix:      filepath.Join(dir, "plink"),
+		BgenOutPath:         filepath.Join(dir, "out.bgen"),
+		SampleListPath:      filepath.Join(dir, "samples.txt"),
+	}
+
+	w := bufio.NewWriter(new(bytes.Buffer))
+	err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(lines)), w)
+
+	if !errors.Is(err, ErrMalformedRecord) {
+		t.Fatalf("NOT OK: Expected ErrMalformedRecord, got %v", err)
+	}
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) || recordErr.Line != 5 {
+		t.Errorf("NOT OK: Expected a RecordError at line 5, got %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		t.Errorf("NOT OK: Expected outputs to be removed, found %s", entry.Name())
+	}
+}
+
+// test that, unless Strict is set, a malformed record is rejected, and the rest of the input processed
+func TestReadVcfRejectsMalformedRecord(t *testing.T) {
+	rejectsPath := filepath.Join(t.TempDir(), "rejects.tsv")
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2"}, "\t")
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T", ".", "PASS", ".", "GT", "0|1", "0|0"}, "\t")
+	row2 := strings.Join([]string{"1", "1001", "rs2", "A", "T", ".", "PASS", ".", "GT", "0|1"}, "\t")
+	row3 := strings.Join([]string{"1", "1002", "rs3"}, "\t")
+	row4 := strings.Join([]string{"1", "1003", "rs4", "C", "G", ".", "PASS", ".", "GT", "1|1", "0|1"}, "\t")
+
+	lines := versionLine + "\n" + header + "\n" + strings.Join([]string{row1, row2, row3, row4}, "\n") + "\n"
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: map[string]bool{"PASS": true},
+		RejectsPath: rejectsPath}
+
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+
+	if err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(lines)), w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	if numRows := strings.Count(out.String(), "\n"); numRows != 2 {
+		t.Errorf("NOT OK: Expected the 2 well formed records to be written, got %q", out.String())
+	}
+
+	report, err := os.ReadFile(rejectsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rejected := strings.Split(strings.TrimSuffix(string(report), "\n"), "\n")[1:]
+	sort.Strings(rejected)
+
+	expected := []string{"1\t1001\tA\tT\t!\t4\tfieldsError", "1\t1002\t\t\t!\t5\tfieldsError"}
+	if !reflect.DeepEqual(rejected, expected) {
+		t.Errorf("NOT OK: Expected rejects %q, got %q", expected, rejected)
+	}
+}
@@ -0,0 +1,263 @@
+package vcf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FORMAT fields that the dosage matrix can be derived from
+const (
+	dosageSourceGT string = "GT"
+	dosageSourceDS string = "DS"
+	dosageSourceGP string = "GP"
+	dosageSourceGL string = "GL"
+	dosageSourcePL string = "PL"
+)
+
+// The largest ploidy considered when inferring ploidy from the number of GP, GL or PL values
+const maxInferredPloidy = 8
+
+// Dosage written for samples whose FORMAT value is missing or unparseable, matching the GT dosage matrix
+const missingExpectedDosage = float32(-1)
+
+// ValidDosageSource returns true if source is a FORMAT field the dosage matrix can be derived from
+func ValidDosageSource(source string) bool {
+	switch source {
+	case dosageSourceGT, dosageSourceDS, dosageSourceGP, dosageSourceGL, dosageSourcePL:
+		return true
+	default:
+		return false
+	}
+}
+
+// formatKeyIndex returns the index of key in the colon-separated FORMAT field, or -1 if absent
+func formatKeyIndex(format string, key string) int {
+	for i, formatKey := range strings.Split(format, ":") {
+		if formatKey == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// makeExpectedDosages computes, for each of the numAlleles-1 alt alleles, the expected alt allele count of each
+// sample from the source FORMAT field (DS, GP, GL or PL), found at keyIdx of each sample's colon-separated values
+// The i-th dosages are those of the allele i+1. Each sample's value is parsed once, for every allele
+// Multiallelic sites are marginalized: the expected count of an allele sums over every genotype
+// that contains it, weighted by that genotype's probability
+// Samples with missing or malformed values get a dosage of -1
+func makeExpectedDosages(fields []string, header []string, source string, keyIdx int, numAlleles int) [][]any {
+	dosages := make([][]any, numAlleles-1)
+	counts := make([]*genotypeCounts, numAlleles-1)
+	for i := range dosages {
+		dosages[i] = make([]any, 0, len(header)-sampleIdx)
+		counts[i] = newGenotypeCounts(i+1, numAlleles)
+	}
+
+	var values []float64
+	for i := sampleIdx; i < len(header); i++ {
+		var value string
+		ok := keyIdx >= 0
+		if ok {
+			value, ok = nthValue(fields[i], ':', keyIdx)
+		}
+
+		if ok && value != "." && value != "" {
+			var err error
+			values, err = parseDosageValues(value, source, values)
+			ok = err == nil
+		} else {
+			ok = false
+		}
+
+		for j := range dosages {
+			if !ok {
+				dosages[j] = append(dosages[j], missingExpectedDosage)
+				continue
+			}
+
+			dosage, err := expectedDosage(values, source, counts[j])
+			if err != nil {
+				dosages[j] = append(dosages[j], missingExpectedDosage)
+				continue
+			}
+
+			dosages[j] = append(dosages[j], dosage)
+		}
+	}
+
+	return dosages
+}
+
+// genotypeCounts holds, for one allele of a site, the number of copies of the allele in each genotype of every
+// ploidy seen at the site, keyed by the number of GP, GL or PL values of that ploidy, so that the ploidy is
+// inferred and the genotypes enumerated once per site and allele, rather than for each sample
+type genotypeCounts struct {
+	alleleNum  int
+	numAlleles int
+	// nil for numbers of values that correspond to no ploidy
+	byNumValues map[int][]int
+}
+
+func newGenotypeCounts(alleleNum int, numAlleles int) *genotypeCounts {
+	return &genotypeCounts{alleleNum: alleleNum, numAlleles: numAlleles, byNumValues: make(map[int][]int, 1)}
+}
+
+// get returns the number of copies of the allele in each genotype of the ploidy that has numValues genotypes,
+// or nil if there is no such ploidy
+func (c *genotypeCounts) get(numValues int) []int {
+	counts, ok := c.byNumValues[numValues]
+	if !ok {
+		if ploidy := inferPloidy(numValues, c.numAlleles); ploidy > 0 {
+			counts = genotypeAlleleCounts(c.numAlleles, ploidy, c.alleleNum)
+		}
+
+		c.byNumValues[numValues] = counts
+	}
+
+	return counts
+}
+
+// parseDosageValues parses a single sample's comma separated DS, GP, GL or PL value, appending to values[:0]
+// DS values are the expected counts of each alt allele, and GP, GL and PL values are converted to the unnormalized
+// probability of each genotype. Values that aren't numbers are NaN, so that only the alleles that need them fail
+func parseDosageValues(value string, source string, values []float64) ([]float64, error) {
+	values = values[:0]
+
+	for {
+		val := value
+		end := strings.IndexByte(value, ',')
+		if end != -1 {
+			val, value = value[:end], value[end+1:]
+		}
+
+		parsed, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			parsed = math.NaN()
+		}
+
+		switch source {
+		case dosageSourceDS, dosageSourceGP:
+		case dosageSourceGL:
+			parsed = math.Pow(10, parsed)
+		case dosageSourcePL:
+			parsed = math.Pow(10, -parsed/10)
+		default:
+			return nil, fmt.Errorf("unsupported dosage source: %s", source)
+		}
+
+		values = append(values, parsed)
+
+		if end == -1 {
+			return values, nil
+		}
+	}
+}
+
+// expectedDosage computes the expected count of the counts' allele from a single sample's values, as parsed by
+// parseDosageValues
+func expectedDosage(values []float64, source string, counts *genotypeCounts) (float32, error) {
+	if source == dosageSourceDS {
+		// DS is Number=A: one expected count per alt allele
+		if counts.alleleNum > len(values) {
+			return 0, fmt.Errorf("expected %d DS values, found %d", counts.numAlleles-1, len(values))
+		}
+
+		dosage := values[counts.alleleNum-1]
+		if math.IsNaN(dosage) {
+			return 0, errors.New("DS value isn't a number")
+		}
+
+		return float32(dosage), nil
+	}
+
+	alleleCounts := counts.get(len(values))
+	if alleleCounts == nil {
+		return 0, fmt.Errorf("%d %s values don't correspond to any ploidy for %d alleles", len(values), source,
+			counts.numAlleles)
+	}
+
+	var total float64
+	var dosage float64
+	for i, probability := range values {
+		if math.IsNaN(probability) {
+			return 0, fmt.Errorf("%s value isn't a number", source)
+		}
+
+		total += probability
+		dosage += probability * float64(alleleCounts[i])
+	}
+
+	if total == 0 {
+		return 0, fmt.Errorf("%s values sum to 0", source)
+	}
+
+	// GL and PL are likelihoods, and GP may not sum to exactly 1 due to rounding
+	return float32(dosage / total), nil
+}
+
+// inferPloidy returns the ploidy whose number of genotypes, for numAlleles alleles, is numValues,
+// or 0 if there is none
+func inferPloidy(numValues int, numAlleles int) int {
+	for ploidy := 1; ploidy <= maxInferredPloidy; ploidy++ {
+		if binomial(numAlleles+ploidy-1, ploidy) == numValues {
+			return ploidy
+		}
+	}
+
+	return 0
+}
+
+// genotypeAlleleCounts returns the number of copies of alleleNum in every genotype of the given ploidy,
+// in the VCF genotype ordering, where the genotype a1 <= a2 <= ... <= aP has the index
+// sum over m of binomial(a_m + m - 1, m)
+// See section 1.6.2 of the VCFv4.3 specification
+func genotypeAlleleCounts(numAlleles int, ploidy int, alleleNum int) []int {
+	counts := make([]int, binomial(numAlleles+ploidy-1, ploidy))
+
+	genotype := make([]int, ploidy)
+
+	var enumerate func(m int, minAllele int)
+	enumerate = func(m int, minAllele int) {
+		if m == ploidy {
+			index := 0
+			count := 0
+			for i, allele := range genotype {
+				index += binomial(allele+i, i+1)
+
+				if allele == alleleNum {
+					count++
+				}
+			}
+
+			counts[index] = count
+			return
+		}
+
+		for allele := minAllele; allele < numAlleles; allele++ {
+			genotype[m] = allele
+			enumerate(m+1, allele)
+		}
+	}
+
+	enumerate(0, 0)
+
+	return counts
+}
+
+func binomial(n int, k int) int {
+	if k < 0 || k > n {
+		return 0
+	}
+
+	result := 1
+	for i := 1; i <= k; i++ {
+		result = result * (n - k + i) / i
+	}
+
+	return result
+}
@@ -0,0 +1,254 @@
+package vcf
+
+import "math"
+
+// Allele indices of haplotypes whose allele is missing ("."), or isn't an allele index, and so matches no alt allele
+const (
+	missingAlleleIndex = -1
+	otherAlleleIndex   = -2
+)
+
+// siteGenotypes is the genotype of each sample of a record, parsed once into allele indices, so that each alt
+// allele of a multiallelic site is summarized without scanning the samples' genotype fields again
+type siteGenotypes struct {
+	// The allele index of each haplotype, in sample order: 0 for the reference, 1 for the first alt, and so on,
+	// or missingAlleleIndex or otherAlleleIndex
+	alleles []int32
+	// The haplotypes of the i-th sample are alleles[offsets[i]:offsets[i+1]]
+	offsets []int
+	phased  []bool
+	// Samples with a missing allele are missing as a whole, and left out of the allele counts
+	missing []bool
+	// The number of haplotypes carrying each alt allele, indexed by allele index, and of called haplotypes
+	alleleCounts []int
+	an           int
+}
+
+// parse parses the genotypes of the numSamples samples of a tab-split record, reusing g's slices
+// Allele counts are kept for the alt alleles up to numAlts
+// Records whose FORMAT has no GT, which must come first when present, e.g. imputed DS:GP records, have every
+// sample's genotype missing
+func (g *siteGenotypes) parse(record []string, numSamples int, numAlts int) {
+	g.alleles = g.alleles[:0]
+	g.offsets = append(g.offsets[:0], 0)
+	g.phased = g.phased[:0]
+	g.missing = g.missing[:0]
+	g.alleleCounts = append(g.alleleCounts[:0], make([]int, numAlts+1)...)
+	g.an = 0
+
+	hasGT := hasGenotypeField(record[formatIdx])
+
+	for i := sampleIdx; i < sampleIdx+numSamples; i++ {
+		sampleGenotypeField := record[i]
+		start := len(g.alleles)
+
+		if !hasGT {
+			g.alleles = append(g.alleles, missingAlleleIndex, missingAlleleIndex)
+			g.phased = append(g.phased, false)
+			g.offsets = append(g.offsets, len(g.alleles))
+			g.missing = append(g.missing, true)
+			continue
+		}
+
+		// Speed up the common case of diploid genotypes of single character alleles, e.g. 0|0, 0/1, 1|.
+		// or those genotypes with other information, e.g. 0|0:DP:AD:GQ:PL
+		// Genotypes with a missing allele are read this way whatever the other allele is
+		if (len(sampleGenotypeField) == 3 || (len(sampleGenotypeField) > 3 && sampleGenotypeField[3] == ':')) &&
+			(sampleGenotypeField[1] == '|' || sampleGenotypeField[1] == '/') &&
+			((isDigit(sampleGenotypeField[0]) && isDigit(sampleGenotypeField[2])) ||
+				sampleGenotypeField[0] == '.' || sampleGenotypeField[2] == '.') {
+			g.alleles = append(g.alleles, alleleIndex(sampleGenotypeField[0:1]), alleleIndex(sampleGenotypeField[2:3]))
+			g.phased = append(g.phased, sampleGenotypeField[1] == '|')
+		} else {
+			alleles := newAlleleIterator(sampleGenotypeField)
+			for allele, ok := alleles.next(); ok; allele, ok = alleles.next() {
+				g.alleles = append(g.alleles, alleleIndex(allele))
+			}
+
+			g.phased = append(g.phased, alleles.phased())
+		}
+
+		g.offsets = append(g.offsets, len(g.alleles))
+
+		// N|., .|N, .|., N/., ./N, ./. are all considered missing samples, because if one site is missing, the other is likely unreliable
+		missing := false
+		for _, allele := range g.alleles[start:] {
+			if allele == missingAlleleIndex {
+				missing = true
+				break
+			}
+		}
+
+		g.missing = append(g.missing, missing)
+
+		if missing {
+			continue
+		}
+
+		g.an += len(g.alleles) - start
+
+		for _, allele := range g.alleles[start:] {
+			if allele > 0 && int(allele) <= numAlts {
+				g.alleleCounts[allele]++
+			}
+		}
+	}
+}
+
+// hasGenotypeField returns true if the colon-separated FORMAT field starts with GT
+func hasGenotypeField(format string) bool {
+	return len(format) >= 2 && format[:2] == "GT" && (len(format) == 2 || format[2] == ':')
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// alleleIndex parses a single GT allele, e.g. 0, 1 or 12
+// Only the canonical form of a number is an allele index, so that 01 doesn't match the first alt allele
+func alleleIndex(allele string) int32 {
+	if allele == "." {
+		return missingAlleleIndex
+	}
+
+	if len(allele) == 0 || len(allele) > 9 || (len(allele) > 1 && allele[0] == '0') {
+		return otherAlleleIndex
+	}
+
+	var index int32
+	for i := 0; i < len(allele); i++ {
+		if allele[i] < '0' || allele[i] > '9' {
+			return otherAlleleIndex
+		}
+
+		index = index*10 + int32(allele[i]-'0')
+	}
+
+	return index
+}
+
+// alleleCount returns the number of haplotypes carrying the alleleNum allele (1 based), across samples that aren't
+// missing, or 0 if it is past the alt alleles counted
+func (g *siteGenotypes) alleleCount(alleleNum int) int {
+	if alleleNum < 1 || alleleNum >= len(g.alleleCounts) {
+		return 0
+	}
+
+	return g.alleleCounts[alleleNum]
+}
+
+// ploidy returns the number of alleles in each sample's genotype, in sample order
+func (g *siteGenotypes) ploidy() []uint8 {
+	ploidy := make([]uint8, len(g.phased))
+	for i := range ploidy {
+		numAlleles := g.offsets[i+1] - g.offsets[i]
+		if numAlleles > math.MaxUint8 {
+			numAlleles = math.MaxUint8
+		}
+
+		ploidy[i] = uint8(numAlleles)
+	}
+
+	return ploidy
+}
+
+// summarize returns the summary of the alleleNum allele (1 based), as MakeHetHomozygotes does
+func (g *siteGenotypes) summarize(alleleNum int, header []string, needsLabels bool, needsDosages bool, needsHaplotypes bool,
+	labelPartials bool) ([]string, []string, []string, []string, []any, *Haplotypes, int, int) {
+	var homs []string
+	var hets []string
+	var partials []string
+	var missing []string
+	var dosages []any
+	var haplotypes *Haplotypes
+
+	numSamples := len(g.phased)
+
+	if needsHaplotypes {
+		haplotypes = newHaplotypes(numSamples)
+	}
+
+	if needsDosages {
+		dosages = make([]any, 0, numSamples)
+	}
+
+	// Nothing else depends on the samples
+	if !needsLabels && !needsDosages && !needsHaplotypes {
+		return homs, hets, partials, missing, dosages, haplotypes, g.alleleCount(alleleNum), g.an
+	}
+
+	alleleIdx := int32(alleleNum)
+	if alleleNum < 1 || alleleNum > math.MaxInt32 {
+		// No haplotype carries an allele that isn't an alt
+		alleleIdx = math.MaxInt32
+	}
+
+	for i := 0; i < numSamples; i++ {
+		alleles := g.alleles[g.offsets[i]:g.offsets[i+1]]
+
+		// Unlike dosages, haplotypes keep the called alleles of a partially missing genotype
+		if needsHaplotypes {
+			for _, allele := range alleles {
+				haplotypes.Alleles = append(haplotypes.Alleles, haplotypeCall(allele, alleleIdx))
+			}
+
+			haplotypes.Ploidy = append(haplotypes.Ploidy, uint8(len(alleles)))
+			haplotypes.Phased = append(haplotypes.Phased, g.phased[i])
+		}
+
+		if g.missing[i] {
+			if needsLabels {
+				missing = append(missing, header[sampleIdx+i])
+			}
+
+			if needsDosages {
+				dosages = append(dosages, int8(-1))
+			}
+
+			continue
+		}
+
+		altCount := 0
+		for _, allele := range alleles {
+			if allele == alleleIdx {
+				altCount++
+			}
+		}
+
+		if needsDosages {
+			if altCount <= 127 {
+				dosages = append(dosages, int8(altCount))
+			} else {
+				dosages = append(dosages, int8(127))
+			}
+		}
+
+		if altCount == 0 || !needsLabels {
+			continue
+		}
+
+		// Partial samples carry the allele on fewer than half of their haplotypes, which only polyploids can
+		if altCount == len(alleles) {
+			homs = append(homs, header[sampleIdx+i])
+		} else if labelPartials && 2*altCount < len(alleles) {
+			partials = append(partials, header[sampleIdx+i])
+		} else {
+			hets = append(hets, header[sampleIdx+i])
+		}
+	}
+
+	return homs, hets, partials, missing, dosages, haplotypes, g.alleleCount(alleleNum), g.an
+}
+
+// haplotypeCall converts a single GT allele index to a haplotype call for the alleleIdx allele
+func haplotypeCall(allele int32, alleleIdx int32) int8 {
+	if allele == missingAlleleIndex {
+		return -1
+	}
+
+	if allele == alleleIdx {
+		return 1
+	}
+
+	return 0
+}
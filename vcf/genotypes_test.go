@@ -0,0 +1,98 @@
+package vcf
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestSiteGenotypes(t *testing.T) {
+	header := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3", "S4", "S5",
+		"S6", "S7", "S8"}
+	record := []string{"10", "1000", "rs#", "C", "T,G,A", "100", "PASS", "AC=1", "GT:DP", "0|1:3", "2/3", "3|3", "./|:7",
+		"1/2/3/3", "01|1", "12", "0|0"}
+
+	var genotypes siteGenotypes
+	genotypes.parse(record, 8, 3)
+
+	expectedAlleles := []int32{0, 1, 2, 3, 3, 3, missingAlleleIndex, otherAlleleIndex, 1, 2, 3, 3, otherAlleleIndex, 1, 12, 0, 0}
+	if !reflect.DeepEqual(genotypes.alleles, expectedAlleles) {
+		t.Errorf("NOT OK: Expected alleles %v, got %v", expectedAlleles, genotypes.alleles)
+	}
+
+	expectedPhased := []bool{true, false, true, false, false, true, true, true}
+	if !reflect.DeepEqual(genotypes.phased, expectedPhased) {
+		t.Errorf("NOT OK: Expected phase %v, got %v", expectedPhased, genotypes.phased)
+	}
+
+	if !reflect.DeepEqual(genotypes.alleleCounts, []int{0, 3, 2, 5}) || genotypes.an != 15 {
+		t.Errorf("NOT OK: Expected allele counts [0 3 2 5] and an of 15, got %v and %d", genotypes.alleleCounts, genotypes.an)
+	}
+
+	homs, hets, partials, missing, dosages, _, ac, an := genotypes.summarize(3, header, true, true, false, true)
+
+	// S5, 1/2/3/3, carries the 3rd allele on half of its haplotypes
+	if !reflect.DeepEqual(homs, []string{"S3"}) || !reflect.DeepEqual(hets, []string{"S2", "S5"}) ||
+		len(partials) != 0 || !reflect.DeepEqual(missing, []string{"S4"}) || ac != 5 || an != 15 {
+		t.Error("NOT OK: Unexpected summary of the 3rd allele", homs, hets, partials, missing, ac, an)
+	}
+
+	expectedDosages := []any{int8(0), int8(1), int8(2), int8(-1), int8(2), int8(0), int8(0), int8(0)}
+	if !reflect.DeepEqual(dosages, expectedDosages) {
+		t.Errorf("NOT OK: Expected dosages %v, got %v", expectedDosages, dosages)
+	}
+
+	if genotypes.alleleCount(4) != 0 || genotypes.alleleCount(0) != 0 {
+		t.Error("NOT OK: Expected no count for alleles that aren't alt alleles")
+	}
+}
+
+// Records without GT, e.g. imputed DS:GP records, have every sample missing, rather than reading DS as GT
+func TestSiteGenotypesWithoutGT(t *testing.T) {
+	record := []string{"10", "1000", "rs#", "C", "T", "100", "PASS", "AC=1", "DS:GP", "1:0,0,1", "0:1,0,0"}
+
+	var genotypes siteGenotypes
+	genotypes.parse(record, 2, 1)
+
+	if !reflect.DeepEqual(genotypes.missing, []bool{true, true}) || genotypes.alleleCount(1) != 0 || genotypes.an != 0 {
+		t.Errorf("NOT OK: Expected every sample missing, got %v, with an of %d", genotypes.missing, genotypes.an)
+	}
+
+	for format, expected := range map[string]bool{"GT": true, "GT:DS": true, "GTX": false, "DS:GT": false, "G": false} {
+		if hasGenotypeField(format) != expected {
+			t.Errorf("NOT OK: Expected hasGenotypeField(%s) to be %t", format, expected)
+		}
+	}
+}
+
+// Summarizing each allele of the parsed genotypes should match parsing them again for each allele
+func TestSiteGenotypesMatchesMakeHetHomozygotes(t *testing.T) {
+	header := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3", "S4", "S5",
+		"S6", "S7", "S8", "S9", "S10"}
+	record := []string{"10", "1000", "rs#", "C", "T,G,A,CC,GG,TT,AA,CA,CT,CG,GA", "100", "PASS", "AC=1", "GT", "0|11", "11|11",
+		"10/1", "1|.", "2", "0/0/11/3", "./.", "4|5", "11/10/11", "1|0"}
+
+	var genotypes siteGenotypes
+	genotypes.parse(record, len(header)-sampleIdx, 11)
+
+	for alleleNum := 1; alleleNum <= 11; alleleNum++ {
+		homs, hets, partials, missing, dosages, haplotypes, ac, an := genotypes.summarize(alleleNum, header, true, true, true, true)
+		eHoms, eHets, ePartials, eMissing, eDosages, eHaplotypes, eAC, eAN := MakeHetHomozygotes(record, header,
+			strconv.Itoa(alleleNum), true, true, true, true)
+
+		if !reflect.DeepEqual(homs, eHoms) || !reflect.DeepEqual(hets, eHets) || !reflect.DeepEqual(partials, ePartials) ||
+			!reflect.DeepEqual(missing, eMissing) || !reflect.DeepEqual(dosages, eDosages) ||
+			!reflect.DeepEqual(haplotypes, eHaplotypes) || ac != eAC || an != eAN {
+			t.Errorf("NOT OK: Summary of allele %d differs from MakeHetHomozygotes", alleleNum)
+		}
+
+		if ac != genotypes.alleleCount(alleleNum) {
+			t.Errorf("NOT OK: Expected ac %d of allele %d to match its count %d", ac, alleleNum, genotypes.alleleCount(alleleNum))
+		}
+	}
+
+	if _, hets, _, _, _, _, ac, _ := genotypes.summarize(11, header, true, false, false, false); ac != 6 ||
+		!reflect.DeepEqual(hets, []string{"S1", "S6", "S9"}) {
+		t.Error("NOT OK: Expected S1, S6 and S9 to be heterozygous for the 11th allele, with an ac of 6", hets, ac)
+	}
+}
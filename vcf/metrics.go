@@ -0,0 +1,171 @@
+package vcf
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics collects counters and gauges across runs, and serves them in the Prometheus text format
+// Set Options.Metrics to collect a run's metrics
+type Metrics struct {
+	recordsRead    atomic.Int64
+	allelesEmitted atomic.Int64
+	workerBusy     atomic.Int64
+
+	mu           sync.Mutex
+	rejects      map[string]int64
+	bytesWritten map[string]*atomic.Int64
+	queue        <-chan batch
+}
+
+// NewMetrics creates an empty Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		rejects:      make(map[string]int64),
+		bytesWritten: make(map[string]*atomic.Int64),
+	}
+}
+
+func (m *Metrics) addBatch(numRecords int, numAlleles int, busy time.Duration) {
+	m.recordsRead.Add(int64(numRecords))
+	m.allelesEmitted.Add(int64(numAlleles))
+	m.workerBusy.Add(int64(busy))
+}
+
+func (m *Metrics) addRejection(reason rejectReason) {
+	m.mu.Lock()
+	m.rejects[string(reason)]++
+	m.mu.Unlock()
+}
+
+// setQueue sets the work queue whose depth is reported, or clears it if nil
+func (m *Metrics) setQueue(queue <-chan batch) {
+	m.mu.Lock()
+	m.queue = queue
+	m.mu.Unlock()
+}
+
+// output returns the bytes written counter of output, e.g. "tsv"
+func (m *Metrics) output(output string) *atomic.Int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter, ok := m.bytesWritten[output]
+	if !ok {
+		counter = &atomic.Int64{}
+		m.bytesWritten[output] = counter
+	}
+
+	return counter
+}
+
+// countingWriteSeeker counts the bytes written through it
+type countingWriteSeeker struct {
+	io.WriteSeeker
+	counter *atomic.Int64
+}
+
+func (w *countingWriteSeeker) Write(p []byte) (int, error) {
+	n, err := w.WriteSeeker.Write(p)
+	w.counter.Add(int64(n))
+	return n, err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	io.Writer
+	counter *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.counter.Add(int64(n))
+	return n, err
+}
+
+// countStreamWrites is countWrites, for writers that can't seek
+func (m *Metrics) countStreamWrites(output string, w io.Writer) io.Writer {
+	if m == nil {
+		return w
+	}
+
+	return &countingWriter{Writer: w, counter: m.output(output)}
+}
+
+// countWrites returns w, counting the bytes written to it as written to output
+// If m is nil, w is returned as is
+func (m *Metrics) countWrites(output string, w io.WriteSeeker) io.WriteSeeker {
+	if m == nil {
+		return w
+	}
+
+	return &countingWriteSeeker{WriteSeeker: w, counter: m.output(output)}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	writeMetric(w, "bystro_vcf_records_read_total", "counter", "VCF records read", m.recordsRead.Load())
+	writeMetric(w, "bystro_vcf_alleles_emitted_total", "counter", "Decomposed alleles written",
+		m.allelesEmitted.Load())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeHeader(w, "bystro_vcf_rejects_total", "counter", "Rejected alleles and records, by reason")
+	for _, reason := range sortedKeys(m.rejects) {
+		writeSample(w, "bystro_vcf_rejects_total", fmt.Sprintf(`reason="%s"`, reason), m.rejects[reason])
+	}
+
+	writeMetric(w, "bystro_vcf_worker_busy_seconds_total", "counter", "Time spent by the workers processing records",
+		time.Duration(m.workerBusy.Load()).Seconds())
+
+	var queueDepth, queueCapacity int
+	if m.queue != nil {
+		queueDepth, queueCapacity = len(m.queue), cap(m.queue)
+	}
+
+	writeMetric(w, "bystro_vcf_queue_depth", "gauge", "Batches of records read, waiting for a worker", queueDepth)
+	writeMetric(w, "bystro_vcf_queue_capacity", "gauge", "The capacity of the work queue", queueCapacity)
+
+	writeHeader(w, "bystro_vcf_bytes_written_total", "counter", "Bytes written, by output")
+	for _, output := range sortedKeys(m.bytesWritten) {
+		writeSample(w, "bystro_vcf_bytes_written_total", fmt.Sprintf(`output="%s"`, output),
+			m.bytesWritten[output].Load())
+	}
+}
+
+func writeHeader(w io.Writer, name string, metricType string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func writeSample(w io.Writer, name string, labels string, value any) {
+	if labels != "" {
+		fmt.Fprintf(w, "%s{%s} %v\n", name, labels, value)
+		return
+	}
+
+	fmt.Fprintf(w, "%s %v\n", name, value)
+}
+
+func writeMetric(w io.Writer, name string, metricType string, help string, value any) {
+	writeHeader(w, name, metricType, help)
+	writeSample(w, name, "", value)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,79 @@
+package vcf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "dosages.feather")
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2"}, "\t")
+	records := []string{
+		strings.Join([]string{"1", "100", "rs1", "C", "T,G", ".", "PASS", ".", "GT", "0|1", "0|2"}, "\t"),
+		strings.Join([]string{"1", "200", "rs2", "A", "G", ".", "LowQual", ".", "GT", "0|1", "0|0"}, "\t"),
+		strings.Join([]string{"1", "300", "rs3", "A", "N", ".", "PASS", ".", "GT", "0|1", "0|0"}, "\t"),
+	}
+
+	lines := versionLine + "\n" + header + "\n" + strings.Join(records, "\n") + "\n"
+
+	metrics := NewMetrics()
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: map[string]bool{"PASS": true},
+		DosageMatrixOutPath: filePath, Metrics: metrics}
+
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	if err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(lines)), w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	server := httptest.NewServer(metrics)
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"# TYPE bystro_vcf_records_read_total counter\nbystro_vcf_records_read_total 3\n",
+		"bystro_vcf_alleles_emitted_total 2\n",
+		"bystro_vcf_rejects_total{reason=\"badAltError\"} 1\n",
+		"bystro_vcf_rejects_total{reason=\"filterError\"} 1\n",
+		"# TYPE bystro_vcf_queue_depth gauge\nbystro_vcf_queue_depth 0\n",
+		"bystro_vcf_bytes_written_total{output=\"dosages\"} " + strconv.FormatInt(info.Size(), 10) + "\n",
+		"bystro_vcf_bytes_written_total{output=\"tsv\"} " + strconv.Itoa(byteBuf.Len()) + "\n",
+	}
+
+	for _, sample := range expected {
+		if !strings.Contains(string(body), sample) {
+			t.Errorf("NOT OK: Expected %q in metrics:\n%s", sample, body)
+		}
+	}
+
+	if strings.Contains(string(body), "worker_busy_seconds_total 0\n") {
+		t.Errorf("NOT OK: Expected worker busy time")
+	}
+}
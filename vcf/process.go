@@ -0,0 +1,94 @@
+package vcf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// Process decomposes every record read from reader, calling fn with each allele and its genotype summary:
+// sample labels, dosages, haplotypes and allele counts, along with expected dosages when config.DosageSource
+// is DS, GP, GL or PL
+// Only the FILTER, LabelPartials, DosageSource, Strict and Concurrency settings of config are used; nothing is written
+// Records are decomposed concurrently, and alleles may arrive out of input order, although the alleles of a site
+// arrive together, and in order. fn is never called concurrently, so it needs no locking of its own
+// Processing stops at the first error returned by fn, or encountered while reading, or when ctx is cancelled,
+// and that error is returned. Malformed records are logged and skipped, or, if config.Strict is set, returned as a
+// *RecordError wrapping ErrMalformedRecord
+func Process(ctx context.Context, reader io.Reader, config *Options, fn func(*Allele) error) error {
+	bufReader, ok := reader.(*bufio.Reader)
+	if !ok {
+		bufReader = bufio.NewReaderSize(reader, 48*1024*1024)
+	}
+
+	header, _, endOfLineByte, numChars, numHeaderLines, err := readHeader(bufReader)
+
+	if err != nil {
+		return err
+	}
+
+	decomposer := NewDecomposer(header, config)
+	decomposer.Labels = true
+	decomposer.Dosages = true
+	decomposer.Haplotypes = true
+	decomposer.Ploidy = true
+	decomposer.DosageSource = config.DosageSource
+
+	var fnMutex sync.Mutex
+
+	work := func(ctx context.Context, queue <-chan batch) error {
+		var rows [][]byte
+
+		for lines := range queue {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			rows = lines.splitRows(rows)
+
+			for rowIdx, row := range rows {
+				// fn may keep the alleles' fields, so they are split from a copy of the row, rather than the block
+				site, err := decomposer.Decompose(splitRecord(bytes.Clone(row[:len(row)-numChars]),
+					make([]string, 0, len(header))))
+
+				if err != nil {
+					return &RecordError{Line: lines.firstLine + rowIdx, Err: err}
+				}
+
+				if site == nil {
+					continue
+				}
+
+				if err := callForAlleles(ctx, &fnMutex, site, fn); err != nil {
+					return err
+				}
+			}
+
+			lines.release()
+		}
+
+		return nil
+	}
+
+	return runWorkers(ctx, bufReader, endOfLineByte, numHeaderLines+1, numWorkers(config), nil, work)
+}
+
+func callForAlleles(ctx context.Context, fnMutex *sync.Mutex, site *Site, fn func(*Allele) error) error {
+	fnMutex.Lock()
+	defer fnMutex.Unlock()
+
+	// Another thread's fn may have failed while we waited
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for i := range site.Alleles {
+		if err := fn(&site.Alleles[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package vcf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestProcess(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO",
+		"FORMAT", "Sample1", "Sample2", "Sample3"}, "\t")
+	records := []string{
+		strings.Join([]string{"1", "100", "rs1", "C", "T,G", ".", "PASS", ".", "GT:DS", "0|1:1,0", "2|2:0,2", ".|.:.,."}, "\t"),
+		strings.Join([]string{"1", "200", "rs2", "A", "G", ".", "LowQual", ".", "GT:DS", "0|1:1", "0|0:0", "0|0:0"}, "\t"),
+		strings.Join([]string{"2", "300", "rs3", "ACG", "A", ".", ".", ".", "GT:DS", "1/1:2", "0/1:1", "0/0:0"}, "\t"),
+	}
+
+	in := strings.NewReader(versionLine + "\n" + header + "\n" + strings.Join(records, "\n") + "\n")
+
+	config := Options{AllowedFilters: map[string]bool{"PASS": true, ".": true}, DosageSource: dosageSourceDS}
+
+	var loci []string
+	alleles := make(map[string]*Allele)
+
+	err := Process(context.Background(), in, &config, func(allele *Allele) error {
+		loci = append(loci, allele.Locus())
+		alleles[allele.Locus()] = allele
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(loci)
+
+	expectedLoci := []string{"chr1:100:C:G", "chr1:100:C:T", "chr2:301:C:-2"}
+	if fmt.Sprint(loci) != fmt.Sprint(expectedLoci) {
+		t.Fatalf("NOT OK: Expected alleles %v, got %v", expectedLoci, loci)
+	}
+
+	snp := alleles["chr1:100:C:G"]
+	if fmt.Sprint(snp.Homozygotes) != "[Sample2]" || fmt.Sprint(snp.Missing) != "[Sample3]" || snp.AC != 2 || snp.AN != 4 {
+		t.Errorf("NOT OK: Unexpected genotype summary %v %v %d %d", snp.Homozygotes, snp.Missing, snp.AC, snp.AN)
+	}
+
+	if fmt.Sprint(snp.Dosages) != "[0 2 -1]" || fmt.Sprint(snp.ExpectedDosages) != "[0 2 -1]" {
+		t.Errorf("NOT OK: Unexpected dosages %v, expected dosages %v", snp.Dosages, snp.ExpectedDosages)
+	}
+
+	if snp.Haplotypes == nil || !snp.Haplotypes.AllPhased() {
+		t.Error("NOT OK: Expected phased haplotypes")
+	}
+
+	del := alleles["chr2:301:C:-2"]
+	if del.Site.Type != "DEL" || del.Site.ID != "rs3" || fmt.Sprint(del.Heterozygotes) != "[Sample2]" || del.AC != 3 {
+		t.Errorf("NOT OK: Unexpected deletion %v", del)
+	}
+}
+
+func TestProcessMatchesReadVcf(t *testing.T) {
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: map[string]bool{"PASS": true, ".": true}}
+
+	inFh, err := os.Open("../examples/test.query.vcf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inFh.Close()
+
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+
+	if err := ReadVcf(context.Background(), &config, bufio.NewReader(inFh), w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	if _, err := inFh.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	numAlleles := 0
+	err = Process(context.Background(), inFh, &config, func(allele *Allele) error {
+		numAlleles++
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if numRows := strings.Count(out.String(), "\n"); numAlleles != numRows || numRows == 0 {
+		t.Errorf("NOT OK: Expected %d alleles, as in the TSV output, got %d", numRows, numAlleles)
+	}
+}
+
+func TestProcessPropagatesCallbackError(t *testing.T) {
+	inFh, err := os.Open("../examples/test.query.vcf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inFh.Close()
+
+	stop := errors.New("stop")
+
+	numCalls := 0
+	err = Process(context.Background(), inFh, &Options{}, func(allele *Allele) error {
+		numCalls++
+		return stop
+	})
+
+	if !errors.Is(err, stop) {
+		t.Errorf("NOT OK: Expected the callback's error, got %v", err)
+	}
+
+	if numCalls != 1 {
+		t.Errorf("NOT OK: Expected processing to stop after the callback's error, called %d times", numCalls)
+	}
+}
+
+func TestProcessCancelled(t *testing.T) {
+	inFh, err := os.Open("../examples/test.query.vcf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inFh.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err = Process(ctx, inFh, &Options{}, func(allele *Allele) error {
+		cancel()
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("NOT OK: Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestProcessNotVcf(t *testing.T) {
+	err := Process(context.Background(), strings.NewReader("chrom\tpos\n"), &Options{}, func(allele *Allele) error {
+		return nil
+	})
+
+	if err == nil {
+		t.Error("NOT OK: Expected an error for non-VCF input")
+	}
+}
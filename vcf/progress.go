@@ -0,0 +1,160 @@
+package vcf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressReport is a snapshot of a run's progress, written as a JSON line when Options.ProgressJSON is set
+type progressReport struct {
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+	BytesRead      int64   `json:"bytesRead"`
+	// Only known when Options.InputSize is set
+	Percent          float64 `json:"percent,omitempty"`
+	Records          int64   `json:"records"`
+	RecordsPerSecond float64 `json:"recordsPerSecond"`
+	Chrom            string  `json:"chrom"`
+	Pos              string  `json:"pos"`
+	QueueDepth       int     `json:"queueDepth"`
+	QueueCapacity    int     `json:"queueCapacity"`
+	Done             bool    `json:"done,omitempty"`
+}
+
+// progressTracker reports how far the reader has got through the input, every interval
+// The counters are updated by fillWorkQueue, so the position is that of the last record read,
+// which is ahead of the records being processed by up to the queue depth
+type progressTracker struct {
+	out       io.Writer
+	interval  time.Duration
+	json      bool
+	inputSize int64
+
+	bytesRead atomic.Int64
+	records   atomic.Int64
+
+	mu    sync.Mutex
+	chrom string
+	pos   string
+
+	start       time.Time
+	lastTime    time.Time
+	lastRecords int64
+}
+
+func newProgressTracker(out io.Writer, config *Options) *progressTracker {
+	return &progressTracker{out: out, interval: config.ProgressInterval, json: config.ProgressJSON,
+		inputSize: config.InputSize}
+}
+
+// add records a batch of rows read
+func (p *progressTracker) add(lines *batch) {
+	p.bytesRead.Add(lines.numBytes)
+	p.records.Add(int64(lines.numRows))
+
+	if lines.numRows == 0 {
+		return
+	}
+
+	// The last row starts after the line ending of the one before it
+	last := lines.data[bytes.LastIndexByte(lines.data[:len(lines.data)-1], lines.endOfLineByte)+1:]
+
+	chromEnd := bytes.IndexByte(last, '\t')
+	if chromEnd < 0 {
+		return
+	}
+
+	posEnd := bytes.IndexByte(last[chromEnd+1:], '\t')
+	if posEnd < 0 {
+		return
+	}
+
+	p.mu.Lock()
+	p.chrom = string(last[:chromEnd])
+	p.pos = string(last[chromEnd+1 : chromEnd+1+posEnd])
+	p.mu.Unlock()
+}
+
+// run reports progress every interval until stop is closed, then writes a final report
+func (p *progressTracker) run(queue chan batch, stop <-chan struct{}) {
+	p.start = time.Now()
+	p.lastTime = p.start
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.report(queue, false)
+		case <-stop:
+			p.report(queue, true)
+			return
+		}
+	}
+}
+
+func (p *progressTracker) snapshot(queue chan batch, done bool) progressReport {
+	now := time.Now()
+	records := p.records.Load()
+
+	report := progressReport{
+		ElapsedSeconds: now.Sub(p.start).Seconds(),
+		BytesRead:      p.bytesRead.Load(),
+		Records:        records,
+		QueueDepth:     len(queue),
+		QueueCapacity:  cap(queue),
+		Done:           done,
+	}
+
+	if p.inputSize > 0 {
+		report.Percent = 100 * float64(report.BytesRead) / float64(p.inputSize)
+	}
+
+	// The rate since the last report
+	if seconds := now.Sub(p.lastTime).Seconds(); seconds > 0 {
+		report.RecordsPerSecond = float64(records-p.lastRecords) / seconds
+	}
+
+	p.lastTime = now
+	p.lastRecords = records
+
+	p.mu.Lock()
+	report.Chrom = p.chrom
+	report.Pos = p.pos
+	p.mu.Unlock()
+
+	return report
+}
+
+func (p *progressTracker) report(queue chan batch, done bool) {
+	report := p.snapshot(queue, done)
+
+	if p.json {
+		data, err := json.Marshal(report)
+		if err != nil {
+			return
+		}
+
+		p.out.Write(append(data, '\n'))
+		return
+	}
+
+	percent := ""
+	if p.inputSize > 0 {
+		percent = fmt.Sprintf(" (%.1f%%)", report.Percent)
+	}
+
+	status := "progress"
+	if done {
+		status = "done"
+	}
+
+	fmt.Fprintf(p.out, "%s: %.1fs elapsed, %.1fMB read%s, %d records (%.0f/s), at %s:%s, queue %d/%d\n",
+		status, report.ElapsedSeconds, float64(report.BytesRead)/1e6, percent, report.Records, report.RecordsPerSecond,
+		report.Chrom, report.Pos, report.QueueDepth, report.QueueCapacity)
+}
@@ -0,0 +1,65 @@
+package vcf
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressReport(t *testing.T) {
+	var out bytes.Buffer
+
+	progress := newProgressTracker(&out, &Options{ProgressInterval: time.Hour, ProgressJSON: true, InputSize: 100})
+
+	queue := make(chan batch, 4)
+	queue <- batch{}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		progress.run(queue, stop)
+	}()
+
+	progress.add(&batch{data: []byte("chr1\t100\t.\tA\tT\nchr2\t2000\t.\tA\tT\n"), endOfLineByte: '\n', numRows: 2,
+		numBytes: 32})
+	progress.add(&batch{data: []byte("chr3\t30000\t.\tA\tT\n"), endOfLineByte: '\n', numRows: 1, numBytes: 16})
+
+	close(stop)
+	<-stopped
+
+	var report progressReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := progressReport{BytesRead: 48, Percent: 48, Records: 3, Chrom: "chr3", Pos: "30000", QueueDepth: 1,
+		QueueCapacity: 4, Done: true}
+
+	report.ElapsedSeconds = 0
+	report.RecordsPerSecond = 0
+
+	if report != expected {
+		t.Errorf("NOT OK: Expected %+v, got %+v", expected, report)
+	}
+}
+
+func TestProgressReportText(t *testing.T) {
+	var out bytes.Buffer
+
+	progress := newProgressTracker(&out, &Options{ProgressInterval: time.Millisecond})
+
+	progress.add(&batch{data: []byte("chr1\t100\t.\tA\tT\n"), endOfLineByte: '\n', numRows: 1, numBytes: 15})
+
+	progress.start = time.Now()
+	progress.lastTime = progress.start
+	progress.report(make(chan batch, 16), false)
+
+	report := out.String()
+	if !strings.HasPrefix(report, "progress: ") || !strings.Contains(report, "1 records") ||
+		!strings.Contains(report, "at chr1:100, queue 0/16") || strings.Contains(report, "%") {
+		t.Errorf("NOT OK: Unexpected progress report %q", report)
+	}
+}
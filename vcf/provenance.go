@@ -0,0 +1,84 @@
+package vcf
+
+import (
+	"hash"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Keys of the schema metadata written to the dosage and haplotype matrices, describing how they were produced
+const (
+	// The bystro-vcf version
+	MetadataVersion = "bystro.version"
+	// The command line that bystro-vcf was run with
+	MetadataCommandLine = "bystro.commandLine"
+	// The input file name, empty for stdin
+	MetadataInput = "bystro.input"
+	// The hex SHA-256 checksum of the input file, empty if it wasn't computed
+	MetadataInputSHA256 = "bystro.inputSha256"
+	// The VCF's ## meta-information lines, separated by newlines
+	MetadataVCFHeader = "bystro.vcfHeader"
+	// The comma separated FILTER values that were allowed, or "*" if all were
+	MetadataAllowedFilters = "bystro.allowedFilters"
+	// The comma separated FILTER values that were excluded
+	MetadataExcludedFilters = "bystro.excludedFilters"
+	// How the matrix values encode genotypes
+	MetadataEncoding = "bystro.encoding"
+	// The number of samples
+	MetadataNumSamples = "bystro.numSamples"
+)
+
+// Provenance describes the run, for the schema metadata of the Arrow outputs
+// It is set by the caller of ReadVcf, which knows the command line and input
+type Provenance struct {
+	Version     string
+	CommandLine string
+	Input       string
+	InputSHA256 string
+	// If not nil, a SHA-256 hash that the caller writes the input to as ReadVcf reads it, e.g. through an
+	// io.TeeReader, so that the input isn't read an extra time. InputSHA256 is set from it once the input has been
+	// read, and added to the metadata in the Arrow file formats' footers, which is where their schema is read from
+	InputHash hash.Hash
+}
+
+// Encodings of the matrix values, for MetadataEncoding
+const (
+	dosageEncoding         = "alt allele count, -1 = missing"
+	expectedDosageEncoding = "expected alt allele dosage from the %s FORMAT field, -1 = missing"
+	haplotypeEncoding      = "1 = alt allele, 0 = other allele, -1 = missing, null = no such haplotype"
+)
+
+// outputMetadata returns the schema metadata of an Arrow output of numSamples samples, whose values are encoded
+// as encoding
+func outputMetadata(config *Options, metaLines []string, numSamples int, encoding string) map[string]string {
+	allowedFilters := "*"
+	if len(config.AllowedFilters) > 0 {
+		allowedFilters = strings.Join(sortedFilters(config.AllowedFilters), ",")
+	}
+
+	return map[string]string{
+		MetadataVersion:         config.Provenance.Version,
+		MetadataCommandLine:     config.Provenance.CommandLine,
+		MetadataInput:           config.Provenance.Input,
+		MetadataInputSHA256:     config.Provenance.InputSHA256,
+		MetadataVCFHeader:       strings.Join(metaLines, "\n"),
+		MetadataAllowedFilters:  allowedFilters,
+		MetadataExcludedFilters: strings.Join(sortedFilters(config.ExcludedFilters), ","),
+		MetadataEncoding:        encoding,
+		MetadataNumSamples:      strconv.Itoa(numSamples),
+	}
+}
+
+func sortedFilters(filters map[string]bool) []string {
+	var values []string
+	for value, ok := range filters {
+		if ok {
+			values = append(values, value)
+		}
+	}
+
+	sort.Strings(values)
+
+	return values
+}
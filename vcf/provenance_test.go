@@ -0,0 +1,232 @@
+package vcf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bystroArrow "github.com/bystrogenomics/bystro-vcf/arrow"
+)
+
+func TestOutputMetadata(t *testing.T) {
+	dir := t.TempDir()
+
+	metaLines := []string{"##fileformat=VCFv4.x", "##contig=<ID=1,length=249250621>"}
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2"}, "\t")
+	record := strings.Join([]string{"1", "100", "rs1", "A", "T", ".", "PASS", ".", "GT", "0|1", "1|1"}, "\t")
+
+	lines := strings.Join(metaLines, "\n") + "\n" + header + "\n" + record + "\n"
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", NoOut: true,
+		AllowedFilters:      map[string]bool{"PASS": true, ".": true},
+		ExcludedFilters:     map[string]bool{"LowQual": true},
+		DosageMatrixOutPath: filepath.Join(dir, "dosages.feather"),
+		HaplotypeOutPath:    filepath.Join(dir, "haplotypes.feather"),
+		Provenance: Provenance{Version: "v1.2.3", CommandLine: "bystro-vcf --in in.vcf", Input: "in.vcf",
+			InputSHA256: "abc123"},
+	}
+
+	if err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(lines)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		MetadataVersion:         "v1.2.3",
+		MetadataCommandLine:     "bystro-vcf --in in.vcf",
+		MetadataInput:           "in.vcf",
+		MetadataInputSHA256:     "abc123",
+		MetadataVCFHeader:       strings.Join(metaLines, "\n"),
+		MetadataAllowedFilters:  ".,PASS",
+		MetadataExcludedFilters: "LowQual",
+		MetadataNumSamples:      "2",
+	}
+
+	for path, encoding := range map[string]string{config.DosageMatrixOutPath: dosageEncoding,
+		config.HaplotypeOutPath: haplotypeEncoding} {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		reader, err := bystroArrow.NewArrowIPCFileReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+
+		metadata := reader.Metadata()
+
+		for key, value := range expected {
+			if metadata[key] != value {
+				t.Errorf("NOT OK: %s: expected %s to be %q, got %q", filepath.Base(path), key, value, metadata[key])
+			}
+		}
+
+		if metadata[MetadataEncoding] != encoding {
+			t.Errorf("NOT OK: %s: expected encoding %q, got %q", filepath.Base(path), encoding, metadata[MetadataEncoding])
+		}
+	}
+}
+
+// The input's checksum, computed as it is read, is added to the matrices' footers once the input is read
+func TestOutputMetadataInputHash(t *testing.T) {
+	dir := t.TempDir()
+
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2"}, "\t")
+	record := strings.Join([]string{"1", "100", "rs1", "A", "T", ".", "PASS", ".", "GT", "0|1", "1|1"}, "\t")
+
+	lines := "##fileformat=VCFv4.x\n" + header + "\n" + record + "\n"
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", NoOut: true,
+		DosageMatrixOutPath: filepath.Join(dir, "dosages.feather"),
+		HaplotypeOutPath:    filepath.Join(dir, "haplotypes.feather"),
+		Provenance:          Provenance{InputHash: sha256.New()},
+	}
+
+	reader := bufio.NewReader(io.TeeReader(strings.NewReader(lines), config.Provenance.InputHash))
+	if err := ReadVcf(context.Background(), &config, reader, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	checksum := sha256.Sum256([]byte(lines))
+	expected := hex.EncodeToString(checksum[:])
+
+	if config.Provenance.InputSHA256 != expected {
+		t.Errorf("NOT OK: Expected InputSHA256 %s, got %s", expected, config.Provenance.InputSHA256)
+	}
+
+	for _, path := range []string{config.DosageMatrixOutPath, config.HaplotypeOutPath} {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		reader, err := bystroArrow.NewArrowIPCFileReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+
+		if checksum := reader.Metadata()[MetadataInputSHA256]; checksum != expected {
+			t.Errorf("NOT OK: %s: expected %s to be %s, got %q", filepath.Base(path), MetadataInputSHA256, expected, checksum)
+		}
+	}
+}
+
+// The shards closed before the input was read lack its checksum, which the manifest records instead
+func TestOutputMetadataInputHashSplit(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", SplitBy: SplitByChrom, NoOut: true,
+		DosageMatrixOutPath: filepath.Join(dir, "{chrom}.feather"), ManifestPath: filepath.Join(dir, "manifest.json"),
+		Provenance: Provenance{InputHash: sha256.New()}}
+
+	vcf := manyContigsVcf(2*maxOpenShards, 2*batchRows)
+
+	reader := bufio.NewReader(io.TeeReader(strings.NewReader(vcf), config.Provenance.InputHash))
+	if err := ReadVcf(context.Background(), &config, reader, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	checksum := sha256.Sum256([]byte(vcf))
+	expected := hex.EncodeToString(checksum[:])
+
+	manifest, err := ReadManifest(config.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.InputSHA256 != expected {
+		t.Errorf("NOT OK: Expected the manifest's inputSha256 to be %s, got %q", expected, manifest.InputSHA256)
+	}
+
+	numMissing := 0
+	for _, shard := range manifest.Shards {
+		file, err := os.Open(shard.DosagePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		reader, err := bystroArrow.NewArrowIPCFileReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+
+		switch reader.Metadata()[MetadataInputSHA256] {
+		case expected:
+		case "":
+			numMissing++
+		default:
+			t.Errorf("NOT OK: %s: unexpected %s %q", filepath.Base(shard.DosagePath), MetadataInputSHA256,
+				reader.Metadata()[MetadataInputSHA256])
+		}
+	}
+
+	if numMissing == 0 || numMissing == len(manifest.Shards) {
+		t.Errorf("NOT OK: Expected only the shards closed during the run to lack %s, %d of %d do", MetadataInputSHA256,
+			numMissing, len(manifest.Shards))
+	}
+
+	if !strings.Contains(logs.String(), "they lack "+MetadataInputSHA256+", which the manifest has") {
+		t.Errorf("NOT OK: Expected a warning for the shards lacking %s, got %q", MetadataInputSHA256, logs.String())
+	}
+}
+
+// The dosage matrix streamed to stdout can't be given the input's checksum once it has rows
+func TestOutputMetadataInputHashStream(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+
+	realStdout := os.Stdout
+	os.Stdout = stdout
+	defer func() { os.Stdout = realStdout }()
+
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2"}, "\t")
+	record := strings.Join([]string{"1", "100", "rs1", "A", "T", ".", "PASS", ".", "GT", "0|1", "1|1"}, "\t")
+
+	lines := "##fileformat=VCFv4.x\n" + header + "\n" + record + "\n"
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", NoOut: true, DosageMatrixOutPath: "-",
+		Provenance: Provenance{InputHash: sha256.New()}}
+
+	reader := bufio.NewReader(io.TeeReader(strings.NewReader(lines), config.Provenance.InputHash))
+	if err := ReadVcf(context.Background(), &config, reader, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(logs.String(), "it lacks "+MetadataInputSHA256) {
+		t.Errorf("NOT OK: Expected a warning for the streamed dosage matrix lacking %s, got %q", MetadataInputSHA256,
+			logs.String())
+	}
+}
+
+func TestOutputMetadataAllFilters(t *testing.T) {
+	metadata := outputMetadata(&Options{DosageSource: dosageSourceDS}, nil, 0, "")
+
+	if metadata[MetadataAllowedFilters] != "*" || metadata[MetadataExcludedFilters] != "" {
+		t.Errorf("NOT OK: Expected every filter to be allowed, got %v", metadata)
+	}
+}
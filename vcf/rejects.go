@@ -0,0 +1,142 @@
+package vcf
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+)
+
+const (
+	// filterError is reported for records whose FILTER value isn't allowed, or is excluded
+	filterError string = "FILTER not allowed"
+	// fieldsError is reported for records whose number of fields doesn't match the header, unless Options.Strict
+	fieldsError string = "Number of fields doesn't match the header"
+	// noCarrierNotice is reported for alleles no sample carries. These are counted, but not logged or
+	// written to the rejects report
+	noCarrierNotice string = "No sample carries ALT"
+	// ploidyError is reported for alleles left out of the PLINK output, because a called genotype has more than 2 alleles
+	ploidyError string = "Genotype has more than 2 alleles; skipping PLINK output"
+)
+
+// rejectReason is the stable code of a rejection, written to the rejects report, and counted by the stats and metrics
+type rejectReason string
+
+const (
+	reasonInsError1       rejectReason = "insError1"
+	reasonDelError1       rejectReason = "delError1"
+	reasonSameError       rejectReason = "sameError"
+	reasonPosError        rejectReason = "posError"
+	reasonBadAltError     rejectReason = "badAltError"
+	reasonMixedError      rejectReason = "mixedError"
+	reasonFilterError     rejectReason = "filterError"
+	reasonFieldsError     rejectReason = "fieldsError"
+	reasonPloidyError     rejectReason = "ploidyError"
+	reasonNoCarrierNotice rejectReason = "noCarrierNotice"
+)
+
+// rejectReasons maps the reason codes to their messages
+var rejectReasons = map[rejectReason]string{
+	reasonInsError1:   insError1,
+	reasonDelError1:   delError1,
+	reasonSameError:   sameError,
+	reasonPosError:    posError,
+	reasonBadAltError: badAltError,
+	reasonMixedError:  mixedError,
+	reasonFilterError: filterError,
+	reasonFieldsError: fieldsError,
+	reasonPloidyError: ploidyError,
+
+	reasonNoCarrierNotice: noCarrierNotice,
+}
+
+// rejection is an allele, or a whole record, dropped during decomposition
+type rejection struct {
+	chrom string
+	pos   string
+	ref   string
+	// The ALT allele rejected, or the whole ALT field when the record is rejected
+	alt string
+	// 0-based index of alt in the ALT field, or -1 when the record is rejected
+	altIndex int
+	reason   rejectReason
+}
+
+// logRejection logs r, as done when no rejects report is written
+// Filtered records, and alleles no sample carries, are expected, and aren't logged
+func logRejection(r rejection) {
+	if r.reason == reasonFilterError || r.reason == reasonNoCarrierNotice {
+		return
+	}
+
+	if r.altIndex < 0 {
+		log.Printf("%s:%s %s", r.chrom, r.pos, rejectReasons[r.reason])
+		return
+	}
+
+	log.Printf("%s:%s ALT #%d %s", r.chrom, r.pos, r.altIndex+1, rejectReasons[r.reason])
+}
+
+// rejectsWriter writes the rejects report: one tab-separated row per rejected allele or record, with the input line
+// of the record
+// It is safe for concurrent use; rows are written in the order the records are decomposed
+type rejectsWriter struct {
+	mu         sync.Mutex
+	w          *bufio.Writer
+	emptyField string
+}
+
+func newRejectsWriter(w io.Writer, emptyField string) (*rejectsWriter, error) {
+	writer := &rejectsWriter{w: bufio.NewWriter(w), emptyField: emptyField}
+
+	if _, err := writer.w.WriteString("chrom\tpos\tref\talt\taltIndex\tline\treason\n"); err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+func (w *rejectsWriter) write(line int, rejections []rejection) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, r := range rejections {
+		if r.reason == reasonNoCarrierNotice {
+			continue
+		}
+
+		altIndex := w.emptyField
+		if r.altIndex >= 0 {
+			altIndex = strconv.Itoa(r.altIndex)
+		}
+
+		w.w.WriteString(r.chrom)
+		w.w.WriteByte('\t')
+		w.w.WriteString(r.pos)
+		w.w.WriteByte('\t')
+		w.w.WriteString(r.ref)
+		w.w.WriteByte('\t')
+		w.w.WriteString(r.alt)
+		w.w.WriteByte('\t')
+		w.w.WriteString(altIndex)
+		w.w.WriteByte('\t')
+		w.w.WriteString(strconv.Itoa(line))
+		w.w.WriteByte('\t')
+		w.w.WriteString(string(r.reason))
+
+		if err := w.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close flushes the report; the underlying file is closed by the caller
+func (w *rejectsWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.w.Flush()
+}
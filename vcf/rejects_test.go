@@ -0,0 +1,73 @@
+package vcf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRejectsReport(t *testing.T) {
+	rejectsPath := filepath.Join(t.TempDir(), "rejects.tsv")
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO"}, "\t")
+	records := []string{
+		strings.Join([]string{"1", "100", "rs1", "A", "A", ".", "PASS", "."}, "\t"),
+		strings.Join([]string{"1", "200", "rs2", "C", "T,CTG,GA", ".", "PASS", "."}, "\t"),
+		strings.Join([]string{"1", "300", "rs3", "A", "N", ".", "PASS", "."}, "\t"),
+		strings.Join([]string{"1", "400", "rs4", "A", "T", ".", "LowQual", "."}, "\t"),
+		strings.Join([]string{"1", "500", "rs5", "ATG", "GTGC", ".", "PASS", "."}, "\t"),
+	}
+
+	lines := versionLine + "\n" + header + "\n" + strings.Join(records, "\n") + "\n"
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: map[string]bool{"PASS": true},
+		RejectsPath: rejectsPath}
+
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	if err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(lines)), w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	// rs2's T and CTG alleles are kept
+	if numRows := strings.Count(byteBuf.String(), "\n"); numRows != 2 {
+		t.Errorf("NOT OK: Expected 2 output rows, got %d", numRows)
+	}
+
+	report, err := os.ReadFile(rejectsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := strings.Split(strings.TrimSuffix(string(report), "\n"), "\n")
+
+	if rows[0] != "chrom\tpos\tref\talt\taltIndex\tline\treason" {
+		t.Errorf("NOT OK: Unexpected rejects header %s", rows[0])
+	}
+
+	// Records are decomposed concurrently, so rows may be out of order
+	expected := map[string]bool{
+		"1\t100\tA\tA\t0\t3\tsameError":       true,
+		"1\t200\tC\tGA\t2\t4\tinsError1":      true,
+		"1\t300\tA\tN\t0\t5\tbadAltError":     true,
+		"1\t400\tA\tT\t!\t6\tfilterError":     true,
+		"1\t500\tATG\tGTGC\t0\t7\tmixedError": true,
+	}
+
+	if len(rows)-1 != len(expected) {
+		t.Errorf("NOT OK: Expected %d rejects, got %d", len(expected), len(rows)-1)
+	}
+
+	for _, row := range rows[1:] {
+		if !expected[row] {
+			t.Errorf("NOT OK: Unexpected reject %q", row)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package vcf
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	bystroArrow "github.com/bystrogenomics/bystro-vcf/arrow"
+)
+
+// The maximum number of dosages held in memory while transposing the spilled dosage matrix
+var transposeBufferSize = 256 * 1024 * 1024
+
+// The maximum number of dosages held in memory while spilling a tile of variants
+var tileBufferSize = 64 * 1024 * 1024
+
+// The number of samples transposed at once within a tile, so that the rows read and written fit in the CPU cache
+const tileBlockSamples = 64
+
+// sampleMajorWriter writes the dosage matrix in sample-major order
+// Since variants arrive one row at a time, dosages are buffered in tiles of variants, with one byte per sample,
+// and each full tile is transposed in memory, then spilled to a temporary file, in sample-major order. On Close,
+// each batch of samples is read back with one read per tile, so that every spilled byte is read once, into 2
+// Arrow files:
+// {prefix}.loci.feather: variantIdx (uint32), locus (string), written as the variants arrive
+// {prefix}.samples.feather: sample (string), dosages (list<int8>), where dosages[variantIdx] is
+// the sample's dosage for that locus
+// This writing operation is threadsafe.
+type sampleMajorWriter struct {
+	prefix      string
+	sampleNames []string
+
+	spillFile *os.File
+	spill     *bufio.Writer
+	// The variant-major dosages of the tile being filled, up to tileVariants variants
+	tile         []byte
+	tileVariants int
+	// The number of variants in each tile spilled
+	tileSizes   []int
+	numVariants int
+
+	lociFile    *os.File
+	loci        *bystroArrow.ArrowWriter
+	lociBuilder *bystroArrow.ArrowRowBuilder
+
+	mu sync.Mutex
+}
+
+func newSampleMajorWriter(prefix string, sampleNames []string) (*sampleMajorWriter, error) {
+	// Spill next to the output, which is more likely to have room than the system temp dir
+	spillFile, err := os.CreateTemp(filepath.Dir(prefix), filepath.Base(prefix)+".*.spill")
+	if err != nil {
+		return nil, err
+	}
+
+	sw := &sampleMajorWriter{
+		prefix:       prefix,
+		sampleNames:  sampleNames,
+		spillFile:    spillFile,
+		spill:        bufio.NewWriterSize(spillFile, 4*1024*1024),
+		tileVariants: tileBufferSize / len(sampleNames),
+	}
+
+	if sw.tileVariants < 1 {
+		sw.tileVariants = 1
+	}
+
+	sw.lociFile, err = os.Create(prefix + ".loci.feather")
+	if err != nil {
+		sw.abort()
+		return nil, err
+	}
+
+	sw.loci, err = bystroArrow.NewArrowIPCFileWriter(sw.lociFile, []string{"variantIdx", "locus"},
+		[]arrow.DataType{arrow.PrimitiveTypes.Uint32, arrow.BinaryTypes.String}, false, ipc.WithZstd())
+	if err != nil {
+		sw.abort()
+		return nil, err
+	}
+
+	sw.lociBuilder, err = bystroArrow.NewArrowRowBuilder(sw.loci, 5e4)
+	if err != nil {
+		sw.abort()
+		return nil, err
+	}
+
+	return sw, nil
+}
+
+// writeVariant buffers one variant's dosages, spilling the tile once it is full, and writes its locus
+func (sw *sampleMajorWriter) writeVariant(locus string, dosages []any) error {
+	if len(dosages) != len(sw.sampleNames) {
+		return fmt.Errorf("mismatch in number of samples: expected %d, got %d", len(sw.sampleNames), len(dosages))
+	}
+
+	row := make([]byte, len(dosages))
+	for i, dosage := range dosages {
+		row[i] = byte(dosage.(int8))
+	}
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if err := sw.lociBuilder.WriteRow([]any{uint32(sw.numVariants), locus}); err != nil {
+		return err
+	}
+
+	sw.tile = append(sw.tile, row...)
+	sw.numVariants++
+
+	if len(sw.tile) >= sw.tileVariants*len(sw.sampleNames) {
+		return sw.spillTile()
+	}
+
+	return nil
+}
+
+// spillTile writes the buffered tile to the spill file, transposed to sample-major order
+func (sw *sampleMajorWriter) spillTile() error {
+	numSamples := len(sw.sampleNames)
+	numVariants := len(sw.tile) / numSamples
+
+	if numVariants == 0 {
+		return nil
+	}
+
+	// Samples are transposed in blocks, reading whole cache lines of each variant's row
+	block := make([]byte, tileBlockSamples*numVariants)
+
+	for start := 0; start < numSamples; start += tileBlockSamples {
+		end := start + tileBlockSamples
+		if end > numSamples {
+			end = numSamples
+		}
+
+		for variantIdx := 0; variantIdx < numVariants; variantIdx++ {
+			row := sw.tile[variantIdx*numSamples+start : variantIdx*numSamples+end]
+
+			for i, dosage := range row {
+				block[i*numVariants+variantIdx] = dosage
+			}
+		}
+
+		if _, err := sw.spill.Write(block[:(end-start)*numVariants]); err != nil {
+			return err
+		}
+	}
+
+	sw.tileSizes = append(sw.tileSizes, numVariants)
+	sw.tile = sw.tile[:0]
+
+	return nil
+}
+
+// Close spills the last tile, transposes the spilled dosages, finishes the loci and samples files, and removes
+// the spill file
+func (sw *sampleMajorWriter) Close() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	defer os.Remove(sw.spillFile.Name())
+	defer sw.spillFile.Close()
+
+	if err := sw.spillTile(); err != nil {
+		return err
+	}
+
+	sw.tile = nil
+
+	if err := sw.spill.Flush(); err != nil {
+		return err
+	}
+
+	if err := sw.closeLoci(); err != nil {
+		return err
+	}
+
+	return sw.writeSamples()
+}
+
+// abort removes the spill file, without writing the samples file
+func (sw *sampleMajorWriter) abort() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.spillFile.Close()
+	os.Remove(sw.spillFile.Name())
+
+	if sw.lociFile != nil {
+		sw.lociFile.Close()
+	}
+}
+
+func (sw *sampleMajorWriter) closeLoci() error {
+	if err := sw.lociBuilder.Release(); err != nil {
+		return err
+	}
+
+	if err := sw.loci.Close(); err != nil {
+		return err
+	}
+
+	return sw.lociFile.Close()
+}
+
+func (sw *sampleMajorWriter) writeSamples() error {
+	numVariants := sw.numVariants
+	numSamples := len(sw.sampleNames)
+
+	file, err := os.Create(sw.prefix + ".samples.feather")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "sample", Type: arrow.BinaryTypes.String},
+		{Name: "dosages", Type: arrow.ListOf(arrow.PrimitiveTypes.Int8)},
+	}, nil)
+
+	writer, err := bystroArrow.NewArrowIPCFileWriterWithSchema(file, schema, ipc.WithZstd())
+	if err != nil {
+		return err
+	}
+
+	samplesPerBatch := numSamples
+	if numVariants > 0 && transposeBufferSize/numVariants < samplesPerBatch {
+		samplesPerBatch = transposeBufferSize / numVariants
+	}
+
+	if samplesPerBatch < 1 {
+		samplesPerBatch = 1
+	}
+
+	pool := memory.NewGoAllocator()
+	var chunk []byte
+
+	for start := 0; start < numSamples; start += samplesPerBatch {
+		end := start + samplesPerBatch
+		if end > numSamples {
+			end = numSamples
+		}
+
+		batch := make([][]int8, end-start)
+		for i := range batch {
+			batch[i] = make([]int8, numVariants)
+		}
+
+		// Each tile holds the batch's samples contiguously, so they are read at once
+		var tileOffset int64
+		firstVariant := 0
+		for _, tileVariants := range sw.tileSizes {
+			size := (end - start) * tileVariants
+			if cap(chunk) < size {
+				chunk = make([]byte, size)
+			}
+			chunk = chunk[:size]
+
+			if _, err := sw.spillFile.ReadAt(chunk, tileOffset+int64(start*tileVariants)); err != nil {
+				return err
+			}
+
+			for i := range batch {
+				dosages := chunk[i*tileVariants : (i+1)*tileVariants]
+
+				for variantIdx, dosage := range dosages {
+					batch[i][firstVariant+variantIdx] = int8(dosage)
+				}
+			}
+
+			tileOffset += int64(numSamples * tileVariants)
+			firstVariant += tileVariants
+		}
+
+		if err := writeSampleMajorBatch(writer, pool, sw.sampleNames[start:end], batch); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func writeSampleMajorBatch(writer *bystroArrow.ArrowWriter, pool memory.Allocator, sampleNames []string, dosages [][]int8) error {
+	sampleBuilder := array.NewStringBuilder(pool)
+	defer sampleBuilder.Release()
+
+	listBuilder := array.NewListBuilder(pool, arrow.PrimitiveTypes.Int8)
+	defer listBuilder.Release()
+
+	valueBuilder := listBuilder.ValueBuilder().(*array.Int8Builder)
+
+	for i, name := range sampleNames {
+		sampleBuilder.Append(name)
+
+		listBuilder.Append(true)
+		valueBuilder.AppendValues(dosages[i], nil)
+	}
+
+	sampleCol := sampleBuilder.NewArray()
+	defer sampleCol.Release()
+
+	listCol := listBuilder.NewArray()
+	defer listCol.Release()
+
+	record := array.NewRecord(writer.Schema, []arrow.Array{sampleCol, listCol}, int64(len(sampleNames)))
+	defer record.Release()
+
+	return writer.WriteChunk(record)
+}
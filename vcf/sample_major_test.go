@@ -0,0 +1,105 @@
+package vcf
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+)
+
+// The transposition matches the dosages written, whatever the tile and batch boundaries
+func TestSampleMajorTranspose(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	const numSamples = 150
+	const numVariants = 37
+
+	sampleNames := make([]string, numSamples)
+	for i := range sampleNames {
+		sampleNames[i] = fmt.Sprintf("S%d", i)
+	}
+
+	dosages := make([][]any, numVariants)
+	for variantIdx := range dosages {
+		dosages[variantIdx] = make([]any, numSamples)
+		for i := range dosages[variantIdx] {
+			dosages[variantIdx][i] = int8(random.Intn(4) - 1)
+		}
+	}
+
+	for _, sizes := range []struct{ tile, transpose int }{{5 * numSamples, 7 * numVariants}, {1, 1}, {1 << 20, 1 << 20}} {
+		defaultBufferSize := transposeBufferSize
+		defaultTileSize := tileBufferSize
+		transposeBufferSize = sizes.transpose
+		tileBufferSize = sizes.tile
+
+		prefix := filepath.Join(t.TempDir(), "test")
+
+		writer, err := newSampleMajorWriter(prefix, sampleNames)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for variantIdx := range dosages {
+			if err := writer.writeVariant(fmt.Sprintf("chr1:%d:A:T", variantIdx), dosages[variantIdx]); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = writer.Close()
+
+		transposeBufferSize = defaultBufferSize
+		tileBufferSize = defaultTileSize
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := os.Open(prefix + ".samples.feather")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		reader, err := ipc.NewFileReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+
+		sampleIdx := 0
+		for i := 0; i < reader.NumRecords(); i++ {
+			record, err := reader.Record(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lists := record.Column(1).(*array.List)
+			values := lists.ListValues().(*array.Int8)
+
+			for rowIdx := 0; rowIdx < int(record.NumRows()); rowIdx++ {
+				start, end := lists.ValueOffsets(rowIdx)
+				if end-start != numVariants {
+					t.Fatalf("NOT OK: Expected %d dosages for sample %d, got %d", numVariants, sampleIdx, end-start)
+				}
+
+				for variantIdx := 0; variantIdx < numVariants; variantIdx++ {
+					if values.Value(int(start)+variantIdx) != dosages[variantIdx][sampleIdx] {
+						t.Fatalf("NOT OK: Sizes %+v: expected %d for sample %d variant %d, got %d", sizes,
+							dosages[variantIdx][sampleIdx], sampleIdx, variantIdx, values.Value(int(start)+variantIdx))
+					}
+				}
+
+				sampleIdx++
+			}
+		}
+
+		if sampleIdx != numSamples {
+			t.Errorf("NOT OK: Expected %d samples, got %d", numSamples, sampleIdx)
+		}
+	}
+}
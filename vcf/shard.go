@@ -0,0 +1,472 @@
+package vcf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	bystroArrow "github.com/bystrogenomics/bystro-vcf/arrow"
+)
+
+// SplitByChrom splits the outputs by chromosome, as Options.SplitBy
+const SplitByChrom = "chrom"
+
+// ChromPlaceholder is replaced by the chromosome in the paths of outputs split by chromosome
+const ChromPlaceholder = "{chrom}"
+
+// Shard is one chromosome's outputs, as listed in the manifest of a run split by chromosome
+type Shard struct {
+	Chrom string `json:"chrom"`
+	// The TSV output, empty if it wasn't written
+	Path string `json:"path,omitempty"`
+	// The dosage matrix, empty if it wasn't written
+	DosagePath string `json:"dosagePath,omitempty"`
+	// The number of alleles written, each a row of the TSV output and of the dosage matrix
+	// A dosage matrix derived from DS, GP, GL or PL also has rows for the alleles no sample carries, not counted here
+	Rows int64 `json:"rows"`
+}
+
+// Manifest lists the shards of a run split by chromosome, in chromosome order
+type Manifest struct {
+	SplitBy string `json:"splitBy"`
+	// The SHA-256 checksum of the input, empty if it wasn't computed
+	// The shards closed before the input was read to its end lack it in their metadata, so it is recorded here
+	InputSHA256 string  `json:"inputSha256,omitempty"`
+	Shards      []Shard `json:"shards"`
+}
+
+// ReadManifest reads the manifest written to Options.ManifestPath
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+
+	return &manifest, nil
+}
+
+// ShardPath returns the path of chrom's shard, replacing ChromPlaceholder in template with chrom
+// Characters of chrom that don't belong in a file name are replaced by underscores, so different chromosomes,
+// e.g. chrUn/1 and chrUn:1, can have the same path, which a run split by chromosome fails on
+func ShardPath(template string, chrom string) string {
+	return strings.ReplaceAll(template, ChromPlaceholder, safeChrom(chrom))
+}
+
+// safeChrom returns chrom with the characters that don't belong in a file name replaced by underscores
+func safeChrom(chrom string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r <= ' ' {
+			return '_'
+		}
+
+		return r
+	}, chrom)
+}
+
+// splittable returns an error if config's outputs can't be split by config.SplitBy
+func splittable(config *Options) error {
+	if config.SplitBy != SplitByChrom {
+		return fmt.Errorf("unsupported split %q, expected %s", config.SplitBy, SplitByChrom)
+	}
+
+	if config.CheckpointPath != "" {
+		return errors.New("split outputs can't be checkpointed")
+	}
+
+	if !config.NoOut && !strings.Contains(config.SplitOutPath, ChromPlaceholder) {
+		return fmt.Errorf("the split output path must contain %s, got %q", ChromPlaceholder, config.SplitOutPath)
+	}
+
+	if config.DosageMatrixOutPath != "" && !strings.Contains(config.DosageMatrixOutPath, ChromPlaceholder) {
+		return fmt.Errorf("the split dosage matrix path must contain %s, got %q", ChromPlaceholder,
+			config.DosageMatrixOutPath)
+	}
+
+	if config.ManifestPath == "" {
+		return errors.New("split outputs require a manifest path")
+	}
+
+	return nil
+}
+
+// maxOpenShards is the number of shards kept open, past which those whose chromosome is finished are closed
+const maxOpenShards = 32
+
+// shard is the writers of one chromosome's outputs
+type shard struct {
+	Shard
+	rows atomic.Int64
+
+	// Guards tsv, which the workers write their buffered output to
+	mu   sync.Mutex
+	tsv  *bufio.Writer
+	gzip *gzip.Writer
+
+	dosages *bystroArrow.ArrowWriter
+	files   []*os.File
+
+	// Guarded by shardWriters.mu
+	// The number of workers buffering rows for the shard
+	holders int
+	// The sequence number of the last batch whose rows were written to the shard
+	lastSeq int
+	closed  bool
+}
+
+// writeTSV writes output to the shard's TSV output
+func (s *shard) writeTSV(output []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.tsv.Write(output)
+
+	return err
+}
+
+// close finalizes the shard's outputs, and closes their files, returning the first error
+func (s *shard) close() error {
+	s.closed = true
+
+	var firstErr error
+	if s.tsv != nil {
+		firstErr = s.tsv.Flush()
+	}
+
+	if s.gzip != nil {
+		if err := s.gzip.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if s.dosages != nil {
+		if err := s.dosages.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, file := range s.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	s.tsv, s.gzip, s.dosages, s.files = nil, nil, nil, nil
+
+	return firstErr
+}
+
+// shardWriters creates the writers of each chromosome's outputs, the first time the chromosome is written
+// Past maxOpenShards open shards, those whose chromosome is finished are closed, so that inputs with many contigs
+// don't hold a file, buffers and compressors for each. This relies on the input being grouped by chromosome: a
+// chromosome that is found again once its shard is closed fails the run
+type shardWriters struct {
+	mu     sync.Mutex
+	shards map[string]*shard
+	// The chromosome of each shard, by the name its paths are made from
+	names map[string]string
+	open  int
+	// Every batch before done has been processed, as have those in finished
+	done     int
+	finished map[int]bool
+
+	config *Options
+	// The schema of the dosage matrices, nil if they aren't written
+	dosageSchema   *arrow.Schema
+	dosageMetadata map[string]string
+	// Creates the files of the shards, which are removed if the run fails
+	writers *outputWriters
+}
+
+// acquire returns chrom's shard, creating its outputs if needed, for a worker to buffer rows for until it calls
+// release
+func (s *shardWriters) acquire(chrom string) (*shard, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sh, ok := s.shards[chrom]; ok {
+		if sh.closed {
+			return nil, fmt.Errorf("found %s again after its shard was closed: splitting more than %d chromosomes "+
+				"requires the input to be grouped by chromosome", chrom, maxOpenShards)
+		}
+
+		sh.holders++
+
+		return sh, nil
+	}
+
+	name := safeChrom(chrom)
+	if other, ok := s.names[name]; ok {
+		return nil, fmt.Errorf("chromosomes %s and %s would be written to the same shard, %s", other, chrom, name)
+	}
+
+	// chrom may be a field of a row, whose block is reused
+	chrom = strings.Clone(chrom)
+	sh := &shard{Shard: Shard{Chrom: chrom}, holders: 1}
+
+	if !s.config.NoOut {
+		sh.Path = ShardPath(s.config.SplitOutPath, chrom)
+
+		file, err := s.writers.createFile(sh.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		sh.files = append(sh.files, file)
+
+		var w io.Writer = file
+		if strings.HasSuffix(sh.Path, ".gz") {
+			sh.gzip = gzip.NewWriter(file)
+			w = sh.gzip
+		}
+
+		sh.tsv = bufio.NewWriterSize(w, 1<<20)
+
+		if _, err := sh.tsv.WriteString(StringHeader(s.config) + "\n"); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.dosageSchema != nil {
+		sh.DosagePath = ShardPath(s.config.DosageMatrixOutPath, chrom)
+
+		file, err := s.writers.createFile(sh.DosagePath)
+		if err != nil {
+			return nil, err
+		}
+
+		sh.files = append(sh.files, file)
+
+		sh.dosages, err = bystroArrow.NewArrowIPCFileWriterWithSchema(s.config.Metrics.countWrites("dosages", file),
+			bystroArrow.WithSchemaMetadata(s.dosageSchema, s.dosageMetadata), ipc.WithZstd())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.shards[chrom] = sh
+	s.names[name] = chrom
+	s.open++
+
+	return sh, nil
+}
+
+// release ends a worker's hold on sh, whose rows it buffered up to the batch lastSeq
+func (s *shardWriters) release(sh *shard, lastSeq int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sh.holders--
+	if lastSeq > sh.lastSeq {
+		sh.lastSeq = lastSeq
+	}
+
+	return s.closeFinished()
+}
+
+// finishBatch records that a worker has processed the batch seq
+func (s *shardWriters) finishBatch(seq int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.finished[seq] = true
+	for s.finished[s.done] {
+		delete(s.finished, s.done)
+		s.done++
+	}
+
+	return s.closeFinished()
+}
+
+// closeFinished closes the shards whose chromosome is finished, if more than maxOpenShards are open
+// A chromosome is finished once no worker holds its shard, and the batch after the last one it was found in has been
+// processed, which, when the input is grouped by chromosome, is the start of another chromosome
+// s.mu must be held
+func (s *shardWriters) closeFinished() error {
+	if s.open <= maxOpenShards {
+		return nil
+	}
+
+	for _, sh := range s.shards {
+		if sh.closed || sh.holders > 0 || sh.lastSeq+1 >= s.done {
+			continue
+		}
+
+		s.open--
+
+		if err := sh.close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close finalizes the outputs of every shard that is still open, returning the first error
+func (s *shardWriters) Close() error {
+	var firstErr error
+	for _, sh := range s.shards {
+		if sh.closed {
+			continue
+		}
+
+		if err := sh.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// manifest returns the manifest of the shards written
+func (s *shardWriters) manifest() *Manifest {
+	manifest := &Manifest{SplitBy: s.config.SplitBy, InputSHA256: s.config.Provenance.InputSHA256,
+		Shards: make([]Shard, 0, len(s.shards))}
+
+	for _, sh := range s.shards {
+		entry := sh.Shard
+		entry.Rows = sh.rows.Load()
+
+		manifest.Shards = append(manifest.Shards, entry)
+	}
+
+	sort.Slice(manifest.Shards, func(i, j int) bool {
+		return chromLess(manifest.Shards[i].Chrom, manifest.Shards[j].Chrom)
+	})
+
+	return manifest
+}
+
+// writeManifest writes the manifest of the shards written to path
+func (s *shardWriters) writeManifest(path string) error {
+	data, err := json.MarshalIndent(s.manifest(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// chromLess orders chromosomes naturally: chr1, chr2, ..., chr10, ..., chrX, chrY, chrM, then the rest by name
+func chromLess(a string, b string) bool {
+	rankA, numA := chromRank(a)
+	rankB, numB := chromRank(b)
+
+	if rankA != rankB {
+		return rankA < rankB
+	}
+
+	if numA != numB {
+		return numA < numB
+	}
+
+	return a < b
+}
+
+func chromRank(chrom string) (int, int) {
+	name := strings.TrimPrefix(chrom, "chr")
+
+	number := 0
+	for i := 0; i < len(name); i++ {
+		if name[i] < '0' || name[i] > '9' || i >= 9 {
+			number = -1
+			break
+		}
+
+		number = number*10 + int(name[i]-'0')
+	}
+
+	switch {
+	case number > 0:
+		return 0, number
+	case name == "X":
+		return 1, 0
+	case name == "Y":
+		return 2, 0
+	case name == "M" || name == "MT":
+		return 3, 0
+	default:
+		return 4, 0
+	}
+}
+
+// workerShard is a processLines worker's buffered output for a shard
+// A worker only buffers rows for the chromosome it is processing, releasing the shard when the chromosome changes
+type workerShard struct {
+	*shard
+	output        bytes.Buffer
+	dosageBuilder *bystroArrow.ArrowRowBuilder
+	// The sequence number of the last batch whose rows were buffered
+	lastSeq int
+}
+
+// shardFor returns the worker's buffers for chrom's shard
+func shardFor(writers *outputWriters, chrom string) (*workerShard, error) {
+	sh, err := writers.shards.acquire(chrom)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &workerShard{shard: sh}
+
+	if sh.dosages != nil {
+		ws.dosageBuilder, err = writers.newArrowRowBuilder(sh.dosages, 5e3)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ws, nil
+}
+
+// releaseShard writes the worker's buffered output to the shard, and releases its buffers and its hold on the shard
+func releaseShard(ws *workerShard, writers *outputWriters, tsvBytes *atomic.Int64) error {
+	if err := flushShard(ws, tsvBytes); err != nil {
+		return err
+	}
+
+	if ws.dosageBuilder != nil {
+		if err := ws.dosageBuilder.Release(); err != nil {
+			return err
+		}
+	}
+
+	return writers.shards.release(ws.shard, ws.lastSeq)
+}
+
+// flushShard writes the worker's buffered TSV output and dosage rows to the shard
+// Unless tsvBytes is nil, the TSV bytes written are added to it
+func flushShard(ws *workerShard, tsvBytes *atomic.Int64) error {
+	if ws.output.Len() > 0 {
+		if err := ws.writeTSV(ws.output.Bytes()); err != nil {
+			return err
+		}
+
+		if tsvBytes != nil {
+			tsvBytes.Add(int64(ws.output.Len()))
+		}
+
+		ws.output.Reset()
+	}
+
+	if ws.dosageBuilder != nil {
+		return ws.dosageBuilder.Flush()
+	}
+
+	return nil
+}
@@ -0,0 +1,315 @@
+package vcf
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+)
+
+func splitTestVcf() string {
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2"}, "\t")
+	rows := []string{
+		strings.Join([]string{"1", "100", "rs1", "A", "T", ".", "PASS", ".", "GT", "1|1", "0|1"}, "\t"),
+		strings.Join([]string{"1", "200", "rs2", "C", "G,T", ".", "PASS", ".", "GT", "1|2", "0|0"}, "\t"),
+		strings.Join([]string{"10", "300", "rs3", "G", "T", ".", "PASS", ".", "GT", "0|0", "0|1"}, "\t"),
+		strings.Join([]string{"2", "400", "rs4", "T", "A", ".", "PASS", ".", "GT", "0|1", "1|1"}, "\t"),
+		strings.Join([]string{"1", "500", "rs5", "A", "C", ".", "PASS", ".", "GT", "0|1", "0|0"}, "\t"),
+		strings.Join([]string{"X", "600", "rs6", "C", "A", ".", "PASS", ".", "GT", "1|1", "./."}, "\t"),
+	}
+
+	return "##fileformat=VCFv4.x\n" + header + "\n" + strings.Join(rows, "\n") + "\n"
+}
+
+func TestSplitByChrom(t *testing.T) {
+	dir := t.TempDir()
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", SplitBy: SplitByChrom,
+		SplitOutPath: filepath.Join(dir, "out.{chrom}.tsv.gz"), DosageMatrixOutPath: filepath.Join(dir, "{chrom}.feather"),
+		ManifestPath: filepath.Join(dir, "manifest.json")}
+
+	if err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(splitTestVcf())), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := ReadManifest(config.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedChroms := []string{"chr1", "chr2", "chr10", "chrX"}
+	expectedRows := map[string]int64{"chr1": 4, "chr2": 1, "chr10": 1, "chrX": 1}
+
+	if manifest.SplitBy != SplitByChrom || len(manifest.Shards) != len(expectedChroms) {
+		t.Fatalf("NOT OK: Expected %d shards split by chrom, got %+v", len(expectedChroms), manifest)
+	}
+
+	for i, shard := range manifest.Shards {
+		if shard.Chrom != expectedChroms[i] || shard.Rows != expectedRows[shard.Chrom] {
+			t.Errorf("NOT OK: Expected shard %d to be %s with %d rows, got %+v", i, expectedChroms[i],
+				expectedRows[expectedChroms[i]], shard)
+		}
+
+		if shard.Path != ShardPath(config.SplitOutPath, shard.Chrom) ||
+			shard.DosagePath != ShardPath(config.DosageMatrixOutPath, shard.Chrom) {
+			t.Errorf("NOT OK: Unexpected paths for %s: %s, %s", shard.Chrom, shard.Path, shard.DosagePath)
+		}
+
+		file, err := os.Open(shard.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tsv, err := io.ReadAll(gz)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(string(tsv), "\n"), "\n")
+		if lines[0] != StringHeader(&config) || int64(len(lines)-1) != shard.Rows {
+			t.Errorf("NOT OK: Expected a header and %d rows in %s, got %q", shard.Rows, shard.Path, tsv)
+		}
+
+		for _, line := range lines[1:] {
+			if !strings.HasPrefix(line, shard.Chrom+"\t") {
+				t.Errorf("NOT OK: Expected only %s rows in %s, got %q", shard.Chrom, shard.Path, line)
+			}
+		}
+
+		loci := readSplitLoci(t, shard.DosagePath)
+		if int64(len(loci)) != shard.Rows {
+			t.Errorf("NOT OK: Expected %d dosage rows in %s, got %v", shard.Rows, shard.DosagePath, loci)
+		}
+
+		for _, locus := range loci {
+			if !strings.HasPrefix(locus, shard.Chrom+":") {
+				t.Errorf("NOT OK: Expected only %s loci in %s, got %s", shard.Chrom, shard.DosagePath, locus)
+			}
+		}
+	}
+}
+
+// readSplitLoci returns the sorted loci of the dosage matrix at path
+func readSplitLoci(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	arrowReader, err := ipc.NewFileReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer arrowReader.Close()
+
+	var loci []string
+	for i := 0; i < arrowReader.NumRecords(); i++ {
+		record, err := arrowReader.Record(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for rowIdx := 0; rowIdx < int(record.NumRows()); rowIdx++ {
+			loci = append(loci, record.Column(0).(*array.String).Value(rowIdx))
+		}
+	}
+
+	sort.Strings(loci)
+
+	return loci
+}
+
+func TestSplitByChromNoOut(t *testing.T) {
+	dir := t.TempDir()
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", NoOut: true, SplitBy: SplitByChrom,
+		DosageMatrixOutPath: filepath.Join(dir, "{chrom}.feather"), ManifestPath: filepath.Join(dir, "manifest.json")}
+
+	if err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(splitTestVcf())), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := ReadManifest(config.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, shard := range manifest.Shards {
+		if shard.Path != "" {
+			t.Errorf("NOT OK: Expected no TSV output for %s, got %s", shard.Chrom, shard.Path)
+		}
+	}
+
+	if loci := readSplitLoci(t, filepath.Join(dir, "chr1.feather")); len(loci) != 4 || loci[0] != "chr1:100:A:T" {
+		t.Errorf("NOT OK: Expected the 4 chr1 loci, got %v", loci)
+	}
+}
+
+func TestShardPath(t *testing.T) {
+	cases := map[string]string{"chr1": "out.chr1.tsv", "chrUn_KI270302v1": "out.chrUn_KI270302v1.tsv",
+		"chr1/alt:2": "out.chr1_alt_2.tsv"}
+
+	for chrom, expected := range cases {
+		if path := ShardPath("out.{chrom}.tsv", chrom); path != expected {
+			t.Errorf("NOT OK: Expected %s for %s, got %s", expected, chrom, path)
+		}
+	}
+}
+
+func TestShardPathCollision(t *testing.T) {
+	dir := t.TempDir()
+
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1"}, "\t")
+	vcf := "##fileformat=VCFv4.x\n" + header + "\n" +
+		strings.Join([]string{"chrUn/1", "100", ".", "A", "T", ".", "PASS", ".", "GT", "0|1"}, "\t") + "\n" +
+		strings.Join([]string{"chrUn:1", "100", ".", "A", "T", ".", "PASS", ".", "GT", "0|1"}, "\t") + "\n"
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", SplitBy: SplitByChrom,
+		SplitOutPath: filepath.Join(dir, "{chrom}.tsv"), ManifestPath: filepath.Join(dir, "manifest.json")}
+
+	err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(vcf)), nil)
+	if err == nil || !strings.Contains(err.Error(), "chrUn_1") {
+		t.Errorf("NOT OK: Expected chrUn/1 and chrUn:1 to collide in chrUn_1, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "chrUn_1.tsv")); !os.IsNotExist(err) {
+		t.Errorf("NOT OK: Expected the shards of the failed run to be removed, got %v", err)
+	}
+}
+
+// manyContigsVcf returns a VCF of numContigs contigs, in order, each with numRows records, spanning several batches
+func manyContigsVcf(numContigs int, numRows int) string {
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2"}, "\t")
+
+	var vcf strings.Builder
+	vcf.WriteString("##fileformat=VCFv4.x\n" + header + "\n")
+
+	for contig := 1; contig <= numContigs; contig++ {
+		for pos := 1; pos <= numRows; pos++ {
+			vcf.WriteString(strings.Join([]string{"chrUn_" + strconv.Itoa(contig), strconv.Itoa(pos * 100), ".", "A", "T",
+				".", "PASS", ".", "GT", "0|1", "1|1"}, "\t") + "\n")
+		}
+	}
+
+	return vcf.String()
+}
+
+func TestSplitManyContigs(t *testing.T) {
+	dir := t.TempDir()
+
+	numContigs := 2 * maxOpenShards
+	config := Options{EmptyField: "!", FieldDelimiter: ";", SplitBy: SplitByChrom,
+		SplitOutPath: filepath.Join(dir, "{chrom}.tsv.gz"), DosageMatrixOutPath: filepath.Join(dir, "{chrom}.feather"),
+		ManifestPath: filepath.Join(dir, "manifest.json")}
+
+	vcf := manyContigsVcf(numContigs, 2*batchRows)
+	if err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(vcf)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := ReadManifest(config.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifest.Shards) != numContigs {
+		t.Fatalf("NOT OK: Expected %d shards, got %d", numContigs, len(manifest.Shards))
+	}
+
+	// Shards closed during the run are as complete as those closed at its end
+	for _, shard := range manifest.Shards {
+		if shard.Rows != 2*batchRows {
+			t.Errorf("NOT OK: Expected %d rows for %s, got %d", 2*batchRows, shard.Chrom, shard.Rows)
+		}
+
+		file, err := os.Open(shard.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tsv, err := io.ReadAll(gz)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if numLines := strings.Count(string(tsv), "\n"); int64(numLines) != shard.Rows+1 {
+			t.Errorf("NOT OK: Expected a header and %d rows in %s, got %d lines", shard.Rows, shard.Path, numLines)
+		}
+
+		if loci := readSplitLoci(t, shard.DosagePath); int64(len(loci)) != shard.Rows {
+			t.Errorf("NOT OK: Expected %d dosage rows in %s, got %d", shard.Rows, shard.DosagePath, len(loci))
+		}
+	}
+}
+
+func TestSplitManyContigsUngrouped(t *testing.T) {
+	dir := t.TempDir()
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", SplitBy: SplitByChrom, Concurrency: 1,
+		SplitOutPath: filepath.Join(dir, "{chrom}.tsv"), ManifestPath: filepath.Join(dir, "manifest.json")}
+
+	// The first contig is found again once more than maxOpenShards contigs have been written
+	vcf := manyContigsVcf(2*maxOpenShards, batchRows) +
+		strings.Join([]string{"chrUn_1", "1", ".", "A", "T", ".", "PASS", ".", "GT", "0|1", "1|1"}, "\t") + "\n"
+
+	err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(vcf)), nil)
+	if err == nil || !strings.Contains(err.Error(), "grouped by chromosome") {
+		t.Errorf("NOT OK: Expected an error for chrUn_1 found again after its shard was closed, got %v", err)
+	}
+}
+
+func TestChromLess(t *testing.T) {
+	chroms := []string{"chrY", "chrUn_KI270302v1", "chr10", "chrM", "chr2", "chrX", "chr1", "chr22_KI270731v1_random"}
+	sort.Slice(chroms, func(i, j int) bool { return chromLess(chroms[i], chroms[j]) })
+
+	expected := "chr1,chr2,chr10,chrX,chrY,chrM,chr22_KI270731v1_random,chrUn_KI270302v1"
+	if strings.Join(chroms, ",") != expected {
+		t.Errorf("NOT OK: Expected %s, got %s", expected, strings.Join(chroms, ","))
+	}
+}
+
+func TestSplitUnsupported(t *testing.T) {
+	dir := t.TempDir()
+
+	cases := []Options{
+		{SplitBy: "pos", SplitOutPath: "{chrom}.tsv", ManifestPath: "manifest.json"},
+		{SplitBy: SplitByChrom, SplitOutPath: "out.tsv", ManifestPath: "manifest.json"},
+		{SplitBy: SplitByChrom, SplitOutPath: "{chrom}.tsv", DosageMatrixOutPath: "dosages.feather",
+			ManifestPath: "manifest.json"},
+		{SplitBy: SplitByChrom, SplitOutPath: "{chrom}.tsv"},
+		{SplitBy: SplitByChrom, SplitOutPath: "{chrom}.tsv", ManifestPath: "manifest.json",
+			CheckpointPath: filepath.Join(dir, "checkpoint")},
+	}
+
+	for _, config := range cases {
+		config.EmptyField = "!"
+		config.FieldDelimiter = ";"
+
+		err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(splitTestVcf())), nil)
+		if err == nil {
+			t.Errorf("NOT OK: Expected an error splitting %+v", config)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package vcf
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// siteStats counts the sites and alleles written, for one chromosome or site type
+type siteStats struct {
+	Records int `json:"records,omitempty"`
+	Sites   int `json:"sites"`
+	Alleles int `json:"alleles"`
+}
+
+// runStats summarizes a run, as written to Options.StatsPath
+// Each processLines worker collects its own, which are merged when it finishes
+type runStats struct {
+	// Records read, not counting empty lines
+	Records int `json:"records"`
+	// Bytes of records read, not counting the header
+	Bytes int `json:"bytes"`
+	// Records dropped because of their FILTER value
+	Filtered int `json:"filtered"`
+	// Rejected alleles and records, by reason code, including filterError
+	Rejected map[string]int `json:"rejected"`
+	// Sites with at least 1 allele written
+	Sites int `json:"sites"`
+	// Alleles written
+	Alleles int `json:"alleles"`
+	// Alleles skipped because no sample carries them (ac == 0)
+	ACZero      int                   `json:"acZero"`
+	SiteTypes   map[string]*siteStats `json:"siteTypes"`
+	Chromosomes map[string]*siteStats `json:"chromosomes"`
+
+	ElapsedSeconds   float64 `json:"elapsedSeconds"`
+	RecordsPerSecond float64 `json:"recordsPerSecond"`
+	AllelesPerSecond float64 `json:"allelesPerSecond"`
+	BytesPerSecond   float64 `json:"bytesPerSecond"`
+
+	// The most memory held at once by the chunks buffered for the Arrow outputs
+	PeakArrowBytes int64 `json:"peakArrowBytes"`
+
+	mu sync.Mutex
+}
+
+func newRunStats() *runStats {
+	return &runStats{
+		Rejected:    make(map[string]int),
+		SiteTypes:   make(map[string]*siteStats),
+		Chromosomes: make(map[string]*siteStats),
+	}
+}
+
+func (s *runStats) chromosome(chrom string) *siteStats {
+	stats, ok := s.Chromosomes[chrom]
+	if !ok {
+		stats = &siteStats{}
+		// chrom may be a field of a row, whose block is reused
+		s.Chromosomes[strings.Clone(chrom)] = stats
+	}
+
+	return stats
+}
+
+func (s *runStats) addRecord(chrom string, numBytes int) {
+	s.Records++
+	s.Bytes += numBytes
+	s.chromosome(chrom).Records++
+}
+
+func (s *runStats) addRejection(r rejection) {
+	switch r.reason {
+	case reasonNoCarrierNotice:
+		s.ACZero++
+		return
+	case reasonFilterError:
+		s.Filtered++
+	}
+
+	s.Rejected[string(r.reason)]++
+}
+
+// addSite counts the site's alleles written to the TSV output, leaving out NoCarrier alleles
+func (s *runStats) addSite(site *Site) {
+	numAlleles := site.numCarried()
+	if numAlleles == 0 {
+		return
+	}
+
+	s.Sites++
+	s.Alleles += numAlleles
+
+	siteType, ok := s.SiteTypes[site.Type]
+	if !ok {
+		siteType = &siteStats{}
+		s.SiteTypes[site.Type] = siteType
+	}
+
+	siteType.Sites++
+	siteType.Alleles += numAlleles
+
+	chrom := s.chromosome(site.Chrom)
+	chrom.Sites++
+	chrom.Alleles += numAlleles
+}
+
+// merge adds a worker's stats to s
+func (s *runStats) merge(worker *runStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Records += worker.Records
+	s.Bytes += worker.Bytes
+	s.Filtered += worker.Filtered
+	s.Sites += worker.Sites
+	s.Alleles += worker.Alleles
+	s.ACZero += worker.ACZero
+
+	for reason, count := range worker.Rejected {
+		s.Rejected[reason] += count
+	}
+
+	for _, breakdown := range []struct{ into, from map[string]*siteStats }{
+		{s.SiteTypes, worker.SiteTypes},
+		{s.Chromosomes, worker.Chromosomes},
+	} {
+		for key, from := range breakdown.from {
+			into, ok := breakdown.into[key]
+			if !ok {
+				into = &siteStats{}
+				breakdown.into[key] = into
+			}
+
+			into.Records += from.Records
+			into.Sites += from.Sites
+			into.Alleles += from.Alleles
+		}
+	}
+}
+
+// write sets the throughput figures, and writes s as JSON to path
+func (s *runStats) write(path string, elapsed time.Duration) error {
+	s.ElapsedSeconds = elapsed.Seconds()
+
+	if s.ElapsedSeconds > 0 {
+		s.RecordsPerSecond = float64(s.Records) / s.ElapsedSeconds
+		s.AllelesPerSecond = float64(s.Alleles) / s.ElapsedSeconds
+		s.BytesPerSecond = float64(s.Bytes) / s.ElapsedSeconds
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,71 @@
+package vcf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStatsSummary(t *testing.T) {
+	statsPath := filepath.Join(t.TempDir(), "stats.json")
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2"}, "\t")
+	records := []string{
+		strings.Join([]string{"1", "100", "rs1", "C", "T,G", ".", "PASS", ".", "GT", "0|1", "0|0"}, "\t"),
+		strings.Join([]string{"1", "200", "rs2", "A", "G", ".", "LowQual", ".", "GT", "0|1", "0|0"}, "\t"),
+		strings.Join([]string{"1", "300", "rs3", "A", "N", ".", "PASS", ".", "GT", "0|1", "0|0"}, "\t"),
+		strings.Join([]string{"2", "400", "rs4", "ACG", "A", ".", "PASS", ".", "GT", "1|1", "0|1"}, "\t"),
+	}
+
+	lines := versionLine + "\n" + header + "\n" + strings.Join(records, "\n") + "\n"
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: map[string]bool{"PASS": true},
+		StatsPath: statsPath, DosageMatrixOutPath: filepath.Join(t.TempDir(), "dosages.feather"), MaxMemory: 1 << 20}
+
+	w := bufio.NewWriter(new(bytes.Buffer))
+
+	if err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(lines)), w); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(statsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats runStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Records != 4 || stats.Filtered != 1 || stats.Sites != 2 || stats.Alleles != 2 || stats.ACZero != 1 {
+		t.Errorf("NOT OK: Unexpected counts %s", data)
+	}
+
+	if stats.Rejected["badAltError"] != 1 || stats.Rejected["filterError"] != 1 || len(stats.Rejected) != 2 {
+		t.Errorf("NOT OK: Unexpected rejections %v", stats.Rejected)
+	}
+
+	if *stats.SiteTypes["MULTIALLELIC"] != (siteStats{Sites: 1, Alleles: 1}) || *stats.SiteTypes["DEL"] != (siteStats{Sites: 1, Alleles: 1}) {
+		t.Errorf("NOT OK: Unexpected site types %s", data)
+	}
+
+	if *stats.Chromosomes["chr1"] != (siteStats{Records: 3, Sites: 1, Alleles: 1}) ||
+		*stats.Chromosomes["chr2"] != (siteStats{Records: 1, Sites: 1, Alleles: 1}) {
+		t.Errorf("NOT OK: Unexpected chromosomes %s", data)
+	}
+
+	if stats.Bytes == 0 || stats.ElapsedSeconds <= 0 {
+		t.Errorf("NOT OK: Expected throughput figures, got %s", data)
+	}
+
+	if stats.PeakArrowBytes <= 0 {
+		t.Errorf("NOT OK: Expected the peak memory of the dosage matrix, got %s", data)
+	}
+}
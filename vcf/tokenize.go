@@ -0,0 +1,103 @@
+package vcf
+
+import (
+	"bytes"
+	"strings"
+	"unsafe"
+)
+
+// splitRecord splits a row, without its line ending, into its tab separated fields, appending them to fields[:0]
+// The fields are strings over the row's bytes, found in a single pass over the row, without copying it, so they
+// are only valid for as long as the row is: a batch's rows are in a pooled block, which is reused for other rows
+// once the batch is released. Fields, or substrings of them, kept past then, e.g. as map keys, must be cloned
+// Passing the previous row's fields avoids allocating them again, as long as they are no longer used
+func splitRecord(row []byte, fields []string) []string {
+	fields = fields[:0]
+
+	if len(row) == 0 {
+		return append(fields, "")
+	}
+
+	line := unsafe.String(&row[0], len(row))
+
+	for start := 0; ; {
+		end := bytes.IndexByte(row[start:], tabByte)
+		if end == -1 {
+			return append(fields, line[start:])
+		}
+
+		fields = append(fields, line[start:start+end])
+		start += end + 1
+	}
+}
+
+// nthValue returns the n-th (0 based) of the sep separated values of s, found in place, without splitting s,
+// or false if s has fewer values
+func nthValue(s string, sep byte, n int) (string, bool) {
+	for ; n > 0; n-- {
+		end := strings.IndexByte(s, sep)
+		if end == -1 {
+			return "", false
+		}
+
+		s = s[end+1:]
+	}
+
+	if end := strings.IndexByte(s, sep); end != -1 {
+		return s[:end], true
+	}
+
+	return s, true
+}
+
+// alleleIterator yields the alleles of a sample's genotype in place, without splitting it
+// As for strings.Split, the alleles are separated by '|' if the GT value has any, or else by '/'
+type alleleIterator struct {
+	gt   string
+	sep  byte
+	done bool
+}
+
+// newAlleleIterator creates an alleleIterator over the GT value at the start of a sample's genotype field
+func newAlleleIterator(sampleGenotypeField string) alleleIterator {
+	gt := sampleGenotypeField
+	if end := strings.IndexByte(gt, ':'); end != -1 {
+		gt = gt[:end]
+	}
+
+	var sep byte
+	if strings.IndexByte(gt, '|') != -1 {
+		sep = '|'
+	} else if strings.IndexByte(gt, '/') != -1 {
+		sep = '/'
+	}
+
+	return alleleIterator{gt: gt, sep: sep}
+}
+
+// phased returns true unless the alleles are separated by '/'; haploid genotypes are trivially phased
+func (it *alleleIterator) phased() bool {
+	return it.sep != '/'
+}
+
+// next returns the next allele, or false once there are none left
+func (it *alleleIterator) next() (string, bool) {
+	if it.done {
+		return "", false
+	}
+
+	end := -1
+	if it.sep != 0 {
+		end = strings.IndexByte(it.gt, it.sep)
+	}
+
+	if end == -1 {
+		it.done = true
+		return it.gt, true
+	}
+
+	allele := it.gt[:end]
+	it.gt = it.gt[end+1:]
+
+	return allele, true
+}
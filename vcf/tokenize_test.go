@@ -0,0 +1,76 @@
+package vcf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitRecord(t *testing.T) {
+	var fields []string
+
+	for _, row := range []string{"chr1\t100\trs1\tC\tT", "", "a", "\t", "a\t\tb\t", "chr2\t200\t.\tG\tA,C\t.\tPASS\t.\tGT\t0|1"} {
+		fields = splitRecord([]byte(row), fields)
+
+		expected := strings.Split(row, "\t")
+		if !reflect.DeepEqual(fields, expected) {
+			t.Errorf("NOT OK: Expected %q for %q, got %q", expected, row, fields)
+		}
+	}
+}
+
+// The fields are over the row's bytes, rather than a copy of them
+func TestSplitRecordAliasesRow(t *testing.T) {
+	row := []byte("chr1\t100")
+	fields := splitRecord(row, nil)
+
+	row[3] = '2'
+	if fields[0] != "chr2" {
+		t.Errorf("NOT OK: Expected the fields to change with the row, got %q", fields)
+	}
+}
+
+func TestNthValue(t *testing.T) {
+	for _, value := range []string{"0|1:0.9,0.1:0.05,0.9,0.05", "", ":", "a::b:", "."} {
+		values := strings.Split(value, ":")
+
+		for n := 0; n <= len(values); n++ {
+			actual, ok := nthValue(value, ':', n)
+
+			if n < len(values) && (!ok || actual != values[n]) {
+				t.Errorf("NOT OK: Expected %q as value %d of %q, got %q, %t", values[n], n, value, actual, ok)
+			} else if n == len(values) && ok {
+				t.Errorf("NOT OK: Expected no value %d of %q, got %q", n, value, actual)
+			}
+		}
+	}
+}
+
+func TestAlleleIterator(t *testing.T) {
+	for _, test := range []struct {
+		field   string
+		alleles []string
+		phased  bool
+	}{
+		{"0|1", []string{"0", "1"}, true},
+		{"0/1:10:0.5", []string{"0", "1"}, false},
+		{"1", []string{"1"}, true},
+		{".:3", []string{"."}, true},
+		{"0/1/12", []string{"0", "1", "12"}, false},
+		{"1|0/2", []string{"1", "0/2"}, true},
+		{"0/", []string{"0", ""}, false},
+		{"", []string{""}, true},
+	} {
+		alleles := newAlleleIterator(test.field)
+
+		var actual []string
+		for allele, ok := alleles.next(); ok; allele, ok = alleles.next() {
+			actual = append(actual, allele)
+		}
+
+		if !reflect.DeepEqual(actual, test.alleles) || alleles.phased() != test.phased {
+			t.Errorf("NOT OK: Expected %q, phased %v for %q, got %q, phased %v", test.alleles, test.phased, test.field,
+				actual, alleles.phased())
+		}
+	}
+}
@@ -0,0 +1,2136 @@
+// Package vcf decomposes VCF records into their individual alleles, normalizing indels and MNPs,
+// and summarizes each allele's genotypes: its homozygous, heterozygous and missing samples, dosages,
+// haplotypes and allele counts
+// ReadVcf runs the full bystro-vcf pipeline, and Decomposer can be used to process records one at a time
+package vcf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/bystrogenomics/bystro-utils/parse"
+	bystroArrow "github.com/bystrogenomics/bystro-vcf/arrow"
+	"github.com/bystrogenomics/bystro-vcf/bgen"
+	"github.com/bystrogenomics/bystro-vcf/plink"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	chromIdx  int = 0
+	posIdx    int = 1
+	idIdx     int = 2
+	refIdx    int = 3
+	altIdx    int = 4
+	qualIdx   int = 5
+	filterIdx int = 6
+	infoIdx   int = 7
+	formatIdx int = 8
+	sampleIdx int = 9
+)
+
+const (
+	insError1      string = "1st base ALT != REF"
+	delError1      string = "1st base REF != ALT"
+	badPrefixError string = "No shared suffix && prefix doesn't match"
+	sameError      string = "REF == ALT"
+	missError      string = "ALT == '.'"
+	posError       string = "Invalid POS"
+	badAltError    string = "ALT not ACTG"
+	mixedError     string = "Mixed indel/snp sites not supported"
+	complexNotice  string = "Complex site"
+
+	errorLvl string = "Error: "
+)
+
+const tabByte = byte('\t')
+const clByte = byte('\n')
+const chrByte = byte('c')
+const zeroByte = byte('0')
+
+// Decimal places to round floats to
+const precision = 3
+
+// The approximate size at which the chunks (record batches) of the Arrow outputs are written, before they reach their
+// row count, so that the dosage and haplotype matrices of large cohorts don't hold thousands of samples' rows in
+// memory per thread
+const maxChunkBytes = 64 << 20
+
+// dosageMatrixStdout is the DosageMatrixOutPath that writes the dosage matrix to stdout
+const dosageMatrixStdout = "-"
+
+// Options configures ReadVcf, and the Decomposer it runs over each record
+type Options struct {
+	// Skip writing the TSV output, e.g. when only a dosage matrix is wanted
+	NoOut bool
+	// The dosage matrix is written in the Arrow IPC file format, or, if "-", to stdout in the stream format
+	DosageMatrixOutPath string
+	// The FORMAT field the dosage matrix is derived from: GT, DS, GP, GL or PL
+	DosageSource       string
+	PlinkOutPrefix     string
+	BgenOutPath        string
+	HaplotypeOutPath   string
+	SparseDosagePrefix string
+	SampleMajorPrefix  string
+	// Write a TSV report of the rejected alleles and records here, instead of logging them
+	RejectsPath string
+	// Write a JSON summary of the run here: records read, filtered and rejected, and alleles written, by chromosome
+	// and site type, and throughput
+	StatsPath string
+	// Report progress to stderr at this interval. 0 disables progress reports
+	ProgressInterval time.Duration
+	// Report progress as JSON lines, rather than text
+	ProgressJSON bool
+	// Fail on records whose number of fields doesn't match the header, rather than rejecting them
+	Strict bool
+	// The size of the input in bytes, if known, to report progress as a percentage
+	InputSize int64
+	// If not nil, the run's metrics are added to Metrics
+	Metrics *Metrics
+	// Write the output in input order, recording a checkpoint here every CheckpointInterval, from which an
+	// interrupted run can be resumed. Only the TSV output and the dosage matrix can be checkpointed
+	CheckpointPath     string
+	CheckpointInterval time.Duration
+	// Resume from the checkpoint at CheckpointPath, if there is one. The TSV output must already have been truncated
+	// to the checkpoint's OutputBytes
+	Resume bool
+	// Split the TSV output and the dosage matrix by chromosome (SplitByChrom), writing each chromosome's to
+	// SplitOutPath and DosageMatrixOutPath, with ChromPlaceholder replaced by the chromosome, and listing them in a
+	// JSON Manifest at ManifestPath. The writer given to ReadVcf is unused. Empty to not split them
+	SplitBy      string
+	SplitOutPath string
+	ManifestPath string
+	// The memory, in bytes, that the chunks buffered for the Arrow outputs aim to stay under, by being written early,
+	// in smaller chunks. 0 doesn't limit them
+	MaxMemory int64
+	// The number of threads decomposing records. 0 runs one per CPU
+	Concurrency int
+	// Written to the schema metadata of the dosage and haplotype matrices, along with the VCF header, filters,
+	// encoding and sample count
+	Provenance Provenance
+	// The compression of BGEN genotype blocks: zstd, zlib, or none
+	BgenCompression string
+	SampleListPath  string
+	FamPath         string
+	EmptyField      string
+	FieldDelimiter  string
+	KeepID          bool
+	KeepInfo        bool
+	KeepQual        bool
+	KeepPos         bool
+	LabelPartials   bool
+	// If not nil, only records whose FILTER value is in AllowedFilters are kept
+	AllowedFilters map[string]bool
+	// If not nil, records whose FILTER value is in ExcludedFilters are dropped
+	ExcludedFilters map[string]bool
+}
+
+// numWorkers returns the number of threads to decompose records on
+func numWorkers(config *Options) int {
+	if config.Concurrency > 0 {
+		return config.Concurrency
+	}
+
+	return runtime.NumCPU()
+}
+
+// expectsExpectedDosages returns true if the dosage matrix holds expected alt allele counts
+// derived from a FORMAT field other than GT
+func expectsExpectedDosages(config *Options) bool {
+	return config.DosageSource != "" && config.DosageSource != dosageSourceGT
+}
+
+func StringHeader(config *Options) string {
+	return strings.Join(Header(config), string(tabByte))
+}
+
+func Header(config *Options) []string {
+	header := parse.Header
+
+	if config.KeepPos {
+		header = append(header, "vcfPos")
+	}
+
+	if config.KeepID {
+		header = append(header, "id")
+	}
+
+	if config.KeepInfo {
+		header = append(header, "alleleIdx", "info")
+	}
+
+	if config.LabelPartials {
+		header = append(header, "partial", "partiality")
+	}
+
+	return header
+}
+
+// ReadHeader reads the VCF preamble up to, and including, the #CHROM line
+// It returns the normalized header, and the end of line byte and its number of characters,
+// which are needed to read the remaining records
+// ErrNotVCF or ErrNoHeader are returned for input that isn't a VCF file
+func ReadHeader(reader *bufio.Reader) ([]string, byte, int, error) {
+	header, _, endOfLineByte, numChars, _, err := readHeader(reader)
+
+	return header, endOfLineByte, numChars, err
+}
+
+// readHeader is ReadHeader, additionally returning the ## meta-information lines, and the number of lines read,
+// so that record line numbers can be reported
+func readHeader(reader *bufio.Reader) ([]string, []string, byte, int, int, error) {
+	endOfLineByte, numChars, versionLine, err := parse.FindEndOfLine(reader, "")
+
+	if err == io.EOF {
+		return nil, nil, 0, 0, 0, ErrNotVCF
+	} else if err != nil {
+		return nil, nil, 0, 0, 0, err
+	}
+
+	vcfMatch, err := regexp.MatchString("##fileformat=VCFv4", versionLine)
+
+	if err != nil {
+		return nil, nil, 0, 0, 0, err
+	}
+
+	if !vcfMatch {
+		return nil, nil, 0, 0, 0, ErrNotVCF
+	}
+
+	metaLines := []string{versionLine}
+	numLines := 1
+
+	for {
+		// http://stackoverflow.com/questions/8757389/reading-file-line-by-line-in-go
+		// http://www.jeffduckett.com/blog/551119d6c6b86364cef12da7/golang---read-a-file-line-by-line.html
+		row, err := reader.ReadString(endOfLineByte) // 0x0A separator = newline
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, 0, 0, 0, err
+		} else if row == "" {
+			// This shouldn't occur, however, in case
+			continue
+		}
+
+		numLines++
+
+		// Chomp equivalent: https://groups.google.com/forum/#!topic/golang-nuts/smFU8TytFr4
+		record := strings.Split(row[:len(row)-numChars], "\t")
+
+		if record[chromIdx] == "#CHROM" {
+			parse.NormalizeHeader(record)
+
+			return record, metaLines, endOfLineByte, numChars, numLines, nil
+		}
+
+		metaLines = append(metaLines, row[:len(row)-numChars])
+	}
+
+	return nil, nil, 0, 0, 0, ErrNoHeader
+}
+
+// outputWriters holds the writers shared by every processLines thread
+// Any of them may be nil, if that output wasn't asked for
+type outputWriters struct {
+	tsv *bufio.Writer
+	// Guards tsv, which the workers write their buffered output to
+	tsvMu       sync.Mutex
+	dosages     *bystroArrow.ArrowWriter
+	sparse      *sparseDosageWriter
+	sampleMajor *sampleMajorWriter
+	haplotypes  *bystroArrow.ArrowWriter
+	plink       *plink.PlinkWriter
+	bgen        *bgen.BgenWriter
+	rejects     *rejectsWriter
+	// Shared by the Arrow outputs' ArrowRowBuilders, to bound their memory
+	allocator *bystroArrow.Allocator
+	// Set when checkpointing, to write the TSV output and the dosage matrix in order
+	ordered *orderedWriter
+	// Set when splitting the outputs, to write the TSV output and the dosage matrix of each chromosome
+	shards *shardWriters
+
+	// Files that back the writers, closed after them
+	files []*os.File
+	// Every file written, removed if the run fails
+	paths []string
+}
+
+// newArrowRowBuilder creates an ArrowRowBuilder for aw, whose chunks are limited in size, and share the allocator
+func (w *outputWriters) newArrowRowBuilder(aw *bystroArrow.ArrowWriter, chunkSize int) (*bystroArrow.ArrowRowBuilder, error) {
+	return bystroArrow.NewArrowRowBuilder(aw, chunkSize, bystroArrow.WithMaxChunkBytes(maxChunkBytes),
+		bystroArrow.WithAllocator(w.allocator))
+}
+
+// setMetadata adds metadata to the dosage and haplotype matrices, before their footers are written
+// The dosage matrix streamed to stdout has no footer, and keeps the metadata it started with once it has rows, as
+// do the shards closed during the run, so a warning is logged for each
+func (w *outputWriters) setMetadata(metadata map[string]string) error {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, aw := range []*bystroArrow.ArrowWriter{w.dosages, w.haplotypes} {
+		if aw == nil {
+			continue
+		}
+
+		err := aw.SetMetadata(metadata)
+		if errors.Is(err, bystroArrow.ErrMetadataWritten) {
+			log.Printf("The streamed dosage matrix was written before its metadata was complete; it lacks %s",
+				strings.Join(keys, ", "))
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.shards == nil {
+		return nil
+	}
+
+	numClosed := 0
+	for _, sh := range w.shards.shards {
+		if sh.closed {
+			if sh.DosagePath != "" {
+				numClosed++
+			}
+
+			continue
+		}
+
+		if sh.dosages == nil {
+			continue
+		}
+
+		if err := sh.dosages.SetMetadata(metadata); err != nil {
+			return err
+		}
+	}
+
+	if numClosed > 0 {
+		log.Printf("%d dosage matrix shards were closed before their metadata was complete; they lack %s, which the manifest has",
+			numClosed, strings.Join(keys, ", "))
+	}
+
+	return nil
+}
+
+// close finalizes every output, returning the first error
+func (w *outputWriters) close() error {
+	var closers []io.Closer
+	if w.shards != nil {
+		closers = append(closers, w.shards)
+	}
+
+	if w.dosages != nil {
+		closers = append(closers, w.dosages)
+	}
+
+	if w.sparse != nil {
+		closers = append(closers, w.sparse)
+	}
+
+	if w.sampleMajor != nil {
+		closers = append(closers, w.sampleMajor)
+	}
+
+	if w.haplotypes != nil {
+		closers = append(closers, w.haplotypes)
+	}
+
+	if w.plink != nil {
+		closers = append(closers, w.plink)
+	}
+
+	if w.bgen != nil {
+		closers = append(closers, w.bgen)
+	}
+
+	if w.rejects != nil {
+		closers = append(closers, w.rejects)
+	}
+
+	for _, file := range w.files {
+		closers = append(closers, file)
+	}
+
+	var firstErr error
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil && firstErr == nil && !errors.Is(err, os.ErrClosed) {
+			firstErr = err
+		}
+	}
+
+	*w = outputWriters{paths: w.paths}
+
+	return firstErr
+}
+
+// abort closes every output, and removes the files written, so that incomplete outputs
+// can't be mistaken for complete ones
+func (w *outputWriters) abort() {
+	// The sample-major spill file doesn't need to be transposed
+	if w.sampleMajor != nil {
+		w.sampleMajor.abort()
+		w.sampleMajor = nil
+	}
+
+	w.close()
+
+	for _, path := range w.paths {
+		os.Remove(path)
+	}
+}
+
+// createFile creates a file that is removed if the run fails
+func (w *outputWriters) createFile(path string) (*os.File, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w.files = append(w.files, file)
+	w.paths = append(w.paths, path)
+
+	return file, nil
+}
+
+// ReadVcf decomposes every record read from reader, writing the TSV output to writer, unless config.NoOut is set,
+// and any dosage, haplotype, PLINK, BGEN or rejects outputs that config asks for
+// The header must not have been read yet
+// Processing stops at the first error, or when ctx is cancelled, and that error is returned
+// Errors specific to a record are returned as a *RecordError, giving its line number
+// If processing fails, the dosage, haplotype, PLINK, BGEN, rejects and sample list outputs are removed, unless
+// config.CheckpointPath is set, in which case they are kept, to resume from the last checkpoint
+// The statistics summary is only written once every output is complete
+func ReadVcf(ctx context.Context, config *Options, reader *bufio.Reader, writer *bufio.Writer) (err error) {
+	start := time.Now()
+
+	header, metaLines, endOfLineByte, numChars, numHeaderLines, err := readHeader(reader)
+
+	if err != nil {
+		return err
+	}
+
+	allocator := bystroArrow.NewAllocator(nil, config.MaxMemory)
+	writers := outputWriters{tsv: writer, allocator: allocator}
+
+	firstLine := numHeaderLines + 1
+
+	if config.SplitBy != "" {
+		err = splittable(config)
+		if err != nil {
+			return err
+		}
+	}
+
+	var checkpoint *Checkpoint
+	if config.CheckpointPath != "" {
+		err = checkpointable(config)
+		if err != nil {
+			return err
+		}
+
+		if config.Resume {
+			checkpoint, err = ReadCheckpoint(config.CheckpointPath)
+			if err != nil {
+				return err
+			}
+		} else if err := os.Remove(config.CheckpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	if checkpoint != nil {
+		numSkipped, err := reader.Discard(int(checkpoint.InputOffset))
+		if err != nil {
+			return fmt.Errorf("couldn't skip to the checkpoint, at byte %d of the records, after %d: %w",
+				checkpoint.InputOffset, numSkipped, err)
+		}
+
+		firstLine = checkpoint.Line
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		// The outputs are kept until the run is resumed
+		if config.CheckpointPath != "" {
+			writers.close()
+			return
+		}
+
+		writers.abort()
+	}()
+
+	if !config.NoOut && config.SampleListPath != "" {
+		writers.paths = append(writers.paths, config.SampleListPath)
+
+		err = writeSampleListIfWanted(config, header)
+
+		if err != nil {
+			return fmt.Errorf("couldn't write sample list file: %w", err)
+		}
+	}
+
+	var splitDosageSchema *arrow.Schema
+	var splitDosageMetadata map[string]string
+
+	if (config.DosageMatrixOutPath == dosageMatrixStdout || (config.SplitBy != "" && config.DosageMatrixOutPath != "")) &&
+		len(header) <= sampleIdx {
+		log.Print("No samples found in VCF file; skipping dosage matrix output")
+
+		config.DosageMatrixOutPath = ""
+	} else if config.DosageMatrixOutPath != "" {
+		if len(header) <= sampleIdx {
+			log.Print("No samples found in VCF file; writing empty dosage matrix file")
+			// Write empty file
+			_, err = writers.createFile(config.DosageMatrixOutPath)
+			if err != nil {
+				return err
+			}
+
+			config.DosageMatrixOutPath = ""
+		} else {
+			schema := dosageMatrixSchema(config, header)
+			metadata := dosageMatrixMetadata(config, metaLines, len(header)-sampleIdx)
+
+			createWriter := func() (*bystroArrow.ArrowWriter, error) {
+				file, err := writers.createFile(config.DosageMatrixOutPath)
+				if err != nil {
+					return nil, err
+				}
+
+				return bystroArrow.NewArrowIPCFileWriterWithSchema(config.Metrics.countWrites("dosages", file),
+					bystroArrow.WithSchemaMetadata(schema, metadata), ipc.WithZstd())
+			}
+
+			if config.SplitBy != "" {
+				// Each chromosome's dosage matrix is created when it is first written
+				splitDosageSchema = schema
+				splitDosageMetadata = metadata
+			} else if config.DosageMatrixOutPath == dosageMatrixStdout {
+				writers.dosages, err = bystroArrow.NewArrowIPCStreamWriterWithSchema(
+					config.Metrics.countStreamWrites("dosages", os.Stdout),
+					bystroArrow.WithSchemaMetadata(schema, metadata), ipc.WithZstd())
+			} else if checkpoint != nil && checkpoint.DosageBatches > 0 {
+				writers.dosages, err = resumeDosages(config.DosageMatrixOutPath, checkpoint.DosageBatches, createWriter)
+			} else {
+				writers.dosages, err = createWriter()
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if config.SplitBy != "" {
+		writers.shards = &shardWriters{shards: make(map[string]*shard), names: make(map[string]string),
+			finished: make(map[int]bool), config: config, dosageSchema: splitDosageSchema,
+			dosageMetadata: splitDosageMetadata, writers: &writers}
+	}
+
+	if config.SparseDosagePrefix != "" {
+		if len(header) <= sampleIdx {
+			log.Print("No samples found in VCF file; skipping sparse dosage matrix output")
+
+			config.SparseDosagePrefix = ""
+		} else {
+			writers.paths = append(writers.paths, config.SparseDosagePrefix+".samples.feather",
+				config.SparseDosagePrefix+".variants.feather", config.SparseDosagePrefix+".dosages.feather")
+
+			writers.sparse, err = newSparseDosageWriter(config.SparseDosagePrefix, header[sampleIdx:], config.Metrics)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if config.SampleMajorPrefix != "" {
+		if len(header) <= sampleIdx {
+			log.Print("No samples found in VCF file; skipping sample-major dosage matrix output")
+
+			config.SampleMajorPrefix = ""
+		} else {
+			writers.paths = append(writers.paths, config.SampleMajorPrefix+".loci.feather", config.SampleMajorPrefix+".samples.feather")
+
+			writers.sampleMajor, err = newSampleMajorWriter(config.SampleMajorPrefix, header[sampleIdx:])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if config.HaplotypeOutPath != "" {
+		if len(header) <= sampleIdx {
+			log.Print("No samples found in VCF file; writing empty haplotype matrix file")
+			// Write empty file
+			_, err = writers.createFile(config.HaplotypeOutPath)
+			if err != nil {
+				return err
+			}
+
+			config.HaplotypeOutPath = ""
+		} else {
+			fieldNames, fieldTypes := haplotypeMatrixFields(header[sampleIdx:])
+			schema := bystroArrow.NewSchema(fieldNames, fieldTypes, true)
+
+			file, err := writers.createFile(config.HaplotypeOutPath)
+			if err != nil {
+				return err
+			}
+
+			writers.haplotypes, err = bystroArrow.NewArrowIPCFileWriterWithSchema(config.Metrics.countWrites("haplotypes", file),
+				bystroArrow.WithSchemaMetadata(schema, outputMetadata(config, metaLines, len(header)-sampleIdx, haplotypeEncoding)),
+				ipc.WithZstd())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if config.PlinkOutPrefix != "" {
+		if len(header) <= sampleIdx {
+			log.Print("No samples found in VCF file; skipping PLINK output")
+
+			config.PlinkOutPrefix = ""
+		} else {
+			var famRecords map[string]plink.FamRecord
+			if config.FamPath != "" {
+				famRecords, err = plink.ReadFamFile(config.FamPath)
+				if err != nil {
+					return err
+				}
+			}
+
+			writers.paths = append(writers.paths, config.PlinkOutPrefix+".bed", config.PlinkOutPrefix+".bim", config.PlinkOutPrefix+".fam")
+
+			writers.plink, err = plink.NewPlinkWriter(config.PlinkOutPrefix, plink.MakeFamRecords(header[sampleIdx:], famRecords))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if config.BgenOutPath != "" {
+		if len(header) <= sampleIdx {
+			log.Print("No samples found in VCF file; skipping BGEN output")
+
+			config.BgenOutPath = ""
+		} else {
+			compression, err := bgen.ParseCompression(config.BgenCompression)
+			if err != nil {
+				return err
+			}
+
+			// The BgenWriter closes the file itself
+			file, err := os.Create(config.BgenOutPath)
+			if err != nil {
+				return err
+			}
+			writers.paths = append(writers.paths, config.BgenOutPath)
+
+			indexFile, err := writers.createFile(config.BgenOutPath + ".idx")
+			if err != nil {
+				file.Close()
+				return err
+			}
+
+			writers.bgen, err = bgen.NewBgenWriter(file, indexFile, header[sampleIdx:], compression)
+			if err != nil {
+				file.Close()
+				return err
+			}
+		}
+	}
+
+	if config.RejectsPath != "" {
+		file, err := writers.createFile(config.RejectsPath)
+		if err != nil {
+			return err
+		}
+
+		writers.rejects, err = newRejectsWriter(file, config.EmptyField)
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.Metrics != nil {
+		defer config.Metrics.setQueue(nil)
+	}
+
+	var stats *runStats
+	if config.StatsPath != "" {
+		stats = newRunStats()
+	}
+
+	var progress *progressTracker
+	if config.ProgressInterval > 0 {
+		progress = newProgressTracker(os.Stderr, config)
+	}
+
+	if config.CheckpointPath != "" {
+		writers.ordered = newOrderedWriter(writer, writers.dosages, allocator, config, firstLine, checkpoint)
+	}
+
+	err = runWorkers(ctx, reader, endOfLineByte, firstLine, numWorkers(config), progress, func(ctx context.Context, queue <-chan batch) error {
+		return processLines(ctx, header, numChars, config, queue, &writers, stats)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// The input has been read to its end, so its checksum is complete
+	if config.Provenance.InputHash != nil {
+		config.Provenance.InputSHA256 = hex.EncodeToString(config.Provenance.InputHash.Sum(nil))
+
+		err = writers.setMetadata(map[string]string{MetadataInputSHA256: config.Provenance.InputSHA256})
+		if err != nil {
+			return err
+		}
+	}
+
+	if writers.ordered != nil {
+		err = writers.ordered.finish()
+		if err != nil {
+			return err
+		}
+	}
+
+	shards := writers.shards
+
+	err = writers.close()
+	if err != nil {
+		return err
+	}
+
+	if shards != nil {
+		writers.paths = append(writers.paths, config.ManifestPath)
+
+		err = shards.writeManifest(config.ManifestPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The run is complete, so there's nothing to resume
+	if config.CheckpointPath != "" {
+		err = os.Remove(config.CheckpointPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	if stats != nil {
+		stats.PeakArrowBytes = allocator.Peak()
+
+		return stats.write(config.StatsPath, time.Since(start))
+	}
+
+	return nil
+}
+
+// dosageMatrixSchema returns the schema of the dosage matrix of the samples in header: a locus column, followed by
+// the dosages of each sample
+func dosageMatrixSchema(config *Options, header []string) *arrow.Schema {
+	sampleNames := header[sampleIdx:]
+
+	fieldNames := append([]string{"locus"}, sampleNames...)
+
+	fieldTypes := make([]arrow.DataType, len(fieldNames))
+	fieldTypes[0] = arrow.BinaryTypes.String
+	dosageType := arrow.DataType(arrow.PrimitiveTypes.Int8)
+	if expectsExpectedDosages(config) {
+		dosageType = arrow.PrimitiveTypes.Float32
+	}
+
+	for i := 1; i < len(fieldNames); i++ {
+		fieldTypes[i] = dosageType
+	}
+
+	return bystroArrow.NewSchema(fieldNames, fieldTypes, false)
+}
+
+// dosageMatrixMetadata returns the schema metadata of the dosage matrix of numSamples samples
+func dosageMatrixMetadata(config *Options, metaLines []string, numSamples int) map[string]string {
+	encoding := dosageEncoding
+	if expectsExpectedDosages(config) {
+		encoding = fmt.Sprintf(expectedDosageEncoding, config.DosageSource)
+	}
+
+	return outputMetadata(config, metaLines, numSamples, encoding)
+}
+
+// The size of the blocks the input is read in, whose lines are split into batches of up to batchRows rows
+// Blocks grow to hold lines longer than this
+const blockSize = 1 << 20
+const batchRows = 64
+
+// inputBlock is a block of lines read from the input, shared by the batches of its rows
+type inputBlock struct {
+	data []byte
+	// The number of batches using the block, plus one while the reader is
+	refs atomic.Int32
+}
+
+// Blocks read from the input, reused once every batch of their rows is processed
+var blockPool = sync.Pool{New: func() any {
+	return &inputBlock{data: make([]byte, 0, blockSize)}
+}}
+
+func newInputBlock() *inputBlock {
+	block := blockPool.Get().(*inputBlock)
+	block.data = block.data[:0]
+	block.refs.Store(1)
+
+	return block
+}
+
+func (b *inputBlock) release() {
+	if b.refs.Add(-1) == 0 {
+		blockPool.Put(b)
+	}
+}
+
+// batch is a group of consecutive rows read from the input
+type batch struct {
+	// Complete lines, including their line endings
+	data []byte
+	// The block data was read in
+	block         *inputBlock
+	endOfLineByte byte
+	// The number of rows in data
+	numRows int
+	// The line number (1-based) of the first row
+	firstLine int
+	// The position of the batch in the input, counting from 0
+	seq int
+	// The number of bytes in data
+	numBytes int64
+}
+
+// splitRows splits the batch into its rows, each with its line ending, appending them to rows[:0]
+// The rows are slices of the batch's block, so are only valid until release is called
+func (b *batch) splitRows(rows [][]byte) [][]byte {
+	rows = rows[:0]
+
+	for data := b.data; len(data) > 0; {
+		end := bytes.IndexByte(data, b.endOfLineByte) + 1
+		rows = append(rows, data[:end])
+		data = data[end:]
+	}
+
+	return rows
+}
+
+// release lets the batch's block be reused, once nothing refers to its rows
+func (b *batch) release() {
+	if b.block == nil {
+		return
+	}
+
+	b.block.release()
+	b.block = nil
+	b.data = nil
+}
+
+// runWorkers fills a work queue with batches of the rows read from reader, and runs work on
+// concurrency threads to consume it
+// firstLine is the line number of the first row read, used to number the rest
+// The first error returned by work, or encountered while reading, cancels the context given to the rest,
+// and is returned
+// Unless progress is nil, it reports the progress of the reader until the workers finish
+func runWorkers(ctx context.Context, reader *bufio.Reader, endOfLineByte byte, firstLine int, concurrency int,
+	progress *progressTracker, work func(ctx context.Context, queue <-chan batch) error) error {
+	group, ctx := errgroup.WithContext(ctx)
+
+	workQueue := make(chan batch, 16)
+
+	if progress != nil {
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+
+		go func() {
+			defer close(stopped)
+			progress.run(workQueue, stop)
+		}()
+
+		defer func() {
+			close(stop)
+			<-stopped
+		}()
+	}
+
+	// Spawn threads
+	for i := 0; i < concurrency; i++ {
+		group.Go(func() error {
+			return work(ctx, workQueue)
+		})
+	}
+
+	group.Go(func() error {
+		// Indicate to all processing threads that no more work remains
+		defer close(workQueue)
+
+		return fillWorkQueue(ctx, reader, endOfLineByte, firstLine, progress, workQueue)
+	})
+
+	// Wait for everyone to finish.
+	return group.Wait()
+}
+
+// fillWorkQueue reads rows until EOF, sending them to queue in batches, and adding them to progress unless it is nil
+func fillWorkQueue(ctx context.Context, reader *bufio.Reader, endOfLineByte byte, firstLine int, progress *progressTracker,
+	queue chan<- batch) error {
+	block := newInputBlock()
+	lines := batch{endOfLineByte: endOfLineByte, firstLine: firstLine}
+
+	for {
+		// Reading a block at a time, rather than a line at a time, avoids allocating and copying each line
+		n, err := io.ReadFull(reader, block.data[len(block.data):cap(block.data)])
+		block.data = block.data[:len(block.data)+n]
+
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return err
+		}
+
+		// Anything after the last line ending is the start of the next block's first line
+		// At the end of the input, it is an incomplete line, which is skipped
+		end := bytes.LastIndexByte(block.data, endOfLineByte) + 1
+
+		if end == 0 && !eof {
+			// The line is longer than the block
+			block.data = append(block.data, 0)[:len(block.data)]
+			continue
+		}
+
+		for start := 0; start < end; {
+			batchEnd := start
+			numRows := 0
+			for numRows < batchRows && batchEnd < end {
+				batchEnd += bytes.IndexByte(block.data[batchEnd:end], endOfLineByte) + 1
+				numRows++
+			}
+
+			block.refs.Add(1)
+
+			lines.data = block.data[start:batchEnd]
+			lines.block = block
+			lines.numRows = numRows
+			lines.numBytes = int64(batchEnd - start)
+
+			if progress != nil {
+				progress.add(&lines)
+			}
+
+			select {
+			case queue <- lines:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			lines = batch{endOfLineByte: endOfLineByte, firstLine: lines.firstLine + numRows, seq: lines.seq + 1}
+			start = batchEnd
+		}
+
+		if eof {
+			block.release()
+			return nil
+		}
+
+		next := newInputBlock()
+		next.data = append(next.data, block.data[end:]...)
+
+		block.release()
+		block = next
+	}
+}
+
+func writeSampleListIfWanted(config *Options, header []string) error {
+	if config.SampleListPath == "" {
+		return nil
+	}
+
+	outFh, err := os.OpenFile(config.SampleListPath, os.O_WRONLY|os.O_CREATE, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	sList := makeSampleList(header)
+
+	_, err = outFh.WriteString(sList.String())
+
+	if err != nil {
+		return err
+	}
+
+	err = outFh.Sync()
+
+	if err != nil {
+		return err
+	}
+
+	err = outFh.Close()
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func makeSampleList(header []string) bytes.Buffer {
+	var buf bytes.Buffer
+
+	if len(header) < 10 {
+		return buf
+	}
+
+	for i := sampleIdx; i < len(header); i++ {
+		buf.WriteString(header[i])
+		buf.WriteByte(clByte)
+	}
+
+	return buf
+}
+
+func linePasses(record []string, header []string, allowedFilters map[string]bool,
+	excludedFilters map[string]bool) bool {
+	return len(record) == len(header) &&
+		// whitelist: if true it's present in the map
+		(allowedFilters == nil || allowedFilters[record[filterIdx]] == true) &&
+		// blacklist: if false it's not present in the map, and we allow it
+		(excludedFilters == nil || excludedFilters[record[filterIdx]] == false)
+}
+
+func altIsValid(alt string) bool {
+	if len(alt) == 1 {
+		if alt != "A" && alt != "C" && alt != "T" && alt != "G" {
+			return false
+		}
+	} else {
+		// Most common case is <CNV|DUP|DEL>
+		if alt[0] != 'A' && alt[0] != 'C' && alt[0] != 'T' && alt[0] != 'G' {
+			return false
+		}
+
+		for i := 1; i < len(alt); i++ {
+			if alt[i] != 'A' && alt[i] != 'C' && alt[i] != 'T' && alt[i] != 'G' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// processLines decomposes the batches of rows in queue, writing each allele to the outputs in writers
+// Unless stats is nil, the run's statistics are added to it
+func processLines(ctx context.Context, header []string, numChars int, config *Options, queue <-chan batch,
+	writers *outputWriters, stats *runStats) error {
+	// Safe, because the property of having samples is invariant across lines within
+	// a single file
+	var numSamples float64
+	var matrixDosages []any
+	var effectiveSamples float64
+	var locus string
+
+	emptyField := config.EmptyField
+	fieldDelim := config.FieldDelimiter
+	keepID := config.KeepID
+	keepInfo := config.KeepInfo
+	keepPos := config.KeepPos
+	labelPartials := config.LabelPartials
+
+	decomposer := NewDecomposer(header, config)
+
+	var rejections []rejection
+	var workerStats *runStats
+	if stats != nil {
+		workerStats = newRunStats()
+		defer stats.merge(workerStats)
+	}
+
+	// Rejections are logged, unless written to the rejects report
+	reject := func(r rejection) {
+		if workerStats != nil {
+			workerStats.addRejection(r)
+		}
+
+		if config.Metrics != nil && r.reason != reasonNoCarrierNotice {
+			config.Metrics.addRejection(r.reason)
+		}
+
+		if writers.rejects != nil {
+			rejections = append(rejections, r)
+		} else {
+			logRejection(r)
+		}
+	}
+
+	writeRejections := func(line int) error {
+		if len(rejections) == 0 {
+			return nil
+		}
+
+		err := writers.rejects.write(line, rejections)
+		rejections = rejections[:0]
+
+		return err
+	}
+
+	needsLabels := decomposer.Labels
+	needsLocus := decomposer.Dosages || decomposer.Haplotypes
+
+	if len(header) > sampleIdx {
+		numSamples = float64(len(header) - sampleIdx)
+	}
+
+	var output bytes.Buffer
+	// The fields of each row are split into the same slice, as nothing keeps a row's fields once it is written
+	record := make([]string, 0, len(header))
+	var rows [][]byte
+
+	// With checkpoints, the output is written in order, by writers.ordered
+	ordered := writers.ordered
+	var dosageRows [][]any
+
+	var arrowBuilder *bystroArrow.ArrowRowBuilder
+	var err error
+	if writers.dosages != nil && ordered == nil {
+		arrowBuilder, err = writers.newArrowRowBuilder(writers.dosages, 5e3)
+		if err != nil {
+			return err
+		}
+	}
+
+	var sparseVariantBuilder *bystroArrow.ArrowRowBuilder
+	var sparseDosageBuilder *bystroArrow.ArrowRowBuilder
+	if writers.sparse != nil {
+		sparseVariantBuilder, err = writers.newArrowRowBuilder(writers.sparse.variants, 5e3)
+		if err != nil {
+			return err
+		}
+
+		sparseDosageBuilder, err = writers.newArrowRowBuilder(writers.sparse.dosages, 5e4)
+		if err != nil {
+			return err
+		}
+	}
+
+	var haplotypeBuilder *bystroArrow.ArrowRowBuilder
+	if writers.haplotypes != nil {
+		haplotypeBuilder, err = writers.newArrowRowBuilder(writers.haplotypes, 5e3)
+		if err != nil {
+			return err
+		}
+	}
+
+	metrics := config.Metrics
+	var tsvBytes *atomic.Int64
+	if metrics != nil {
+		metrics.setQueue(queue)
+		tsvBytes = metrics.output("tsv")
+	}
+
+	if ordered != nil {
+		ordered.watch(ctx)
+	}
+
+	// When splitting the outputs, each site's are buffered for its chromosome's shard
+	var current *workerShard
+
+	for lines := range queue {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batchStart := time.Now()
+		batchAlleles := 0
+
+		if !config.NoOut && ordered == nil && output.Len() >= 2e6 {
+			writers.tsvMu.Lock()
+
+			_, err = writers.tsv.Write(output.Bytes())
+
+			writers.tsvMu.Unlock()
+
+			if err != nil {
+				return err
+			}
+
+			if tsvBytes != nil {
+				tsvBytes.Add(int64(output.Len()))
+			}
+
+			output.Reset()
+		}
+
+		rows = lines.splitRows(rows)
+
+		for rowIdx, row := range rows {
+			record = splitRecord(row[:len(row)-numChars], record)
+
+			if workerStats != nil && len(record) > 1 {
+				workerStats.addRecord(normalizeChrom(record[chromIdx]), len(row))
+			}
+
+			site, err := decomposer.decompose(record, reject)
+
+			if err != nil {
+				return &RecordError{Line: lines.firstLine + rowIdx, Err: err}
+			}
+
+			if err := writeRejections(lines.firstLine + rowIdx); err != nil {
+				return err
+			}
+
+			if site == nil {
+				continue
+			}
+
+			if workerStats != nil {
+				workerStats.addSite(site)
+			}
+
+			batchAlleles += site.numCarried()
+
+			siteDosages := arrowBuilder
+
+			if writers.shards != nil {
+				if current == nil || current.Chrom != site.Chrom {
+					// Input is usually sorted, so the previous chromosome's rows can be written, rather than held
+					if current != nil {
+						if err := releaseShard(current, writers, tsvBytes); err != nil {
+							return err
+						}
+					}
+
+					current, err = shardFor(writers, site.Chrom)
+					if err != nil {
+						return err
+					}
+				}
+
+				siteDosages = current.dosageBuilder
+				current.lastSeq = lines.seq
+				current.rows.Add(int64(site.numCarried()))
+			}
+
+			// The bases of an MNP share an index, and are written once to the outputs of the VCF's alleles: PLINK and BGEN
+			prevIndex := -1
+
+			for i := range site.Alleles {
+				allele := &site.Alleles[i]
+
+				vcfAllele := allele.Index != prevIndex
+				prevIndex = allele.Index
+
+				var arrowRow []any
+
+				// homozygosity and heterozygosity should be relative to complete genotypes
+				if numSamples > 0 {
+					effectiveSamples = numSamples - float64(len(allele.Missing))
+				}
+
+				// output is [chr, pos, type, ref, alt, trTv, het, heterozygosity, hom, homozygosity, missing, missingness, sampleMaf]
+				// if keepID append id
+				// if keepInfo append [alleleIndex, info]
+
+				if needsLocus {
+					locus = allele.Locus()
+				}
+
+				if writers.dosages != nil || siteDosages != nil {
+					arrowRow = append(arrowRow, locus)
+
+					if numSamples > 0 {
+						if allele.ExpectedDosages != nil {
+							matrixDosages = allele.ExpectedDosages
+						} else {
+							matrixDosages = allele.Dosages
+						}
+
+						arrowRow = append(arrowRow, matrixDosages...)
+					}
+
+					if ordered != nil {
+						dosageRows = append(dosageRows, arrowRow)
+					} else if err = siteDosages.WriteRow(arrowRow); err != nil {
+						return &RecordError{Line: lines.firstLine + rowIdx, Err: err}
+					}
+				}
+
+				// Alleles no sample carries are only kept for their imputed dosages
+				if allele.NoCarrier {
+					continue
+				}
+
+				if writers.sparse != nil && numSamples > 0 {
+					err = writers.sparse.writeVariant(sparseVariantBuilder, sparseDosageBuilder, locus, allele.Dosages)
+					if err != nil {
+						return &RecordError{Line: lines.firstLine + rowIdx, Err: err}
+					}
+				}
+
+				if writers.sampleMajor != nil && numSamples > 0 {
+					err = writers.sampleMajor.writeVariant(locus, allele.Dosages)
+					if err != nil {
+						return &RecordError{Line: lines.firstLine + rowIdx, Err: err}
+					}
+				}
+
+				if haplotypeBuilder != nil && numSamples > 0 {
+					err = haplotypeBuilder.WriteRow(haplotypeRow(locus, allele.Haplotypes))
+					if err != nil {
+						return &RecordError{Line: lines.firstLine + rowIdx, Err: err}
+					}
+				}
+
+				// PLINK joins variants on the VCF's POS, REF and ALT, rather than on the decomposed allele
+				if writers.plink != nil && numSamples > 0 && vcfAllele {
+					err = writers.plink.WriteVariant(site.Chrom, site.Pos, allele.VcfLocus(), site.Record[refIdx],
+						allele.VcfAlt(), allele.Dosages, site.Ploidy)
+					if errors.Is(err, plink.ErrNotDiploid) {
+						reject(rejection{site.Record[chromIdx], site.Pos, site.Record[refIdx], allele.VcfAlt(), allele.Index,
+							reasonPloidyError})
+					} else if err != nil {
+						return &RecordError{Line: lines.firstLine + rowIdx, Err: err}
+					}
+				}
+
+				// As for PLINK, BGEN variants are the VCF's alleles
+				if writers.bgen != nil && numSamples > 0 && vcfAllele {
+					intPos, err := strconv.ParseUint(site.Pos, 10, 32)
+					if err != nil {
+						log.Printf("%s:%s ALT #%d %s; skipping BGEN output", site.Chrom, site.Pos, allele.Index+1, posError)
+					} else {
+						variant := bgen.Variant{
+							ID:      allele.VcfLocus(),
+							RSID:    site.ID,
+							Chrom:   site.Chrom,
+							Pos:     uint32(intPos),
+							Alleles: [2]string{site.Record[refIdx], allele.VcfAlt()},
+						}
+
+						genotypes := bgen.Genotypes{
+							Alleles: allele.Haplotypes.Alleles,
+							Ploidy:  allele.Haplotypes.Ploidy,
+							Phased:  allele.Haplotypes.AllPhased(),
+						}
+
+						err = writers.bgen.WriteVariant(variant, genotypes)
+						if err != nil {
+							return &RecordError{Line: lines.firstLine + rowIdx, Err: err}
+						}
+					}
+				}
+
+				if needsLabels {
+					output.WriteString(site.Chrom)
+					output.WriteByte(tabByte)
+
+					output.WriteString(allele.Pos)
+					output.WriteByte(tabByte)
+
+					output.WriteString(site.Type)
+					output.WriteByte(tabByte)
+
+					output.WriteString(allele.Ref)
+					output.WriteByte(tabByte)
+
+					output.WriteString(allele.Alt)
+					output.WriteByte(tabByte)
+
+					if site.Type == parse.Multi {
+						output.WriteString(parse.NotTrTv)
+					} else {
+						output.WriteString(parse.GetTrTv(allele.Ref, allele.Alt))
+					}
+
+					output.WriteByte(tabByte)
+
+					// Write missing samples
+					// heterozygotes \t heterozygosity
+					if len(allele.Heterozygotes) == 0 {
+						output.WriteString(emptyField)
+						output.WriteByte(tabByte)
+						output.WriteByte(zeroByte)
+					} else {
+						output.WriteString(strings.Join(allele.Heterozygotes, fieldDelim))
+						output.WriteByte(tabByte)
+
+						// This gives plenty precision; we are mostly interested in
+						// the first or maybe 2-3 significant digits
+						// https://play.golang.org/p/Ux-QmClaJG
+						// Also, gnomAD seems to use 6 bits of precision
+						// the bitSize == 64 allows us to round properly past 6 s.f
+						// Note: 'G' requires these numbers to be < 0 for proper precision
+						// (elase only 6 s.f total, rather than after decimal)
+						output.WriteString(strconv.FormatFloat(float64(len(allele.Heterozygotes))/effectiveSamples, 'G', precision, 64))
+					}
+
+					output.WriteByte(tabByte)
+
+					// Write missing samples
+					// homozygotes \t homozygosity
+					if len(allele.Homozygotes) == 0 {
+						output.WriteString(emptyField)
+						output.WriteByte(tabByte)
+						output.WriteByte(zeroByte)
+					} else {
+						output.WriteString(strings.Join(allele.Homozygotes, fieldDelim))
+						output.WriteByte(tabByte)
+						output.WriteString(strconv.FormatFloat(float64(len(allele.Homozygotes))/effectiveSamples, 'G', precision, 64))
+					}
+
+					output.WriteByte(tabByte)
+
+					// Write missing samples
+					// missingGenos \t missingness
+					if len(allele.Missing) == 0 {
+						output.WriteString(emptyField)
+						output.WriteByte(tabByte)
+						output.WriteByte(zeroByte)
+					} else {
+						output.WriteString(strings.Join(allele.Missing, fieldDelim))
+						output.WriteByte(tabByte)
+						output.WriteString(strconv.FormatFloat(float64(len(allele.Missing))/numSamples, 'G', precision, 64))
+					}
+
+					// Write the sample minor allele frequency
+					output.WriteByte(tabByte)
+
+					output.WriteString(strconv.Itoa(allele.AC))
+					output.WriteByte(tabByte)
+					output.WriteString(strconv.Itoa(allele.AN))
+					output.WriteByte(tabByte)
+
+					// TODO: can ac == 0 && (len(het) > 0 || len(hom) > 0) occur?
+					if allele.AC == 0 {
+						output.WriteByte(zeroByte)
+					} else {
+						output.WriteString(strconv.FormatFloat(float64(allele.AC)/float64(allele.AN), 'G', precision, 64))
+					}
+
+					/******************* Optional Fields ***********************/
+					if keepPos == true {
+						output.WriteByte(tabByte)
+						output.WriteString(site.Pos)
+					}
+
+					if keepID == true {
+						output.WriteByte(tabByte)
+						output.WriteString(site.ID)
+					}
+
+					if keepInfo == true {
+						// Write the index of the allele, to allow users to segregate data in the INFO field
+						output.WriteByte(tabByte)
+						output.WriteString(strconv.Itoa(allele.Index))
+
+						// Write info for all indices
+						output.WriteByte(tabByte)
+						output.WriteString(site.Info)
+					}
+
+					if labelPartials == true {
+						// partial samples \t partiality
+						output.WriteByte(tabByte)
+
+						if len(allele.Partials) == 0 {
+							output.WriteString(emptyField)
+							output.WriteByte(tabByte)
+							output.WriteByte(zeroByte)
+						} else {
+							output.WriteString(strings.Join(allele.Partials, fieldDelim))
+							output.WriteByte(tabByte)
+							output.WriteString(strconv.FormatFloat(float64(len(allele.Partials))/effectiveSamples, 'G', precision, 64))
+						}
+					}
+
+					output.WriteByte(clByte)
+				}
+
+			}
+
+			// Alleles left out of an output are rejected as they are written
+			if err := writeRejections(lines.firstLine + rowIdx); err != nil {
+				return err
+			}
+
+			if current != nil && output.Len() > 0 {
+				current.output.Write(output.Bytes())
+				output.Reset()
+
+				if current.output.Len() >= 2e6 {
+					if err := flushShard(current, tsvBytes); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if ordered != nil {
+			if tsvBytes != nil {
+				tsvBytes.Add(int64(output.Len()))
+			}
+
+			err = ordered.commit(ctx, lines, output.Bytes(), dosageRows)
+			if err != nil {
+				return err
+			}
+
+			output.Reset()
+			dosageRows = nil
+		}
+
+		if metrics != nil {
+			metrics.addBatch(lines.numRows, batchAlleles, time.Since(batchStart))
+		}
+
+		// Nothing refers to the rows' fields past here, so the block can be reused
+		lines.release()
+
+		if writers.shards != nil {
+			if err := writers.shards.finishBatch(lines.seq); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !config.NoOut && output.Len() > 0 {
+		writers.tsvMu.Lock()
+
+		_, err = writers.tsv.Write(output.Bytes())
+
+		writers.tsvMu.Unlock()
+
+		if err != nil {
+			return err
+		}
+
+		if tsvBytes != nil {
+			tsvBytes.Add(int64(output.Len()))
+		}
+	}
+
+	if arrowBuilder != nil {
+		err = arrowBuilder.Release()
+		if err != nil {
+			return err
+		}
+	}
+
+	if current != nil {
+		if err := releaseShard(current, writers, tsvBytes); err != nil {
+			return err
+		}
+	}
+
+	if writers.sparse != nil {
+		err = sparseVariantBuilder.Release()
+		if err != nil {
+			return err
+		}
+
+		err = sparseDosageBuilder.Release()
+		if err != nil {
+			return err
+		}
+	}
+
+	if haplotypeBuilder != nil {
+		err = haplotypeBuilder.Release()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAlleles splits the ALT field of a record into its decomposed alleles, returning the site type, and the position,
+// reference base, allele and ALT index of each allele
+// Rejected alleles are logged
+func GetAlleles(chrom string, pos string, ref string, alt string) (string, []string, []byte, []string, []int) {
+	return getAlleles(chrom, pos, ref, alt, logRejection)
+}
+
+// getAlleles is GetAlleles, calling reject with each rejected allele, or with the record if it is rejected as a whole
+func getAlleles(chrom string, pos string, ref string, alt string, reject func(rejection)) (string, []string, []byte, []string, []int) {
+	// Indel format:
+	// Deletion: -N : "-" followed by # of deleted bases (inclusive of ref)
+	// Insertion: \+[ATCG]+ : "+" followed by the inserted bases, which occur after the ref
+	// ref is always 1 base,  which follows from not requiring deletions to have a ACTG base
+
+	if alt == ref {
+		reject(rejection{chrom, pos, ref, alt, 0, reasonSameError})
+		return "", nil, nil, nil, nil
+	}
+
+	// optimize for the cases where no "," could be present, i.e len(alt) == 1
+	if len(alt) == 1 {
+		if alt != "A" && alt != "C" && alt != "G" && alt != "T" {
+			reject(rejection{chrom, pos, ref, alt, 0, reasonBadAltError})
+
+			return "", nil, nil, nil, nil
+		}
+
+		if len(ref) == 1 {
+			return parse.Snp, []string{pos}, []byte{ref[0]}, []string{alt}, []int{0}
+		}
+
+		// simple deletion must have 1 base padding match
+		if alt[0] != ref[0] {
+			reject(rejection{chrom, pos, ref, alt, 0, reasonDelError1})
+			return "", nil, nil, nil, nil
+		}
+
+		intPos, err := strconv.Atoi(pos)
+
+		if err != nil {
+			reject(rejection{chrom, pos, ref, alt, 0, reasonPosError})
+			return "", nil, nil, nil, nil
+		}
+
+		// pos is the next base over (first deleted base)
+		// ref is also the first deleted base, since alt is of 1 padding, that's idx 1 (2nd ref base)
+		// alt == len(alt) - len(ref) for len(alt) < len(ref)
+		// example: alt = A (len == 1), ref = AAATCC (len == 6)
+		// 1 - 6 = -5 (then conver to string)
+		return parse.Del, []string{strconv.Itoa(intPos + 1)}, []byte{ref[1]}, []string{strconv.Itoa(1 - len(ref))}, []int{0}
+	}
+
+	var intPos int
+
+	var alleles []string
+	var references []byte
+	var positions []string
+	var indexes []int
+	var multi bool
+	for altIdx, tAlt := range strings.Split(alt, ",") {
+		// It can be a MULTIALLELIC and have errors that
+		// reduce output allele count to 1, so record here
+		if !multi && altIdx > 0 {
+			multi = true
+		}
+
+		if altIsValid(tAlt) == false {
+			reject(rejection{chrom, pos, ref, tAlt, altIdx, reasonBadAltError})
+			continue
+		}
+
+		if len(ref) == 1 {
+			if len(tAlt) == 1 {
+				//tAlt isn't modified
+				positions = append(positions, pos)
+				references = append(references, ref[0])
+				alleles = append(alleles, tAlt)
+				indexes = append(indexes, altIdx)
+				continue
+			}
+
+			// Simple insertion : tAlt > 1 base, and ref == 1 base
+			if tAlt[0] != ref[0] {
+				reject(rejection{chrom, pos, ref, tAlt, altIdx, reasonInsError1})
+				continue
+			}
+
+			// we take the allele from the 2nd base, since insertion occurs after the reference
+			var buffer bytes.Buffer
+			buffer.WriteString("+")
+			buffer.WriteString(tAlt[1:])
+
+			// simple insertion; our annotations also use 1 base padding for insertions, so keep pos same
+			positions = append(positions, pos)
+			// since pos same, ref is just the first (only) base
+			references = append(references, ref[0])
+			alleles = append(alleles, buffer.String())
+			indexes = append(indexes, altIdx)
+
+			continue
+		}
+
+		// len(ref) > 1
+
+		// If given 0-based file, this will be re-generated potentially
+		// Notice we exit the loop here; position is invalid, should leave
+		// We convert Atoi here to avoid wasting performance
+		if intPos == 0 {
+			var err error
+			intPos, err = strconv.Atoi(pos)
+
+			if err != nil {
+				reject(rejection{chrom, pos, ref, alt, -1, reasonPosError})
+				break
+			}
+		}
+
+		if len(tAlt) == 1 {
+			// Simple deletion, padding of 1 base, padding must match
+			if tAlt[0] != ref[0] {
+				reject(rejection{chrom, pos, ref, tAlt, altIdx, reasonDelError1})
+				continue
+			}
+
+			// 1 base deletion; we use 0 padding for deletions, showing 1st deleted base
+			// as ref; so shift pos, ref by 1, return len(ref) - 1 for alt
+			positions = append(positions, strconv.Itoa(intPos+1))
+			references = append(references, ref[1])
+			alleles = append(alleles, strconv.Itoa(1-len(ref)))
+			indexes = append(indexes, altIdx)
+
+			continue
+		}
+
+		// If we're here, ref and alt are both > 1 base long
+		// could be a weird SNP (multiple bases are SNPS, len(ref) == len(alt))
+		// could be a weird deletion/insertion
+		// could be a completely normal multiallelic (due to padding, shifted)
+
+		//1st check for MNPs and extra-padding SNPs
+		if len(ref) == len(tAlt) {
+			// Let's check each base; if there is more than 1 change, this is an MNP
+			// whether a sparse MNP or not.
+			// We'll report each modified base
+			for i := 0; i < len(ref); i++ {
+				if ref[i] != tAlt[i] {
+					positions = append(positions, strconv.Itoa(intPos+i))
+					references = append(references, ref[i])
+					alleles = append(alleles, string(tAlt[i]))
+
+					// Here we append the index of the VCF ALT, not the MNP idx
+					// all bases in an MNP will have the same index
+					// else we won't be able to determine homozygous, heterozygous, reference status
+					indexes = append(indexes, altIdx)
+				}
+			}
+
+			continue
+		}
+
+		// Find the allele representation that minimizes padding, while still checking
+		// that the site isn't a mixed type (indel + snp) and checking for intercolation
+		// Essentially, Occam's Razor for padding: minimize the number of steps away
+		// from left edge to explan the allele
+		// EX:
+		// If ref == AATCG
+		// If alt == AG
+		// One interpretation of this site is mixed A->G -3 (-TCG)
+		// Another is -3 (-ATC) between the A (0-index) and G (4-index) in ref
+		// We prefer the latter approach
+		// Ex2: ref: TT alt: TCGATT
+		// We prefer +CGAT
+
+		// Like http://www.cureffi.org/2014/04/24/converting-genetic-variants-to-their-minimal-representation/
+		// we will use a simple heuristic:
+		// 1) For insertions, figure out the shared right edge, from 1 base downstream of first ref base
+		// Then, check if the remaining ref bases match the left edge of the alt
+		// If they don't, skip that site
+		// 2) For deletions, the same, except replace the role of ref with the tAlt
+
+		// Our method should be substantially faster, since we don't need to calculate
+		// the min(len(ref), len(tAlt))
+		// and because we don't create a new slice for every shared ref/alt at right edges and left
+
+		if len(tAlt) > len(ref) {
+			rIdx := 0
+			// we won't allow the entire ref to match as a suffix, only up to 1 base downstream from beginning of ref
+			for len(tAlt)+rIdx > 0 && len(ref)+rIdx > 1 && tAlt[len(tAlt)+rIdx-1] == ref[len(ref)+rIdx-1] {
+				rIdx--
+			}
+
+			// Then, we require an exact match from left edge, for the difference between the
+			// length of the ref, and the shared suffix
+			// Ex: alt: TAGCTT ref: TAT
+			// We shared 1 base at right edge, so expect that len(ref) - 1, or 3 - 1 = 2 bases of ref
+			// match the left edge of alt
+			// Here that is TA, for an insertion of +GCT
+			// Ex2: alt: TAGCAT ref: TAT
+			// Here the AT of the ref matches the last 2 bases of alt
+			// So we expect len(ref) - 2 == 1 base of ref to match left edge of the alt (T), for +AGC
+			// Ex3: alt TAGTAT ref: TAT
+			// Since our loop doesn't check the last base of ref, as in ex2, +AGC
+			// This mean we always prefer a 1-base padding, when possible
+			// Ex4: alt TAGTAT ref: TGG
+			// In this case, we require len(ref) - 0 bases in the ref to match left edge of alt
+			// Since they don't (TAG != TGG), we call this complex and move on
+
+			// Insertion
+			// If pos is 100 and ref is AATCG
+			// and alt is AAAAATCG (len == 7)
+			// we expect lIdx to be 2
+			// and rIdx to be -3
+			// alt[2] is the first non-ref base
+			// and alt[len(alt) - 3] == alt[4] is the last non-ref base
+			// The position is intPos + lIdx or 100 + 2 - 1 == 101 (100, 101 are padding bases,
+			// and we want to keep the last reference base
+			// The ref is ref[2 - 1] or ref[1]
+			offset := len(ref) + rIdx
+			if ref[:offset] != tAlt[:offset] {
+				reject(rejection{chrom, pos, ref, tAlt, altIdx, reasonMixedError})
+				continue
+			}
+
+			// position is offset by len(ref) + 1 - rIdx
+			// ex1: alt: TAGCTT ref: TAT
+			// here we match the first base, so -1
+			// we require remainder of left edge to be present,
+			// or len(ref) - 1 == 2
+			// so intPos + 2 - 1 for last padding base (the A in TA) (intPos + 2 is first unique base)
+			positions = append(positions, strconv.Itoa(intPos+offset-1))
+			references = append(references, ref[offset-1])
+
+			// Similarly, the alt allele starts from len(ref) + rIdx, and ends at len(tAlt) + rIdx
+			// from ex: TAGCTT ref: TAT :
+			// rIdx == -1 , real alt == tAlt[len(ref) - 1:len(tAlt) - 1] == tALt[2:5]
+			var insBuffer bytes.Buffer
+			insBuffer.WriteString("+")
+			insBuffer.WriteString(tAlt[offset : len(tAlt)+rIdx])
+
+			alleles = append(alleles, insBuffer.String())
+			indexes = append(indexes, altIdx)
+
+			continue
+		}
+
+		// Deletion
+		// If pos is 100 and alt is AATCG
+		// and ref is AAAAATCG (len == 7)
+		// we expect lIdx to be 2
+		// and rIdx to be -3
+		// and alt is -3 or len(ref) + rIdx - lIdx == 8 + -3 - 2
+		// position is the first deleted base, or intPos + lIdx == 100 + 2 == 102
+		// where (100, 101) are the two padding bases
+		// ref is the first deleted base or ref[lIdx] == ref[2]
+
+		// Just like insertion, but try to match all bases from 1 base downstream of tAlt to ref
+		rIdx := 0
+		// we won't allow the enitre ALT to match as a suffix
+		// this is the inverse of the insertion case
+		// can have an intercolated deletion, where some bases in middle of deletion are missing w.r.t ref
+		// or deletions where teh entire left edge of the alt match the ref
+		for len(tAlt)+rIdx > 1 && len(ref)+rIdx > 0 && tAlt[len(tAlt)+rIdx-1] == ref[len(ref)+rIdx-1] {
+			rIdx--
+		}
+
+		//ex: if post: 100 alt: AATCG and ref: AAAAATCG, we expect deletion to
+		//occurs on base 101, alt: -AAAA == -4 == -(len(ref) - 3 - (len(tAlt) - 3)) == -8 - 3 - 2 = -3
+		//rIdx is 3 since matches 3 bases
+		//position gets shifted by len(tAlt) + rIdx, since we don't want any padding in our output
+		offset := len(tAlt) + rIdx
+		if ref[:offset] != tAlt[:offset] {
+			reject(rejection{chrom, pos, ref, tAlt, altIdx, reasonMixedError})
+			continue
+		}
+
+		positions = append(positions, strconv.Itoa(intPos+offset))
+		// we want the base after the last shared
+		references = append(references, ref[offset])
+
+		// the allele if -(len(ref) + rIdx - (len(tAlt) + rIdx))
+		alleles = append(alleles, strconv.Itoa(-(len(ref) + rIdx - offset)))
+		indexes = append(indexes, altIdx)
+
+		continue
+	}
+
+	// Any of the logged errors generated in loop
+	// This method saves us having to build up an "errors" slice
+	// While still allowing us to report/log bases
+	if len(alleles) == 0 {
+		return "", nil, nil, nil, nil
+	}
+
+	// MULTI is basically the presence of a comma
+	// We don't just look at the length of the resulting alleles or references or indexes
+	// slices, because these can include MNPs, which expand the array size, but are
+	// somewhat distinct in their meaning
+	if multi {
+		return parse.Multi, positions, references, alleles, indexes
+	}
+
+	// Anything below here is guaranteed to be a single allele from the VCF file
+	// whether that is an MNP, DEL, INS, or SNP
+	if len(alleles[0]) > 1 {
+		if alleles[0][0] == '-' {
+			return parse.Del, positions, references, alleles, indexes
+		}
+
+		return parse.Ins, positions, references, alleles, indexes
+	}
+
+	// MNPs result in multiple alleles
+	// They may be sparse or complete, so we empirically check for their presence
+	// If the MNP is really just a snp, there is only 1 allele, and reduces to snp
+	// > 1, these are labeled differently to allow people to jointly consider the effects
+	// of the array of SNPs, since we at the moment consider their effects only independently
+	// (which has advantages for CADD, phyloP, phastCons, clinvar, etc reporting)
+	if len(alleles) > 1 {
+		return parse.Mnp, positions, references, alleles, indexes
+	}
+
+	// MNPs and SNPs are both labeled SNP
+	return parse.Snp, positions, references, alleles, indexes
+}
+
+// Haplotypes holds the per-haplotype calls of every sample at a site, with respect to a single alt allele
+// Alleles is flat, in sample order: sample i contributes Ploidy[i] calls
+type Haplotypes struct {
+	// 1 if the haplotype carries the alt allele, 0 if it doesn't, -1 if missing
+	Alleles []int8
+	Ploidy  []uint8
+	Phased  []bool
+}
+
+func newHaplotypes(numSamples int) *Haplotypes {
+	return &Haplotypes{
+		Alleles: make([]int8, 0, 2*numSamples),
+		Ploidy:  make([]uint8, 0, numSamples),
+		Phased:  make([]bool, 0, numSamples),
+	}
+}
+
+// AllPhased returns true if every sample's genotype is phased, not counting samples with a missing allele, whose
+// phase is meaningless, e.g. ./.
+func (h *Haplotypes) AllPhased() bool {
+	hapIdx := 0
+	for i, phased := range h.Phased {
+		alleles := h.Alleles[hapIdx : hapIdx+int(h.Ploidy[i])]
+		hapIdx += int(h.Ploidy[i])
+
+		if phased {
+			continue
+		}
+
+		missing := false
+		for _, allele := range alleles {
+			if allele == -1 {
+				missing = true
+				break
+			}
+		}
+
+		if !missing {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sparseDosageWriter writes the dosage matrix in coordinate (COO) format, as 3 Arrow files:
+// {prefix}.variants.feather: variantIdx (uint32), locus (string)
+// {prefix}.dosages.feather: variantIdx (uint32), sampleIdx (uint32), dosage (int8), for non-zero dosages only
+// (missing genotypes, with a dosage of -1, are kept)
+// {prefix}.samples.feather: sampleIdx (uint32), sample (string)
+// This writing operation is threadsafe.
+type sparseDosageWriter struct {
+	variants    *bystroArrow.ArrowWriter
+	dosages     *bystroArrow.ArrowWriter
+	files       []*os.File
+	numVariants atomic.Uint32
+}
+
+func newSparseDosageWriter(prefix string, sampleNames []string, metrics *Metrics) (*sparseDosageWriter, error) {
+	sw := &sparseDosageWriter{}
+
+	samplesFile, err := os.Create(prefix + ".samples.feather")
+	if err != nil {
+		return nil, err
+	}
+	defer samplesFile.Close()
+
+	samplesWriter, err := bystroArrow.NewArrowIPCFileWriter(samplesFile, []string{"sampleIdx", "sample"},
+		[]arrow.DataType{arrow.PrimitiveTypes.Uint32, arrow.BinaryTypes.String}, false, ipc.WithZstd())
+	if err != nil {
+		return nil, err
+	}
+
+	samplesBuilder, err := bystroArrow.NewArrowRowBuilder(samplesWriter, len(sampleNames))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, name := range sampleNames {
+		if err := samplesBuilder.WriteRow([]any{uint32(i), name}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := samplesBuilder.Release(); err != nil {
+		return nil, err
+	}
+
+	if err := samplesWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	variantsFile, err := os.Create(prefix + ".variants.feather")
+	if err != nil {
+		return nil, err
+	}
+	sw.files = append(sw.files, variantsFile)
+
+	sw.variants, err = bystroArrow.NewArrowIPCFileWriter(metrics.countWrites("sparseVariants", variantsFile), []string{"variantIdx", "locus"},
+		[]arrow.DataType{arrow.PrimitiveTypes.Uint32, arrow.BinaryTypes.String}, false, ipc.WithZstd())
+	if err != nil {
+		return nil, err
+	}
+
+	dosagesFile, err := os.Create(prefix + ".dosages.feather")
+	if err != nil {
+		return nil, err
+	}
+	sw.files = append(sw.files, dosagesFile)
+
+	sw.dosages, err = bystroArrow.NewArrowIPCFileWriter(metrics.countWrites("sparseDosages", dosagesFile), []string{"variantIdx", "sampleIdx", "dosage"},
+		[]arrow.DataType{arrow.PrimitiveTypes.Uint32, arrow.PrimitiveTypes.Uint32, arrow.PrimitiveTypes.Int8}, false, ipc.WithZstd())
+	if err != nil {
+		return nil, err
+	}
+
+	return sw, nil
+}
+
+// writeVariant assigns the next variant index to locus, and writes the locus and its
+// non-zero dosages through the calling thread's builders
+func (sw *sparseDosageWriter) writeVariant(variantBuilder *bystroArrow.ArrowRowBuilder, dosageBuilder *bystroArrow.ArrowRowBuilder,
+	locus string, dosages []any) error {
+	variantIdx := sw.numVariants.Add(1) - 1
+
+	if err := variantBuilder.WriteRow([]any{variantIdx, locus}); err != nil {
+		return err
+	}
+
+	for i, dosage := range dosages {
+		if dosage.(int8) == 0 {
+			continue
+		}
+
+		if err := dosageBuilder.WriteRow([]any{variantIdx, uint32(i), dosage}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes the variant and dosage files. All builders must be released first
+func (sw *sparseDosageWriter) Close() error {
+	var firstErr error
+	for _, err := range []error{sw.variants.Close(), sw.dosages.Close()} {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, file := range sw.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// haplotypeMatrixFields returns the haplotype matrix schema: the locus, followed by
+// two int8 columns per sample, {sample}_hap0 and {sample}_hap1
+func haplotypeMatrixFields(sampleNames []string) ([]string, []arrow.DataType) {
+	fieldNames := make([]string, 0, 1+2*len(sampleNames))
+	fieldTypes := make([]arrow.DataType, 0, 1+2*len(sampleNames))
+
+	fieldNames = append(fieldNames, "locus")
+	fieldTypes = append(fieldTypes, arrow.BinaryTypes.String)
+
+	for _, name := range sampleNames {
+		fieldNames = append(fieldNames, name+"_hap0", name+"_hap1")
+		fieldTypes = append(fieldTypes, arrow.PrimitiveTypes.Int8, arrow.PrimitiveTypes.Int8)
+	}
+
+	return fieldNames, fieldTypes
+}
+
+// haplotypeRow creates a haplotype matrix row: 1 if the haplotype carries the alt allele, 0 if not,
+// and nil if missing
+// Haploid samples have a nil hap1, and samples with a ploidy above 2 are written as missing
+func haplotypeRow(locus string, haplotypes *Haplotypes) []any {
+	row := make([]any, 1, 1+2*len(haplotypes.Ploidy))
+	row[0] = locus
+
+	hapIdx := 0
+	for _, ploidy := range haplotypes.Ploidy {
+		calls := haplotypes.Alleles[hapIdx : hapIdx+int(ploidy)]
+		hapIdx += int(ploidy)
+
+		if ploidy > 2 {
+			row = append(row, nil, nil)
+			continue
+		}
+
+		for hap := 0; hap < 2; hap++ {
+			if hap >= len(calls) || calls[hap] == -1 {
+				row = append(row, nil)
+				continue
+			}
+
+			row = append(row, calls[hap])
+		}
+	}
+
+	return row
+}
+
+// MakeHetHomozygotes process all sample genotype fields, and for a single alleleNum, which is the allele index (1 based)
+// returns the homozygotes, heterozygotes, partial samples, missing samples, dosages, haplotypes, total alt counts, and genotype counts
+// haplotypes is only returned when needsHaplotypes is true
+// When labelPartials is true, polyploid (ploidy > 2) samples whose alleleNum dosage is less than half their ploidy,
+// e.g. 0/0/0/1 or 0/0/1, are labeled partial, rather than heterozygous. Those carrying it on at least half of their
+// haplotypes, e.g. 0/0/1/1 or 0/1/1/1, stay heterozygous, as a diploid 0/1 is
+// Dosages and genotype counts follow each sample's ploidy, e.g. 0/1/1/1 has a dosage of 3, and contributes 4 to the genotype count
+// Each call parses every sample's genotype; Decomposer parses them once for all the alleles of a site
+func MakeHetHomozygotes(fields []string, header []string, alleleNum string, needsLabels bool, needsDosages bool, needsHaplotypes bool,
+	labelPartials bool) ([]string, []string, []string, []string, []any, *Haplotypes, int, int) {
+	numSamples := len(header) - sampleIdx
+
+	num, err := strconv.Atoi(alleleNum)
+	if err != nil || num < 1 {
+		// Matches no allele
+		num = 0
+	}
+
+	var genotypes siteGenotypes
+	genotypes.parse(fields, numSamples, num)
+
+	return genotypes.summarize(num, header, needsLabels, needsDosages, needsHaplotypes, labelPartials)
+}
@@ -0,0 +1,4146 @@
+package vcf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	bystroArrow "github.com/bystrogenomics/bystro-vcf/arrow"
+)
+
+func TestHeader(t *testing.T) {
+	config := Options{KeepID: false, KeepInfo: false}
+
+	header := StringHeader(&config)
+
+	expected := strings.Join([]string{"chrom", "pos", "type", "ref", "alt", "trTv", "heterozygotes",
+		"heterozygosity", "homozygotes", "homozygosity", "missingGenos", "missingness", "ac", "an", "sampleMaf"}, "\t")
+
+	if header == expected {
+		t.Log("OK: print header", header, expected)
+	} else {
+		t.Error("NOT OK: print header", header, expected)
+	}
+
+	config = Options{KeepPos: true, KeepID: false, KeepInfo: false}
+
+	header = StringHeader(&config)
+
+	expected = strings.Join([]string{"chrom", "pos", "type", "ref", "alt", "trTv", "heterozygotes",
+		"heterozygosity", "homozygotes", "homozygosity", "missingGenos", "missingness", "ac", "an", "sampleMaf", "vcfPos"}, "\t")
+
+	if header == expected {
+		t.Log("OK: print header with --keepPos true", header, expected)
+	} else {
+		t.Error("NOT OK: print header with --keepPostrue true", header, expected)
+	}
+
+	config = Options{KeepPos: true, KeepID: true, KeepInfo: false}
+
+	header = StringHeader(&config)
+
+	expected = strings.Join([]string{"chrom", "pos", "type", "ref", "alt", "trTv", "heterozygotes",
+		"heterozygosity", "homozygotes", "homozygosity", "missingGenos", "missingness", "ac", "an", "sampleMaf", "vcfPos", "id"}, "\t")
+
+	if header == expected {
+		t.Log("OK: print header with --keepId true", header, expected)
+	} else {
+		t.Error("NOT OK: print header with --keepId true", header, expected)
+	}
+
+	config = Options{KeepPos: false, KeepID: false, KeepInfo: true}
+
+	header = StringHeader(&config)
+
+	expected = strings.Join([]string{"chrom", "pos", "type", "ref", "alt", "trTv", "heterozygotes",
+		"heterozygosity", "homozygotes", "homozygosity", "missingGenos", "missingness", "ac", "an",
+		"sampleMaf", "alleleIdx", "info"}, "\t")
+
+	if header == expected {
+		t.Log("OK: print header with --keepInfo true", header, expected)
+	} else {
+		t.Error("NOT OK: print header with --keepInfo true", header, expected)
+	}
+
+	config = Options{KeepPos: false, KeepID: true, KeepInfo: true}
+
+	header = StringHeader(&config)
+
+	expected = strings.Join([]string{"chrom", "pos", "type", "ref", "alt", "trTv", "heterozygotes",
+		"heterozygosity", "homozygotes", "homozygosity", "missingGenos", "missingness", "ac", "an",
+		"sampleMaf", "id", "alleleIdx", "info"}, "\t")
+
+	if header == expected {
+		t.Log("OK: print header with -keepID true --keepInfo true", header)
+	} else {
+		t.Error("NOT OK: print header with --keepId true --keepInfo true", header)
+	}
+
+	config = Options{KeepPos: true, KeepID: true, KeepInfo: true}
+
+	header = StringHeader(&config)
+
+	expected = strings.Join([]string{"chrom", "pos", "type", "ref", "alt", "trTv", "heterozygotes",
+		"heterozygosity", "homozygotes", "homozygosity", "missingGenos", "missingness", "ac", "an",
+		"sampleMaf", "vcfPos", "id", "alleleIdx", "info"}, "\t")
+
+	if header == expected {
+		t.Log("OK: print header with --keepPos true --keepId true --keepInfo true", header)
+	} else {
+		t.Error("NOT OK: print header with --keepId true --keepInfo true", header)
+	}
+
+	config = Options{KeepPos: true, KeepID: false, KeepInfo: true}
+
+	header = StringHeader(&config)
+
+	expected = strings.Join([]string{"chrom", "pos", "type", "ref", "alt", "trTv", "heterozygotes",
+		"heterozygosity", "homozygotes", "homozygosity", "missingGenos", "missingness", "ac", "an",
+		"sampleMaf", "vcfPos", "alleleIdx", "info"}, "\t")
+
+	if header == expected {
+		t.Log("OK: print header with --keepPos true --keepId false --keepInfo true", header)
+	} else {
+		t.Error("NOT OK: print header with --keepId true --keepInfo true", header)
+	}
+}
+
+func TestWriteSampleListIfWanted(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "./test.sample_list")
+
+	config := Options{SampleListPath: filePath}
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL",
+		"FILTER", "INFO", "FORMAT", "Sample1", "Sample2", "Sample3", "Sample4"}, "\t")
+
+	record1 := strings.Join([]string{"10", "1000", "rs123", "A", "T", "100", "PASS",
+		"AC=1", "GT", "./.", "./1", "1/.", "./0"}, "\t")
+	record2 := strings.Join([]string{"10", "1000", "rs124", "A", "C", "100", "PASS",
+		"AC=1", "GT", ".|.", "1|.", "1|.", ".|0"}, "\t")
+
+	lines := versionLine + "\n" + header + "\n" + record1 + "\n" + record2 + "\n"
+
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+
+	inFh, err := os.Open(filePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer inFh.Close()
+
+	outReader := bufio.NewScanner(inFh)
+
+	idx := -1
+	for outReader.Scan() {
+		sample := outReader.Text()
+		idx++
+
+		if idx == 0 && sample != "Sample1" {
+			t.Error("Couldn't write sample list")
+		}
+
+		if idx == 1 && sample != "Sample2" {
+			t.Error("Couldn't write sample list")
+			continue
+		}
+
+		if idx == 2 && sample != "Sample3" {
+			t.Error("Couldn't write sample list")
+			continue
+		}
+
+		if idx == 3 && sample != "Sample4" {
+			t.Error("Couldn't write sample list")
+			continue
+		}
+
+	}
+}
+
+func TestWriteSampleListWhenNoSamples(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "./test.sample_list_2")
+	config := Options{SampleListPath: filePath}
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL",
+		"FILTER", "INFO"}, "\t")
+
+	record1 := strings.Join([]string{"10", "1000", "rs123", "A", "T", "100", "PASS",
+		"AC=1", "GT"}, "\t")
+	record2 := strings.Join([]string{"10", "1000", "rs124", "A", "C", "100", "PASS",
+		"AC=1", "GT"}, "\t")
+
+	lines := versionLine + "\n" + header + "\n" + record1 + "\n" + record2 + "\n"
+
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+
+	inFh, err := os.Open(filePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer inFh.Close()
+
+	outReader := bufio.NewScanner(inFh)
+
+	idx := -1
+	for outReader.Scan() {
+		fmt.Println(outReader.Text())
+		idx++
+	}
+
+	if idx > -1 {
+		t.Error("Should have empty file when no samples exist")
+	}
+}
+
+// TODO: better test of panic
+func TestWriteSampleListWhenNotWanted(t *testing.T) {
+	config := Options{}
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL",
+		"FILTER", "INFO"}, "\t")
+
+	record1 := strings.Join([]string{"10", "1000", "rs123", "A", "T", "100", "PASS",
+		"AC=1", "GT"}, "\t")
+	record2 := strings.Join([]string{"10", "1000", "rs124", "A", "C", "100", "PASS",
+		"AC=1", "GT"}, "\t")
+
+	lines := versionLine + "\n" + header + "\n" + record1 + "\n" + record2 + "\n"
+
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+}
+
+func TestUpdateFieldsWithAlt(t *testing.T) {
+	expType, exPos, expRef, expAlt := "SNP", "100", byte('T'), "C"
+
+	sType, pos, refs, alts, altIndices := GetAlleles("chr1", "100", "T", "C")
+	test := "Has alt indices"
+
+	if len(altIndices) != 1 && altIndices[1] != 0 {
+		t.Errorf("NOT OK: %s", test)
+	} else {
+		t.Logf("OK: %s", test)
+	}
+
+	if sType != expType || pos[0] != exPos || refs[0] != expRef || alts[0] != expAlt {
+		t.Error("NOT OK: Test failed")
+	} else {
+		t.Log("OK: SNP")
+	}
+
+	expType, exPos, expRef, expAlt = "SNP", "103", byte('T'), "A"
+
+	sType, pos, refs, alts, altIndices = GetAlleles("chr1", "100", "TCCT", "TCCA")
+
+	if sType != expType || pos[0] != exPos || refs[0] != expRef || alts[0] != expAlt {
+		t.Error("NOT OK: Test failed", sType, pos, refs, alts)
+	} else {
+		t.Log("OK: SNPs that are longer than 1 base are suported when SNP at end")
+	}
+
+	expType, exPos, expRef, expAlt = "SNP", "102", byte('C'), "A"
+
+	sType, pos, refs, alts, altIndices = GetAlleles("chr1", "100", "TGCT", "TGAT")
+
+	if sType != expType || pos[0] != exPos || refs[0] != expRef || alts[0] != expAlt {
+		t.Error("NOT OK: Test failed", sType, pos, refs, alts)
+	} else {
+		t.Log("OK: SNPs that are longer than 1 base are suported when SNP in middle")
+	}
+
+	expType, exPos, expRef, expAlt = "SNP", "100", byte('T'), "A"
+
+	sType, pos, refs, alts, altIndices = GetAlleles("chr1", "100", "TGCT", "AGCT")
+
+	if sType != expType || pos[0] != exPos || refs[0] != expRef || alts[0] != expAlt {
+		t.Error("NOT OK: Test failed", sType, pos, refs, alts)
+	} else {
+		t.Log("OK: SNPs that are longer than 1 base are suported when SNP at beginning")
+	}
+
+	/******************** Test contiguous MNPs ***************/
+	expType = "MNP"
+	expRefs := []byte{'T', 'C', 'G', 'T'}
+	expAlts := []string{"G", "T", "A", "A"}
+	expPositions := []string{"100", "101", "102", "103"}
+	// indices are relative to the VCF order; 1 MNP is 1 allele
+	expIndices := []int{0, 0, 0, 0}
+
+	sType, pos, refs, alts, altIndices = GetAlleles("chr1", "100", "TCGT", "GTAA")
+	test = "Supports MNPs"
+	// TODO: Should we call MNPs SNP or MNP?
+	if sType != expType {
+		t.Errorf("NOT OK: %s : MNPs should be labeled 'MNP' if they have > 1 allele", test)
+	} else {
+		t.Logf("OK: %s : MNPs should be labeled 'MNP' if they have > 1 allele", test)
+	}
+
+	if len(altIndices) != 4 {
+		t.Errorf("NOT OK: %s : All MNP alleles should be reported", test)
+	} else {
+		t.Logf("OK: %s : All MNP alleles should be reported", test)
+	}
+
+	for i := 0; i < len(altIndices); i++ {
+		if pos[i] != expPositions[i] || refs[i] != expRefs[i] || alts[i] != expAlts[i] || altIndices[i] != expIndices[i] {
+			t.Errorf("NOT OK: %s : mangled MNP annotation", test)
+		} else {
+			t.Logf("OK: %s : correct MNP annotation", test)
+		}
+	}
+
+	/******************** Test sparse MNPs ***************/
+	// not certain if these are possible, but will be annotated correctly
+	expType = "MNP"
+	expRefs = []byte{'C', 'T'}
+	expAlts = []string{"A", "C"}
+	expPositions = []string{"101", "103"}
+	// indices are relative to the VCF order; 1 MNP is 1 allele
+	expIndices = []int{0, 0}
+
+	sType, pos, refs, alts, altIndices = GetAlleles("chr1", "100", "TCGT", "TAGC")
+	test = "Supports sparse MNPs"
+
+	// TODO: Should we call MNPs SNP or MNP?
+	if sType != expType {
+		t.Errorf("NOT OK: %s : MNPs should be labeled 'MNP' if they have > 1 allele", test)
+	} else {
+		t.Logf("OK: %s : MNPs should be labeled 'MNP' if they have > 1 allele", test)
+	}
+
+	if len(altIndices) != 2 {
+		t.Errorf("NOT OK: %s : All MNP alleles should be reported", test)
+	} else {
+		t.Logf("OK: %s : All MNP alleles should be reported", test)
+	}
+
+	for i := 0; i < len(altIndices); i++ {
+		if pos[i] != expPositions[i] || refs[i] != expRefs[i] || alts[i] != expAlts[i] || altIndices[i] != expIndices[i] {
+			t.Errorf("NOT OK: %s : mangled MNP annotation", test)
+		} else {
+			t.Logf("OK: %s : correct MNP annotation", test)
+		}
+	}
+
+	/******************** Test MNP-like SNP***************/
+	// not certain if these are possible, but will be annotated correctly
+	expType = "SNP"
+	expRefs = []byte{'T'}
+	expAlts = []string{"C"}
+	expPositions = []string{"103"}
+	// indices are relative to the VCF order; 1 MNP is 1 allele
+	expIndices = []int{0}
+
+	sType, pos, refs, alts, altIndices = GetAlleles("chr1", "100", "TCGT", "TCGC")
+	test = "Supports SNPs that are reported as an N-long block"
+
+	if sType != expType {
+		t.Errorf("NOT OK: %s : sites should be labeled 'SNP' if they have only 1 change, that is a single base", test)
+	} else {
+		t.Logf("OK: %s : sites should be labeled 'SNP' if they have only 1 change, that is a single base", test)
+	}
+
+	if len(altIndices) != 1 {
+		t.Errorf("NOT OK: %s : SNPs that are reported as N-block should have only 1 allele", test)
+	} else {
+		t.Logf("OK: %s : SNPs that are reported as N-block should have only 1 allele", test)
+	}
+
+	for i := 0; i < len(altIndices); i++ {
+		if pos[i] != expPositions[i] || refs[i] != expRefs[i] || alts[i] != expAlts[i] || altIndices[i] != expIndices[i] {
+			t.Errorf("NOT OK: %s : mangled long-SNP annotation", test)
+		} else {
+			t.Logf("OK: %s : correct long-SNP annotation", test)
+		}
+	}
+
+	/******************** Test simple 1 base deletion ***************/
+	expType, exPos, expRef, expAlt = "DEL", "101", byte('C'), "-1"
+
+	sType, pos, refs, alts, altIndices = GetAlleles("chr1", "100", "TC", "T")
+
+	if sType != expType || pos[0] != exPos || refs[0] != expRef || alts[0] != expAlt {
+		t.Error("NOT OK: Test failed", sType)
+	} else {
+		t.Log("OK: 1-based deletions ")
+	}
+
+	expType, exPos, expRef, expAlt = "DEL", "101", byte('A'), "-5"
+
+	sType, pos, refs, alts, altIndices = GetAlleles("chr1", "100", "TAGCGT", "T")
+
+	if sType != expType || pos[0] != exPos || refs[0] != expRef || alts[0] != expAlt {
+		t.Error("NOT OK: Test failed", sType, pos, refs, alts)
+	} else {
+		t.Log("OK: Deletions with references longer than 2 bases")
+	}
+
+	// Test multiallelic intercolated deletion
+	expType, exPos, expRef, expAlt = "DEL", "102", byte('G'), "-4"
+
+	sType, pos, refs, alts, altIndices = GetAlleles("chr1", "100", "TAGCTT", "TA")
+
+	if sType != expType || pos[0] != exPos || refs[0] != expRef || alts[0] != expAlt {
+		t.Error("NOT OK: Test failed", sType, pos[0], string(refs[0]), alts[0])
+	} else {
+		t.Log("OK: Deletions longer than 1 base")
+	}
+
+	//Check a malformed allele
+	expType, exPos, expRef, expAlt = "", "", 0, ""
+
+	sType, pos, refs, alts, altIndices = GetAlleles("chr1", "100", "TAGCTT", "TAC")
+
+	if sType != expType || len(pos) != 0 || len(refs) != 0 || len(alts) != 0 {
+		t.Error("NOT OK: expect ref:TAGCTT alt:TAC to return 0 alleles", sType)
+	} else {
+		t.Log("OK: expected ref:TAGCTT alt:TAT to return 0 allele")
+	}
+
+	//Check an intercolated deletion
+	expType, exPos, expRef, expAlt = "DEL", "102", byte('G'), "-3"
+
+	sType, pos, refs, alts, altIndices = GetAlleles("chr1", "100", "TAGCTT", "TAT")
+
+	if len(pos) != 1 || len(refs) != 1 || len(alts) != 1 || len(altIndices) != 1 {
+		t.Error("NOT OK: expected ref:TAGCTT alt:TAT to return 1 intercolated allele", sType, pos, refs, alts)
+	} else {
+		t.Log("OK: expected ref:TAGCTT alt:TAT to return 1 intercolated allele")
+	}
+
+	if sType != expType || pos[0] != exPos || refs[0] != expRef || alts[0] != expAlt {
+		t.Error("NOT OK: expect ref:TAGCTT alt:TAC to be pos:102, ref:G, alt:-3", sType, pos, refs, alts)
+	} else {
+		t.Log("OK: expect ref:TAGCTT alt:TAC to be pos:102, ref:G, alt:-3")
+	}
+
+	expType, exPos, expRef, expAlt = "INS", "100", byte('T'), "+AGCTT"
+
+	sType, pos, refs, alts, altIndices = GetAlleles("chr1", "100", "T", "TAGCTT")
+
+	test = "Insertions where reference is 1 base long"
+
+	if sType != expType || pos[0] != exPos || refs[0] != expRef || alts[0] != expAlt {
+		t.Errorf("NOT OK: %s", test)
+	} else {
+		t.Logf("OK: %s", test)
+	}
+
+	// Test intercolated insertions
+	expType, exPos, expRef, expAlt = "INS", "100", byte('T'), "+AGCT"
+	test = "Intercolated insertions"
+
+	sType, pos, refs, alts, altIndices = GetAlleles("chr1", "100", "TT", "TAGCTT")
+
+	if sType != expType || pos[0] != exPos || refs[0] != expRef || alts[0] != expAlt {
+		t.Error("NOT OK: Test failed", sType, pos, string(refs[0]), alts)
+	} else {
+		t.Log("OK: Multiallelics insertion where reference is 2 bases long")
+	}
+}
+
+func TestPassesLine(t *testing.T) {
+	expect := true
+
+	header := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO"}
+	//Test example 5.2.4 https://samtools.github.io/hts-specs/VCFv4.2.pdf
+	record := []string{"20", "4", ".", "GCG", "G,GCGCG", ".", "PASS", "DP=100"}
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+	actual := linePasses(record, header, allowedFilters, nil)
+
+	if actual == expect {
+		t.Log("OK: We can whitelist FILTER values (PASS)")
+	} else {
+		t.Error("NOT OK: We can whitelist FILTER values (PASS)")
+	}
+
+	record = []string{"20", "4", ".", "GCG", "G,GCGCG", ".", ".", "DP=100"}
+
+	actual = linePasses(record, header, allowedFilters, nil)
+
+	if actual == expect {
+		t.Log("OK: We can whitelist FILTER values (.)")
+	} else {
+		t.Error("NOT OK: We can whitelist FILTER values (.)")
+	}
+
+	record = []string{"20", "4", ".", "GCG", "G,GCGCG", ".", "blah", "DP=100"}
+
+	actual = linePasses(record, header, nil, nil)
+
+	if actual == expect {
+		t.Log("OK: We allow non-PASS/. FILTER values, when we don't specify allowedFilters")
+	} else {
+		t.Error("NOT OK: We allow non-PASS/. FILTER values, when we don't specify allowedFilters")
+	}
+
+	record = []string{"20", "4", ".", "GCG", "G,GCGCG", ".", "blah", "DP=100"}
+
+	actual = linePasses(record, header, nil, map[string]bool{"blah": true})
+
+	if actual == false {
+		t.Log("OK: We can exclude/blacklist FILTER values")
+	} else {
+		t.Error("NOT OK: We can exclude/blacklist FILTER values")
+	}
+}
+
+func TestAltIsValid(t *testing.T) {
+	expect := true
+
+	actual := altIsValid("ACTG")
+
+	if expect != actual {
+		t.Error("NOT OK: Support ACTG-containing alleles")
+	} else {
+		t.Log("OK: Support ACTG-containing alleles")
+	}
+
+	expect = false
+	actual = altIsValid(".")
+
+	if expect != actual {
+		t.Error("NOT OK: Can't handle missing Alt alleles")
+	} else {
+		t.Log("OK: Handles missing Alt alleles")
+	}
+
+	expect = false
+	actual = altIsValid("]13 : 123456]T")
+
+	// https://samtools.github.io/hts-specs/VCFv4.1.pdf
+	if expect != actual {
+		t.Error("NOT OK: Can't handle single breakends")
+	} else {
+		t.Log("OK: Handles single breakend ']13 : 123456]T'")
+	}
+
+	expect = false
+	actual = altIsValid("C[2 : 321682[")
+
+	// https://samtools.github.io/hts-specs/VCFv4.1.pdf
+	if expect != actual {
+		t.Error("NOT OK: Can't handle single breakends")
+	} else {
+		t.Log("OK: Handles single breakend 'C[2 : 321682['")
+	}
+
+	expect = false
+	actual = altIsValid(".A")
+
+	// https://samtools.github.io/hts-specs/VCFv4.1.pdf
+	if expect != actual {
+		t.Error("NOT OK: Can't handle single breakends")
+	} else {
+		t.Log("OK: Handles single breakend '.A'")
+	}
+
+	expect = false
+	actual = altIsValid("G.")
+
+	// https://samtools.github.io/hts-specs/VCFv4.1.pdf
+	if expect != actual {
+		t.Error("NOT OK: Can't handle single breakends")
+	} else {
+		t.Log("OK: Handles single breakend 'G.'")
+	}
+
+	expect = false
+	actual = altIsValid("<DUP>")
+
+	// https://samtools.github.io/hts-specs/VCFv4.1.pdf
+	if expect != actual {
+		t.Error("NOT OK: Can't handle complex tags")
+	} else {
+		t.Log("OK: Handles complex Alt tags '<DUP>'")
+	}
+
+	expect = false
+	actual = altIsValid("A,C")
+
+	// https://samtools.github.io/hts-specs/VCFv4.1.pdf
+	if expect != actual {
+		t.Error("NOT OK: Should require single alleles in altIsValid", actual)
+	} else {
+		t.Log("OK: multiallelics are not supported. altIsValid() requires multiallelics to be split")
+	}
+}
+
+func TestMakeHetHomozygotes(t *testing.T) {
+	header := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3", "S4"}
+
+	sharedFieldsGT := []string{"10", "1000", "rs#", "C", "T", "100", "PASS", "AC=1", "GT"}
+
+	// GT:DS:GL is what 1000 genomes phase 1 provides
+	sharedFieldsGTcomplex := []string{"10", "1000", "rs#", "C", "T", "100", "PASS", "AC=1", "GT:DS:GL"}
+
+	fields := append(sharedFieldsGT, "0|0", "0|0", "0|0", "0|0")
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an := MakeHetHomozygotes(fields, header, "1", true, true, false, false)
+
+	sampleMaf := float64(ac) / float64(an)
+
+	if len(actualHoms) == 0 && len(actualHets) == 0 && len(missing) == 0 {
+		t.Log("OK: Homozygous reference samples are skipped")
+	} else {
+		t.Error("NOT OK: 0 alleles give unexpected results", actualHoms, actualHets, missing)
+	}
+
+	if ac == 0 && an == 8 && sampleMaf == 0 {
+		t.Log("OK: sampleMaf should be 0 for all reference sites", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	} else {
+		t.Error("NOT OK: sampleMaf should be 0 for all reference sites", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	}
+
+	fields = append(sharedFieldsGT, "0|1", "0|1", "0|1", "0|1")
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "1", true, true, false, false)
+
+	sampleMaf = float64(ac) / float64(an)
+
+	if len(actualHoms) == 0 && len(actualHets) == 4 && len(missing) == 0 {
+		t.Log("OK: handles hets")
+	} else {
+		t.Error("NOT OK: 0 alleles give unexpected results", actualHoms, actualHets, missing)
+	}
+
+	if ac == 4 && an == 8 && sampleMaf == float64(4)/float64(8) {
+		t.Log("OK: sampleMaf should be .5 for 0|1, 0|1, 0|1, 0|1", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	} else {
+		t.Error("NOT OK: sampleMaf miscounted for hets")
+	}
+
+	// Expect 0 genotypes, 0 maf
+	fields = append(sharedFieldsGT, ".|.", ".|.", ".|1", "1|.")
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "1", true, true, false, false)
+
+	sampleMaf = 0
+
+	if len(actualHoms) == 0 && len(actualHets) == 0 && len(missing) == 4 {
+		t.Log("OK: handles hets")
+	} else {
+		t.Error("NOT OK: 0 alleles give unexpected results", actualHoms, actualHets, missing)
+	}
+
+	if ac == 0 && an == 0 {
+		t.Log("OK: sampleMaf should be 0 for all-missing genotypes", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	} else {
+		t.Error("NOT OK: sampleMaf miscounted for all-missing genotypes")
+	}
+
+	fields = append(sharedFieldsGT, ".|1", "0|1", "0|1", "0|1", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "1", true, true, false, false)
+
+	sampleMaf = float64(ac) / float64(an)
+
+	if len(actualHoms) == 0 && len(actualHets) == 3 && len(missing) == 1 {
+		t.Log("OK: GT's containing missing data are entirely uncertain, therefore skipped. Missing genotypes are called if any of the calls are missing")
+	} else {
+		t.Error("NOT OK: Fails to handle missing data", actualHoms, actualHets, missing)
+	}
+
+	// Note: Bystro currently drops both alleles if one is missing
+	// So AN is 6 not 7
+	if ac == 3 && an == 6 && sampleMaf == float64(3)/float64(6) {
+		t.Log("OK: sampleMaf should be .5 for .|1, 0|1, 0|1, 0|1", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	} else {
+		t.Error("NOT OK: sampleMaf miscounted for hets in presence of missing data")
+	}
+
+	fields = append(sharedFieldsGT, "1|.", "0|1", "0|1", "0|1", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "1", true, true, false, false)
+
+	sampleMaf = float64(ac) / float64(an)
+
+	if len(actualHoms) == 0 && len(actualHets) == 3 && len(missing) == 1 {
+		t.Log("OK: GT's containing missing data are entirely uncertain, therefore skipped. Missing genotypes are called if any of the calls are missing")
+	} else {
+		t.Error("NOT OK: Fails to handle missing data", actualHoms, actualHets)
+	}
+
+	if ac == 3 && an == 6 && sampleMaf == float64(3)/float64(6) {
+		t.Log("OK: sampleMaf should be .5 for 1|., 0|1, 0|1, 0|1", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	} else {
+		t.Error("NOT OK: sampleMaf miscounted for hets in presence of missing data")
+	}
+
+	fields = append(sharedFieldsGT, "1|1", "1|1", "0|1", "0|1", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "1", true, true, false, false)
+
+	sampleMaf = float64(ac) / float64(an)
+
+	if len(actualHoms) == 2 && len(actualHets) == 2 {
+		t.Log("OK: handles homs and hets")
+	} else {
+		t.Error("NOT OK: Fails to handle homs and hets", actualHoms, actualHets)
+	}
+
+	if ac == 6 && an == 8 && sampleMaf == float64(6)/float64(8) {
+		t.Log("OK: sampleMaf should be 6/8 for 1|1, 1|1, 0|1, 0|1", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	} else {
+		t.Error("NOT OK: sampleMaf miscounted for hets + homs admixture", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	}
+
+	fields = append(sharedFieldsGT, "1|2", "1|1", "0|1", "0|1")
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "1", true, true, false, false)
+
+	sampleMaf = float64(ac) / float64(an)
+
+	if len(actualHoms) == 1 && len(actualHets) == 3 {
+		t.Log("OK: a sample heterozygous for a wanted allele is heterozygous for that allele even if its other allele is unwanted (for multiallelic phasing)")
+	} else {
+		t.Error("NOT OK: Fails to handle homs and hets", actualHoms, actualHets)
+	}
+
+	// NOTE: an is 8, even for the sample that doesn't have the allele
+	// because it the sum of the numerators of all alleles / non-missing an at that
+	// site, must be == total_ac/non_missing_an
+	if ac == 5 && an == 8 && sampleMaf == float64(5)/float64(8) {
+		t.Log("OK: sampleMaf should be 5/8 for 1|2, 1|1, 0|1, 0|1 and allele 1, because we consider only the allele being counted", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	} else {
+		t.Error("NOT OK: sampleMaf miscounted for hets + homs admixture in multiallelic case", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	}
+
+	fields = append(sharedFieldsGT, "1|2", "1|1", "0|1", "0|1")
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "2", true, true, false, false)
+	sampleMaf = float64(ac) / float64(an)
+
+	if len(actualHoms) == 0 && len(actualHets) == 1 {
+		t.Log("OK: Het / homozygous status is based purely on the wanted allele, rather than total non-ref count")
+	} else {
+		t.Error("NOT OK: Fails to handle homs and hets", actualHoms, actualHets)
+	}
+
+	if ac == 1 && an == 8 && sampleMaf == float64(1)/float64(8) {
+		t.Log("OK: sampleMaf should be 1/8 for 1|2, 1|1, 0|1, 0|1 and allele 2", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	} else {
+		t.Error("NOT OK: sampleMaf miscounted for hets + homs admixture in multiallelic case", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	}
+
+	fields = append(sharedFieldsGTcomplex, "1|2:-0.03,-1.12,-5.00", "1|1:-0.03,-1.12,-5.00", "0|1:-0.03,-1.12,-5.00", "0|1:-0.03,-1.12,-5.00")
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "2", true, true, false, false)
+	sampleMaf = float64(ac) / float64(an)
+
+	if len(actualHoms) == 0 && len(actualHets) == 1 {
+		t.Log("OK: handles complicated GTs, with non-1 alleles", fields)
+	} else {
+		t.Error("NOT OK: Fails to handle homs and hets", actualHoms, actualHets)
+	}
+
+	if ac == 1 && an == 8 && sampleMaf == float64(1)/float64(8) {
+		t.Log("OK: sampleMaf should be 1/8 for 1|2, 1|1, 0|1, 0|1 and allele 2, even with gq or gl strings", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	} else {
+		t.Error("NOT OK: sampleMaf miscounted for hets + homs admixture in multiallelic case", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	}
+
+	fields = append(sharedFieldsGTcomplex, "1|2|1:-0.03,-1.12,-5.00", "1|1:-0.03,-1.12,-5.00", "0|1:-0.03,-1.12,-5.00", "0|1:-0.03,-1.12,-5.00")
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "2", true, true, false, false)
+	sampleMaf = float64(ac) / float64(an)
+
+	if len(actualHoms) == 0 && len(actualHets) == 1 {
+		t.Log("OK: Complicated GT: Triploids are considered het if only 1 present desired allele", fields)
+	} else {
+		t.Error("NOT OK: Fails to handle homs and hets", actualHoms, actualHets)
+	}
+
+	if ac == 1 && an == 9 && sampleMaf == float64(1)/float64(9) {
+		t.Log("OK: sampleMaf should be 1/9 for 1|2|1, 1|1, 0|1, 0|1 and allele 2, even with gq or gl strings", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	} else {
+		t.Error("NOT OK: sampleMaf miscounted for hets + homs admixture in multiallelic triploid case", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	}
+
+	fields = append(sharedFieldsGT, "1|2|1", "1|1", "0|1", "0|1")
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "2", true, true, false, false)
+	sampleMaf = float64(ac) / float64(an)
+
+	if len(actualHoms) == 0 && len(actualHets) == 1 {
+		t.Log("OK: Triploids are considered het if only 1 present desired allele")
+	} else {
+		t.Error("NOT OK: Fails to handle homs and hets", actualHoms, actualHets)
+	}
+
+	if ac == 1 && an == 9 && sampleMaf == float64(1)/float64(9) {
+		t.Log("OK: sampleMaf should be 1/9 for 1|2|1, 1|1, 0|1, 0|1 and allele 2", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	} else {
+		t.Error("NOT OK: sampleMaf miscounted for hets + homs admixture in multiallelic triploid case", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	}
+
+	fields = append(sharedFieldsGTcomplex, "2|2|2:-0.03,-1.12,-5.00", "1|1:-0.03,-1.12,-5.00", "0|1:-0.03,-1.12,-5.00", "0|1:-0.03,-1.12,-5.00")
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "2", true, true, false, false)
+	sampleMaf = float64(ac) / float64(an)
+
+	if len(actualHoms) == 1 && len(actualHets) == 0 {
+		t.Log("OK: Complicated GT: Triploids are considered hom only if all alleles present are desired", fields)
+	} else {
+		t.Error("NOT OK: Fails to handle homs and hets", actualHoms, actualHets)
+	}
+
+	if ac == 3 && an == 9 && sampleMaf == float64(3)/float64(9) {
+		t.Log("OK: sampleMaf should be 3/9 for 2|2|2, 1|1, 0|1, 0|1 and allele 2, even with gq or gl strings", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	} else {
+		t.Error("NOT OK: sampleMaf miscounted for hets + homs admixture in multiallelic triploid case", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	}
+
+	fields = append(sharedFieldsGT, "2|2|2", "1|1", "0|1", "0|1")
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "2", true, true, false, false)
+	sampleMaf = float64(ac) / float64(an)
+
+	if len(actualHoms) == 1 && len(actualHets) == 0 {
+		t.Log("OK: Triploids are considered hom only if all alleles present are desired")
+	} else {
+		t.Error("NOT OK: Fails to handle homs and hets", actualHoms, actualHets)
+	}
+
+	if ac == 3 && an == 9 && sampleMaf == float64(3)/float64(9) {
+		t.Log("OK: sampleMaf should be 1/9 for 2|2|2, 1|1, 0|1, 0|1 and allele 2, without gq or gl strings", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	} else {
+		t.Error("NOT OK: sampleMaf miscounted for hets + homs admixture in multiallelic triploid case", strconv.FormatFloat(sampleMaf, 'G', 3, 64))
+	}
+}
+
+func TestMakeHetHomozygotesHaploid(t *testing.T) {
+	header := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3", "S4"}
+
+	sharedFieldsGT := []string{"10", "1000", "rs#", "C", "T", "100", "PASS", "AC=1", "GT"}
+
+	// GT:DS:GL is what 1000 genomes phase 1 provides
+	sharedFieldsGTcomplex := []string{"10", "1000", "rs#", "C", "T", "100", "PASS", "AC=1", "GT:DS:GL"}
+
+	fields := append(sharedFieldsGT, "0", ".", "1", "0")
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an := MakeHetHomozygotes(fields, header, "1", true, true, false, false)
+	sampleMaf := float64(ac) / float64(an)
+
+	if len(actualHoms) == 1 && len(actualHets) == 0 && len(missing) == 1 {
+		t.Log("OK: Haploid non-reference sites called homozygous")
+	} else {
+		t.Error("NOT OK: Haploid non-reference sites called homozygous", actualHoms, actualHets, missing)
+	}
+
+	if ac == 1 && an == 3 && sampleMaf == float64(1)/float64(3) {
+		t.Log("OK: Calculate sample maf as 1/3 when 1 non-ref allele, 1 misisng, in haploid", sampleMaf)
+	} else {
+		t.Error("NOT OK: Calculate sample maf as 1/3 when 1 non-ref allele, 1 misisng, in haploid", sampleMaf)
+	}
+
+	fields = append(sharedFieldsGTcomplex, "0:1", ".:1", "1:1", "0:1")
+
+	// The allele index we want to test is always 1...unless it's a multiallelic site
+	actualHoms, actualHets, _, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "1", true, true, false, false)
+	sampleMaf = float64(ac) / float64(an)
+
+	if len(actualHoms) == 1 && len(actualHets) == 0 && len(missing) == 1 {
+		t.Log("OK: Haploid non-reference sites called heterozygous in complex case", sampleMaf)
+	} else {
+		t.Error("NOT OK: Haploid non-reference sites called heterozygous in complex case", sampleMaf)
+	}
+
+	if ac == 1 && an == 3 && sampleMaf == float64(1)/float64(3) {
+		t.Log("OK: Calculate sample maf as 1/3 when 1 non-ref allele, 1 misisng, in haploid complex GT")
+	} else {
+		t.Error("NOT OK: Calculate sample maf as 1/3 when 1 non-ref allele, 1 misisng, in haploid complex GT")
+	}
+}
+
+// Headers are expected to be:
+// chrom: 0, pos: 1, siteType: 2, ref: 3, alt: 4, trTv: 5, heterozygotes: 6, heterozygosity: 7
+// homozyogtes: 8, homozygosity: 9, missingGenos: 10, missingness: 11, sampleMaf: 12,
+// id: 13 (if keepID), alleleIdx: 14 (if keepID and keepInfo), info: 15 (if keepID and keepInfo)
+// if keepInfo only: alleleIdx: 13, info: 14
+
+func TestMakeHetHomozygotesPolyploid(t *testing.T) {
+	header := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3", "S4", "S5", "S6"}
+
+	sharedFieldsGT := []string{"10", "1000", "rs#", "C", "T", "100", "PASS", "AC=1", "GT"}
+
+	// tetraploid, triploid, diploid and haploid samples, with a missing tetraploid
+	fields := append(sharedFieldsGT, "0/0/1/1", "1/1/1/1", "0/1/1", "0|1", "1", "0/./1/1")
+
+	homs, hets, partials, missing, dosages, _, ac, an := MakeHetHomozygotes(fields, header, "1", true, true, false, false)
+
+	if !reflect.DeepEqual(homs, []string{"S2", "S5"}) || !reflect.DeepEqual(hets, []string{"S1", "S3", "S4"}) ||
+		len(partials) != 0 || !reflect.DeepEqual(missing, []string{"S6"}) {
+		t.Error("NOT OK: Without partial labels, polyploids carrying the allele on some haplotypes are heterozygous", homs, hets, partials, missing)
+	}
+
+	expectedDosages := []any{int8(2), int8(4), int8(2), int8(1), int8(1), int8(-1)}
+	if !reflect.DeepEqual(dosages, expectedDosages) {
+		t.Error("NOT OK: Expected allele count dosages", expectedDosages, "got", dosages)
+	}
+
+	// 2 + 4 + 2 + 1 + 1, over 4 + 4 + 3 + 2 + 1
+	if ac != 10 || an != 14 {
+		t.Errorf("NOT OK: Expected ac == 10 and an == 14, got %d and %d", ac, an)
+	}
+
+	// 0/0/1/1 and 0/1/1 carry the allele on at least half of their haplotypes, so aren't partial
+	homs, hets, partials, missing, _, _, ac, an = MakeHetHomozygotes(fields, header, "1", true, true, false, true)
+
+	if !reflect.DeepEqual(homs, []string{"S2", "S5"}) || !reflect.DeepEqual(hets, []string{"S1", "S3", "S4"}) ||
+		len(partials) != 0 || !reflect.DeepEqual(missing, []string{"S6"}) {
+		t.Error("NOT OK: With partial labels, polyploids carrying the allele on half or more haplotypes are heterozygous", homs, hets, partials, missing)
+	}
+
+	if ac != 10 || an != 14 {
+		t.Errorf("NOT OK: Partial labels shouldn't change ac and an, got %d and %d", ac, an)
+	}
+}
+
+func TestMakeHetHomozygotesPartials(t *testing.T) {
+	header := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3", "S4", "S5",
+		"S6", "S7", "S8", "S9", "S10", "S11", "S12"}
+
+	sharedFieldsGT := []string{"10", "1000", "rs#", "C", "T,G", "100", "PASS", "AC=1", "GT"}
+
+	// triploids: 1 of 3 is partial, 2 of 3 heterozygous, and any missing allele makes the sample missing
+	// tetraploids: 1 of 4 is partial, 2 or 3 of 4 heterozygous, and any missing allele makes the sample missing
+	fields := append(sharedFieldsGT, "0/0/1", "0/1/1", "1/1/1", "./1/1", "0/./.", "2/1/0",
+		"0/0/0/1", "0/0/1/1", "0/1/1/1", "1/1/./1", "./0/0/1", "2/2/2/1")
+
+	homs, hets, partials, missing, dosages, _, ac, an := MakeHetHomozygotes(fields, header, "1", true, true, false, true)
+
+	if !reflect.DeepEqual(homs, []string{"S3"}) || !reflect.DeepEqual(hets, []string{"S2", "S8", "S9"}) ||
+		!reflect.DeepEqual(partials, []string{"S1", "S6", "S7", "S12"}) ||
+		!reflect.DeepEqual(missing, []string{"S4", "S5", "S10", "S11"}) {
+		t.Error("NOT OK: Expected partials to carry the allele on fewer than half of their haplotypes", homs, hets, partials, missing)
+	}
+
+	expectedDosages := []any{int8(1), int8(2), int8(3), int8(-1), int8(-1), int8(1), int8(1), int8(2), int8(3), int8(-1),
+		int8(-1), int8(1)}
+	if !reflect.DeepEqual(dosages, expectedDosages) {
+		t.Error("NOT OK: Expected allele count dosages", expectedDosages, "got", dosages)
+	}
+
+	// 1 + 2 + 3 + 1, over 4 triploids, and 1 + 2 + 3 + 1, over 4 tetraploids
+	if ac != 14 || an != 28 {
+		t.Errorf("NOT OK: Expected ac == 14 and an == 28, got %d and %d", ac, an)
+	}
+
+	// The 2nd allele: S6 carries it on 1 of 3 haplotypes, and S12 on 3 of 4
+	homs, hets, partials, missing, _, _, _, _ = MakeHetHomozygotes(fields, header, "2", true, false, false, true)
+
+	if len(homs) != 0 || !reflect.DeepEqual(hets, []string{"S12"}) || !reflect.DeepEqual(partials, []string{"S6"}) ||
+		!reflect.DeepEqual(missing, []string{"S4", "S5", "S10", "S11"}) {
+		t.Error("NOT OK: Unexpected labels of the 2nd allele", homs, hets, partials, missing)
+	}
+}
+
+func TestMakeHetHomozygotesHaplotypes(t *testing.T) {
+	header := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3", "S4", "S5", "S6"}
+
+	sharedFieldsGT := []string{"10", "1000", "rs#", "C", "T,G", "100", "PASS", "AC=1", "GT:DS"}
+
+	fields := append(sharedFieldsGT, "0|1:1", "1|0", "2|1", "1|.", "./1", "1")
+
+	homs, hets, _, missing, dosages, haplotypes, _, _ := MakeHetHomozygotes(fields, header, "1", true, true, true, false)
+
+	if len(homs) != 1 || len(hets) != 3 || len(missing) != 2 || len(dosages) != 6 {
+		t.Error("NOT OK: Haplotypes should not change labels or dosages", homs, hets, missing, dosages)
+	}
+
+	expectedAlleles := []int8{0, 1, 1, 0, 0, 1, 1, -1, -1, 1, 1}
+	expectedPloidy := []uint8{2, 2, 2, 2, 2, 1}
+	expectedPhased := []bool{true, true, true, true, false, true}
+
+	if !reflect.DeepEqual(haplotypes.Alleles, expectedAlleles) {
+		t.Error("NOT OK: Expected haplotype alleles", expectedAlleles, "got", haplotypes.Alleles)
+	}
+
+	if !reflect.DeepEqual(haplotypes.Ploidy, expectedPloidy) {
+		t.Error("NOT OK: Expected ploidy", expectedPloidy, "got", haplotypes.Ploidy)
+	}
+
+	if !reflect.DeepEqual(haplotypes.Phased, expectedPhased) {
+		t.Error("NOT OK: Expected phase", expectedPhased, "got", haplotypes.Phased)
+	}
+
+	// The only unphased genotype is missing, so doesn't unphase the site
+	if !haplotypes.AllPhased() {
+		t.Error("NOT OK: Expected site whose only unphased genotype is missing to be phased")
+	}
+
+	unphasedFields := append(append([]string{}, sharedFieldsGT...), "0|1:1", "1/0", "2|1", "1|.", "./1", "1")
+	_, _, _, _, _, haplotypes, _, _ = MakeHetHomozygotes(unphasedFields, header, "1", true, true, true, false)
+
+	if haplotypes.AllPhased() {
+		t.Error("NOT OK: Expected site with an unphased called genotype to not be phased")
+	}
+
+	_, _, _, _, _, haplotypes, _, _ = MakeHetHomozygotes(fields, header, "2", true, true, true, false)
+
+	expectedAlleles = []int8{0, 0, 0, 0, 1, 0, 0, -1, -1, 0, 0}
+	if !reflect.DeepEqual(haplotypes.Alleles, expectedAlleles) {
+		t.Error("NOT OK: Expected haplotype alleles for 2nd allele", expectedAlleles, "got", haplotypes.Alleles)
+	}
+
+	_, _, _, _, _, haplotypes, _, _ = MakeHetHomozygotes(fields, header, "1", true, true, false, false)
+
+	if haplotypes != nil {
+		t.Error("NOT OK: Expected no haplotypes when not needed")
+	}
+}
+
+// Headers are expected to be:
+// chrom: 0, pos: 1, siteType: 2, ref: 3, alt: 4, trTv: 5, heterozygotes: 6, heterozygosity: 7
+// homozyogtes: 8, homozygosity: 9, missingGenos: 10, missingness: 11, sampleMaf: 12,
+// id: 13 (if keepID), alleleIdx: 14 (if keepID and keepInfo), info: 15 (if keepID and keepInfo)
+// if keepInfo only: alleleIdx: 13, info: 14
+
+func TestHandlesAllMissing(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL",
+		"FILTER", "INFO", "FORMAT", "Sample1", "Sample2", "Sample3", "Sample4"}, "\t")
+
+	record1 := strings.Join([]string{"10", "1000", "rs123", "A", "T", "100", "PASS",
+		"AC=1", "GT", "./.", "./1", "1/.", "./0"}, "\t")
+	record2 := strings.Join([]string{"10", "1000", "rs124", "A", "C", "100", "PASS",
+		"AC=1", "GT", ".|.", "1|.", "1|.", ".|0"}, "\t")
+
+	lines := versionLine + "\n" + header + "\n" + record1 + "\n" + record2 + "\n"
+
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";"}
+
+	expHeader := strings.Split(StringHeader(&config), string(tabByte))
+	expLen := 15
+
+	// keepPos adds 1 field, keepID adds 1, and keepInfo adds 2 (alleleIdx, info)
+	if len(expHeader) != expLen {
+		t.Errorf("with keepID and keepInfo, expect %d fields in header output", expLen)
+	}
+
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	results := bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	idx := 0
+	for results.Scan() {
+		idx++
+	}
+
+	if idx == 0 {
+		t.Log("OK: Skips sites with only missing genotypes")
+	} else {
+		t.Error("NOT OK: Skips sites with only missing genotypes")
+	}
+}
+
+func TestOutputsInfo(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO"}, "\t")
+	record := strings.Join([]string{"10", "1000", "rs#", "C", "T", "100", "PASS", "AC=1"}, "\t")
+
+	lines := versionLine + "\n" + header + "\n" + record + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", KeepID: false, KeepInfo: true}
+
+	expHeader := strings.Split(StringHeader(&config), string(tabByte))
+
+	// --keepInfo adds 'alleleIdx' & 'info' fields
+	expLen := 15 + 2
+
+	if len(expHeader) != expLen {
+		t.Errorf("Expected header to have %d fields with --keepInfo flag set", expLen)
+	}
+
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	results := bufio.NewScanner(&b)
+
+	// resultRow := strings.Split(results.Text(), "\t")
+	// fmt.Println(byteBuf)
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+		fmt.Println(resultRow)
+		if resultRow[0] != "chr10" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if resultRow[4] != "T" {
+			t.Error("Couldn't parse T allele", resultRow)
+		}
+
+		if resultRow[5] != "1" {
+			t.Error("Transitions should have value 1", resultRow)
+		}
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		if resultRow[len(resultRow)-2] == "0" && resultRow[len(resultRow)-1] == "AC=1" {
+			t.Log("OK: add INFO field correctly for single field")
+		} else {
+			t.Error("NOT OK: Couldn't add INFO field", resultRow)
+		}
+	}
+
+	record = strings.Join([]string{"10", "1000", "rs#", "C", "T,G", "100", "PASS", "AC=1"}, "\t")
+
+	lines = versionLine + "\n" + header + "\n" + record + "\n"
+	reader = bufio.NewReader(strings.NewReader(lines))
+
+	index := -1
+
+	b.Reset()
+	w = bufio.NewWriter(&b)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	results = bufio.NewScanner(&b)
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+		index++
+
+		if resultRow[0] != "chr10" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if resultRow[5] != "0" {
+			t.Error("Multiallelics should be called neither transitions nor transversions with value 0", resultRow)
+		}
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		altIdx, err := strconv.Atoi(resultRow[len(resultRow)-2])
+
+		if err != nil {
+			t.Error("NOT OK: The 8th column should be numeric")
+		}
+
+		if altIdx == index && resultRow[len(resultRow)-1] == "AC=1" {
+			t.Log("OK: add INFO field correctly for multiple field, index", altIdx)
+		} else {
+			t.Error("NOT OK: Couldn't add INFO field", resultRow)
+		}
+	}
+
+	if index != 1 {
+		t.Error("NOT OK: Expected to parse 2 alleles, parsed fewer")
+	}
+}
+
+func TestOutputsId(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO"}, "\t")
+	record := strings.Join([]string{"10", "1000", "rs123", "C", "T", "100", "PASS", "AC=1"}, "\t")
+
+	lines := versionLine + "\n" + header + "\n" + record + "\n"
+
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", KeepID: true, KeepInfo: false}
+
+	expHeader := strings.Split(StringHeader(&config), string(tabByte))
+	expLen := 15 + 1
+
+	if len(expHeader) != expLen {
+		t.Errorf("NOT OK: With keepID set, expect %d fields in header output: %v", expLen, expHeader)
+	}
+
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	results := bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+
+		if resultRow[0] != "chr10" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if resultRow[5] != "1" {
+			t.Error("Transitions should have value 1", resultRow)
+		} else {
+			t.Log("Parsed transition with value 1", resultRow)
+		}
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		if resultRow[len(resultRow)-1] == "rs123" {
+			t.Log("OK: add ID field correctly for single field")
+		} else {
+			t.Error("NOT OK: Couldn't add ID field", resultRow)
+		}
+	}
+
+	record = strings.Join([]string{"10", "1000", "rs456", "C", "T,G", "100", "PASS", "AC=1"}, "\t")
+
+	lines = versionLine + "\n" + header + "\n" + record + "\n"
+	reader = bufio.NewReader(strings.NewReader(lines))
+
+	index := -1
+	byteBuf = new(bytes.Buffer)
+	w = bufio.NewWriter(byteBuf)
+
+	results = bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+		index++
+
+		if resultRow[0] != "chr10" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if resultRow[5] != "0" {
+			t.Error("Multiallelics should be called neither transitions nor transversions with value 0", resultRow)
+		}
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		if resultRow[len(resultRow)-1] == "rs456" {
+			t.Log("OK: add ID field correctly for multiple field, index", altIdx)
+		} else {
+			t.Error("NOT OK: Couldn't add ID field", resultRow)
+		}
+	}
+
+	if index != 1 {
+		t.Error("NOT OK: Expected to parse 2 alleles, parsed fewer")
+	}
+}
+
+func TestOutputsVcfPos(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO"}, "\t")
+
+	// Define a interstital insertion, between C & T
+	record := strings.Join([]string{"10", "1000", "rs#", "CTT", "CT", "100", "PASS", "AC=1"}, "\t")
+
+	lines := versionLine + "\n" + header + "\n" + record + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", KeepPos: true}
+
+	expHeader := strings.Split(StringHeader(&config), string(tabByte))
+
+	// keepPos adds 1 field
+	expLen := 15 + 1
+
+	if len(expHeader) != expLen {
+		t.Errorf("with keepID and keepInfo, expect %d fields in header output", expLen)
+	}
+
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	results := bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		vcfPos, err := strconv.Atoi(resultRow[len(resultRow)-1])
+
+		if err != nil || vcfPos != 1000 {
+			t.Error("NOT OK: Deletions should get the vcf input position with --keepPos, in the vcfPos column", resultRow)
+		}
+	}
+
+	record = strings.Join([]string{"10", "1003", "rs#", "C", "T,G", "100", "PASS", "AC=1"}, "\t")
+
+	lines = versionLine + "\n" + header + "\n" + record + "\n"
+	reader = bufio.NewReader(strings.NewReader(lines))
+
+	index := -1
+	byteBuf = new(bytes.Buffer)
+	w = bufio.NewWriter(byteBuf)
+
+	results = bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+		index++
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		vcfPos, err := strconv.Atoi(resultRow[len(resultRow)-1])
+
+		if err != nil || vcfPos != 1003 {
+			t.Error("NOT OK: Each allele in a multiallelic should get the vcf input position with --keepPos, in the vcfPos column", resultRow)
+		}
+	}
+
+	if index != 1 {
+		t.Error("NOT OK: Expected to parse 2 alleles, parsed fewer")
+	}
+}
+
+func TestOutputsVcfPosIdAndInfo(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO"}, "\t")
+
+	// Define a interstital insertion, between C & T
+	record := strings.Join([]string{"10", "1000", "rs1", "CTT", "CT", "100", "PASS", "AC=1"}, "\t")
+
+	lines := versionLine + "\n" + header + "\n" + record + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", KeepPos: true, KeepID: true, KeepInfo: true}
+
+	expHeader := strings.Split(StringHeader(&config), string(tabByte))
+	// KeepInfo adds 2 fields, alleleIdx and info
+	expLen := 19
+
+	if len(expHeader) != expLen {
+		t.Errorf("NOT OK: With keepID and keepInfo, expect %d fields in header output: %v", expLen, expHeader)
+	}
+
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	results := bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		vcfPos, err := strconv.Atoi(resultRow[len(resultRow)-4])
+
+		if err != nil || vcfPos != 1000 {
+			t.Error("vcfPos should be the first optional field")
+		}
+
+		if resultRow[len(resultRow)-3] != "rs1" {
+			t.Error("id should come after vcfPos")
+		}
+
+		altIdx, err := strconv.Atoi(resultRow[len(resultRow)-2])
+
+		if err != nil || altIdx != 0 {
+			t.Error("altIdx should come after vcfPos and after id")
+		}
+
+		if resultRow[len(resultRow)-1] != "AC=1" {
+			t.Error("INFO should come after vcfPos, id, and altIdx")
+		}
+	}
+}
+
+func TestOutputsSamplesVcfPosIdAndInfo(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL",
+		"FILTER", "INFO", "FORMAT", "Sample1", "Sample2", "Sample3", "Sample4"}, "\t")
+	record := strings.Join([]string{"10", "1000", "rs123", "A", "T", "100", "PASS",
+		"AC=1", "GT", "0/0", "0/1", "1/1", "./."}, "\t")
+
+	lines := versionLine + "\n" + header + "\n" + record + "\n"
+
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", KeepPos: true, KeepID: true, KeepInfo: true}
+
+	expHeader := strings.Split(StringHeader(&config), string(tabByte))
+	expLen := 19
+
+	// keepPos adds 1 field, keepID adds 1, and keepInfo adds 2 (alleleIdx, info)
+	if len(expHeader) != expLen {
+		t.Errorf("with keepID and keepInfo, expect %d fields in header output", expLen)
+	}
+
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	results := bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+
+		if resultRow[0] != "chr10" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if resultRow[5] != "2" {
+			t.Error("Transversions should have value 2", resultRow)
+		}
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		if resultRow[len(resultRow)-4] != "1000" {
+			t.Error("with keepPos, should get original input position as first optional field")
+		}
+
+		if resultRow[len(resultRow)-3] != "rs123" {
+			t.Error("Expect ID field after vcfPos")
+		}
+
+		if resultRow[len(resultRow)-2] == "0" && resultRow[len(resultRow)-1] == "AC=1" {
+			t.Log("OK: add INFO field correctly for single field")
+		} else {
+			t.Error("NOT OK: Couldn't add INFO field", resultRow)
+		}
+
+		if resultRow[6] == "Sample2" {
+			t.Log("OK: Recapitualte the het", resultRow)
+		} else {
+			t.Error("NOT OK: Couldn't recapitualte the het", resultRow)
+		}
+
+		// heterozygosity
+		// the denominator excludes the missing samples
+		if resultRow[7] == strconv.FormatFloat(float64(1)/float64(3), 'G', 3, 64) {
+			t.Log("OK: Recapitualte the heterozygosity", resultRow)
+		} else {
+			t.Error("NOT OK: Couldn't recapitualte the heterozygosity", resultRow)
+		}
+
+		if resultRow[8] == "Sample3" {
+			t.Log("OK: Recapitualte the homozygote", resultRow)
+		} else {
+			t.Error("NOT OK: Couldn't recapitualte the homozygote", resultRow)
+		}
+
+		// homozygosity
+		// the denominator excludes the missing samples
+		if resultRow[9] == strconv.FormatFloat(float64(1)/float64(3), 'G', 3, 64) {
+			t.Log("OK: Recapitualte the homozygosity", resultRow)
+		} else {
+			t.Error("NOT OK: Couldn't recapitualte the homozygosity", resultRow)
+		}
+
+		if resultRow[10] == "Sample4" {
+			t.Log("OK: Recapitualte the missing sample", resultRow)
+		} else {
+			t.Error("NOT OK: Couldn't recapitualte the missing sample", resultRow)
+		}
+
+		// missingness
+		// missingness denominator does not exclude missing samples
+		if resultRow[11] == strconv.FormatFloat(float64(1)/float64(4), 'G', 3, 64) {
+			t.Log("OK: Recapitualte the missingness", resultRow)
+		} else {
+			t.Error("NOT OK: Couldn't recapitualte the missingness", resultRow)
+		}
+
+		ac, _ := strconv.Atoi(resultRow[12])
+		an, _ := strconv.Atoi(resultRow[13])
+		sampleMaf := resultRow[14]
+		eMaf := strconv.FormatFloat(float64(3)/float64(6), 'G', precision, 64)
+
+		// sampleMaf ; 2 alleles for 1|1, 1 allele for 0|1 and 0 in denominator for .|.
+		if ac == 3 && an == 6 && sampleMaf == eMaf {
+			t.Log("OK: sampleMaf will count homozygotes, heterozygotes, and will exclude missing alleles from denominator", resultRow)
+		} else {
+			t.Error("NOT OK: sampleMaf will count homozygotes, heterozygotes, and will exclude missing alleles from denominator", resultRow)
+		}
+	}
+
+	record = strings.Join([]string{"10", "1000", "rs456", "C", "T,G", "100", "PASS",
+		"AC=1", "GT", "1|1", "0|0", "0|2", ".|."}, "\t")
+
+	lines = versionLine + "\n" + header + "\n" + record + "\n"
+	reader = bufio.NewReader(strings.NewReader(lines))
+
+	index := -1
+	byteBuf = new(bytes.Buffer)
+	w = bufio.NewWriter(byteBuf)
+
+	results = bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+		index++
+
+		if resultRow[0] != "chr10" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		if resultRow[len(resultRow)-4] != "1000" {
+			t.Error("with keepPos, should get original input position as first optional field, for each allele in multialelic")
+		}
+
+		if resultRow[len(resultRow)-3] == "rs456" {
+			t.Log("OK: add ID field correctly for multiple field, index", altIdx)
+		} else {
+			t.Error("NOT OK: Couldn't add ID field", altIdx, resultRow)
+		}
+
+		altIdx, err := strconv.Atoi(resultRow[len(resultRow)-2])
+
+		if err != nil {
+			t.Error("NOT OK: The 9th column should be numeric")
+		}
+
+		if altIdx == index {
+			t.Log("OK: Multiallelic index is in 10th column when keepInfo is true")
+		} else {
+			t.Error("NOT OK: Multiallelic index isn't in 10th column when keepInfo is true", resultRow)
+		}
+
+		if resultRow[len(resultRow)-1] == "AC=1" {
+			t.Log("OK: add INFO field correctly for multiallelic field in column 10")
+		} else {
+			t.Error("NOT OK: Couldn't add INFO field", resultRow)
+		}
+
+		// missingness
+		// denominator does not exclude missingness
+		if resultRow[11] == strconv.FormatFloat(float64(1)/float64(4), 'G', 3, 64) {
+			t.Log("OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		} else {
+			t.Error("NOT OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		}
+
+		if index == 0 {
+			// heterozygosity
+			if resultRow[7] == "0" {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			// homozygosity
+			// the denominator excludes the missing samples
+			if resultRow[9] == strconv.FormatFloat(float64(1)/float64(3), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(2)/float64(6), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 1|1 and 0 in denominator for .|.
+			if ac == 2 && an == 6 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		} else if index == 1 {
+			// heterozygosity
+			// the denominator excludes the missing samples
+			if resultRow[7] == strconv.FormatFloat(float64(1)/float64(3), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			// homozygosity
+			if resultRow[9] == "0" {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(1)/float64(6), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 0|2 and 0 in denominator for .|.
+			if ac == 1 && an == 6 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		}
+	}
+
+	if index != 1 {
+		t.Error("NOT OK: Expected to parse 2 alleles, parsed fewer")
+	}
+
+	// repeat but with "/"
+	record = strings.Join([]string{"10", "1000", "rs456", "C", "T,G", "100", "PASS",
+		"AC=1", "GT", "1/1", "0/0", "0/2", "./."}, "\t")
+
+	lines = versionLine + "\n" + header + "\n" + record + "\n"
+	reader = bufio.NewReader(strings.NewReader(lines))
+
+	index = -1
+	byteBuf = new(bytes.Buffer)
+	w = bufio.NewWriter(byteBuf)
+
+	results = bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+		index++
+
+		if resultRow[0] != "chr10" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		if resultRow[len(resultRow)-4] != "1000" {
+			t.Error("with keepPos, should get original input position as first optional field")
+		}
+
+		if resultRow[len(resultRow)-3] == "rs456" {
+			t.Log("OK: add ID field correctly for multiple field, index", altIdx)
+		} else {
+			t.Error("NOT OK: Couldn't add ID field", altIdx, resultRow)
+		}
+
+		altIdx, err := strconv.Atoi(resultRow[len(resultRow)-2])
+
+		if err != nil {
+			t.Error("NOT OK: The 9th column should be numeric")
+		}
+
+		if altIdx == index {
+			t.Log("OK: Multiallelic index is in 10th column when keepInfo is true")
+		} else {
+			t.Error("NOT OK: Multiallelic index isn't in 10th column when keepInfo is true", resultRow)
+		}
+
+		if resultRow[len(resultRow)-1] == "AC=1" {
+			t.Log("OK: add INFO field correctly for multiallelic field in column 10")
+		} else {
+			t.Error("NOT OK: Couldn't add INFO field", resultRow)
+		}
+
+		// missingness
+		// denominator does not exclude missingness
+		if resultRow[11] == strconv.FormatFloat(float64(1)/float64(4), 'G', 3, 64) {
+			t.Log("OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		} else {
+			t.Error("NOT OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		}
+
+		if index == 0 {
+			// heterozygosity
+			if resultRow[7] == "0" {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			// homozygosity
+			// the denominator excludes the missing samples
+			if resultRow[9] == strconv.FormatFloat(float64(1)/float64(3), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+
+			eMaf := strconv.FormatFloat(float64(2)/float64(6), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 1|1 and 0 in denominator for .|.
+			if ac == 2 && an == 6 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		} else if index == 1 {
+			// The "2" allele
+			// heterozygosity
+			// the denominator excludes the missing samples
+			if resultRow[7] == strconv.FormatFloat(float64(1)/float64(3), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			// homozygosity
+			if resultRow[9] == "0" {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(1)/float64(6), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 0|2 and 0 in denominator for .|.
+			if ac == 1 && an == 6 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		}
+	}
+
+	if index != 1 {
+		t.Error("NOT OK: Expected to parse 2 alleles, parsed fewer")
+	}
+
+	// repeat but with "|" and GT
+	record = strings.Join([]string{"10", "1000", "rs456", "C", "T,G", "100", "PASS",
+		"AC=1", "GT:GQ", "1|1:1,2,3", "0|0:4,5,6", "0|2:1,3,5", ".|.:0,0,0"}, "\t")
+
+	lines = versionLine + "\n" + header + "\n" + record + "\n"
+	reader = bufio.NewReader(strings.NewReader(lines))
+
+	index = -1
+	byteBuf = new(bytes.Buffer)
+	w = bufio.NewWriter(byteBuf)
+
+	results = bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+		index++
+
+		if resultRow[0] != "chr10" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		if resultRow[len(resultRow)-4] != "1000" {
+			t.Error("with keepPos, should get original input position as first optional field")
+		}
+
+		if resultRow[len(resultRow)-3] == "rs456" {
+			t.Log("OK: add ID field correctly for multiple field, index", altIdx)
+		} else {
+			t.Error("NOT OK: Couldn't add ID field", altIdx, resultRow)
+		}
+
+		altIdx, err := strconv.Atoi(resultRow[len(resultRow)-2])
+
+		if err != nil {
+			t.Error("NOT OK: The 9th column should be numeric")
+		}
+
+		if altIdx == index {
+			t.Log("OK: Multiallelic index is in 10th column when keepInfo is true")
+		} else {
+			t.Error("NOT OK: Multiallelic index isn't in 10th column when keepInfo is true", resultRow)
+		}
+
+		if resultRow[len(resultRow)-1] == "AC=1" {
+			t.Log("OK: add INFO field correctly for multiallelic field in column 10")
+		} else {
+			t.Error("NOT OK: Couldn't add INFO field", resultRow)
+		}
+
+		// missingness
+		// denominator does not exclude missingness
+		if resultRow[11] == strconv.FormatFloat(float64(1)/float64(4), 'G', 3, 64) {
+			t.Log("OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		} else {
+			t.Error("NOT OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		}
+
+		// This will be the first allele encountered (by ALT field comma-separated order
+		if index == 0 {
+			//
+			// heterozygosity
+			if resultRow[7] == "0" {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			// homozygosity
+			// the denominator excludes the missing samples
+			if resultRow[9] == strconv.FormatFloat(float64(1)/float64(3), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(2)/float64(6), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 1|1 and 0 in denominator for .|.
+			if ac == 2 && an == 6 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		} else if index == 1 {
+			// heterozygosity
+			// the denominator excludes the missing samples
+			if resultRow[7] == strconv.FormatFloat(float64(1)/float64(3), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			// homozygosity
+			if resultRow[9] == "0" {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(1)/float64(6), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 0|2 and 0 in denominator for .|.
+			if ac == 1 && an == 6 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		}
+	}
+
+	if index != 1 {
+		t.Error("NOT OK: Expected to parse 2 alleles, parsed fewer")
+	}
+
+	// repeat but with "/" and GT
+	// Note, that we no longer expect missing records to have genotype quality strings
+	record = strings.Join([]string{"10", "1000", "rs456", "C", "T,G", "100", "PASS",
+		"AC=1", "GT:GQ", "1/1:1,2,3", "0/0:4,5,6", "0/2:1,3,5", "./."}, "\t")
+
+	lines = versionLine + "\n" + header + "\n" + record + "\n"
+	reader = bufio.NewReader(strings.NewReader(lines))
+
+	index = -1
+	byteBuf = new(bytes.Buffer)
+	w = bufio.NewWriter(byteBuf)
+
+	results = bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+		index++
+
+		if resultRow[0] != "chr10" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		if resultRow[len(resultRow)-4] != "1000" {
+			t.Error("with keepPos, should get original input position as first optional field")
+		}
+
+		if resultRow[len(resultRow)-3] == "rs456" {
+			t.Log("OK: add ID field correctly for multiple field, index", altIdx)
+		} else {
+			t.Error("NOT OK: Couldn't add ID field", altIdx, resultRow)
+		}
+
+		altIdx, err := strconv.Atoi(resultRow[len(resultRow)-2])
+
+		if err != nil {
+			t.Error("NOT OK: The 9th column should be numeric")
+		}
+
+		if altIdx == index {
+			t.Log("OK: Multiallelic index is in 10th column when keepInfo is true")
+		} else {
+			t.Error("NOT OK: Multiallelic index isn't in 10th column when keepInfo is true", resultRow)
+		}
+
+		if resultRow[len(resultRow)-1] == "AC=1" {
+			t.Log("OK: add INFO field correctly for multiallelic field in column 10")
+		} else {
+			t.Error("NOT OK: Couldn't add INFO field", resultRow)
+		}
+
+		// missingness
+		// denominator does not exclude missingness
+		if resultRow[11] == strconv.FormatFloat(float64(1)/float64(4), 'G', 3, 64) {
+			t.Log("OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		} else {
+			t.Error("NOT OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		}
+
+		if index == 0 {
+			// heterozygosity
+			if resultRow[7] == "0" {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			// homozygosity
+			// the denominator excludes the missing samples
+			if resultRow[9] == strconv.FormatFloat(float64(1)/float64(3), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(2)/float64(6), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 1|1 and 0 in denominator for .|.
+			if ac == 2 && an == 6 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		} else if index == 1 {
+			// heterozygosity
+			// the denominator excludes the missing samples
+			if resultRow[7] == strconv.FormatFloat(float64(1)/float64(3), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			// homozygosity
+			if resultRow[9] == "0" {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			// missingness
+			if resultRow[11] == strconv.FormatFloat(float64(1)/float64(4), 'G', 3, 64) {
+				t.Log("OK: could recapitulate missingness even when the misssing genotype doesn't have the expected FORMAT data", resultRow)
+			} else {
+				t.Error("NOT OK: couldn't recapitulate missingness even when the misssing genotype doesn't have the expected FORMAT data", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(1)/float64(6), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 0|2 and 0 in denominator for .|.
+			if ac == 1 && an == 6 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		}
+	}
+
+	if index != 1 {
+		t.Error("NOT OK: Expected to parse 2 alleles, parsed fewer")
+	}
+
+	// Test with no missing alleles
+	header = strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL",
+		"FILTER", "INFO", "FORMAT", "Sample1", "Sample2", "Sample3", "Sample4", "Sample5"}, "\t")
+	record = strings.Join([]string{"15", "1001", "rs457", "C", "T,G", "100", "PASS",
+		"AC=1", "GT", "0|1", "2|0", "2|2", "0|0", "1|0"}, "\t")
+
+	lines = versionLine + "\n" + header + "\n" + record + "\n"
+
+	reader = bufio.NewReader(strings.NewReader(lines))
+
+	index = -1
+	byteBuf = new(bytes.Buffer)
+	w = bufio.NewWriter(byteBuf)
+
+	results = bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+		index++
+
+		if resultRow[0] != "chr15" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		if resultRow[len(resultRow)-4] != "1001" {
+			t.Error("with keepPos, should get original input position as first optional field")
+		}
+
+		if resultRow[len(resultRow)-3] == "rs457" {
+			t.Log("OK: add ID field correctly for multiple field, index", altIdx)
+		} else {
+			t.Error("NOT OK: Couldn't add ID field", altIdx, resultRow)
+		}
+
+		altIdx, err := strconv.Atoi(resultRow[len(resultRow)-2])
+
+		if err != nil {
+			t.Error("NOT OK: The 9th column should be numeric")
+		}
+
+		if altIdx == index {
+			t.Log("OK: Multiallelic index is in 10th column when keepInfo is true")
+		} else {
+			t.Error("NOT OK: Multiallelic index isn't in 10th column when keepInfo is true", resultRow)
+		}
+
+		if resultRow[len(resultRow)-1] == "AC=1" {
+			t.Log("OK: add INFO field correctly for multiallelic field in column 10")
+		} else {
+			t.Error("NOT OK: Couldn't add INFO field", resultRow)
+		}
+
+		// missingness
+		// denominator does not exclude missingness
+		if resultRow[11] == "0" {
+			t.Log("OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		} else {
+			t.Error("NOT OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		}
+
+		if index == 0 {
+			// heterozygosity
+			if resultRow[7] == strconv.FormatFloat(float64(2)/float64(5), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			// homozygosity
+			// the denominator excludes the missing samples
+			if resultRow[9] == "0" {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(2)/float64(10), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 1|1 and 0 in denominator for .|.
+			if ac == 2 && an == 10 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		} else if index == 1 {
+			// heterozygosity: 1 het for 2|0
+			// the denominator excludes the missing samples
+			if resultRow[7] == strconv.FormatFloat(float64(1)/float64(5), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			// homozygosity: 1 homozygote (2|2)
+			if resultRow[9] == strconv.FormatFloat(float64(1)/float64(5), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(3)/float64(10), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 2|2
+			if ac == 3 && an == 10 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		}
+	}
+
+	if index != 1 {
+		t.Error("NOT OK: Expected to parse 2 alleles, parsed fewer")
+	}
+
+	// Test with no missing alleles, and "/" delimiter
+	header = strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL",
+		"FILTER", "INFO", "FORMAT", "Sample1", "Sample2", "Sample3", "Sample4", "Sample5"}, "\t")
+	record = strings.Join([]string{"15", "1002", "rs457", "C", "T,G", "100", "PASS",
+		"AC=2", "GT", "0/1", "2/0", "2/2", "0/0", "1/0"}, "\t")
+
+	lines = versionLine + "\n" + header + "\n" + record + "\n"
+
+	reader = bufio.NewReader(strings.NewReader(lines))
+
+	index = -1
+	byteBuf = new(bytes.Buffer)
+	w = bufio.NewWriter(byteBuf)
+
+	results = bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+		index++
+
+		if resultRow[0] != "chr15" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		if resultRow[len(resultRow)-4] != "1002" {
+			t.Error("with keepPos, should get original input position as first optional field")
+		}
+
+		if resultRow[len(resultRow)-3] == "rs457" {
+			t.Log("OK: add ID field correctly for multiple field, index", altIdx)
+		} else {
+			t.Error("NOT OK: Couldn't add ID field", altIdx, resultRow)
+		}
+
+		altIdx, err := strconv.Atoi(resultRow[len(resultRow)-2])
+
+		if err != nil {
+			t.Error("NOT OK: The 9th column should be numeric")
+		}
+
+		if altIdx == index {
+			t.Log("OK: Multiallelic index is in 10th column when keepInfo is true")
+		} else {
+			t.Error("NOT OK: Multiallelic index isn't in 10th column when keepInfo is true", resultRow)
+		}
+
+		if resultRow[len(resultRow)-1] == "AC=2" {
+			t.Log("OK: add INFO field correctly for multiallelic field in column 10")
+		} else {
+			t.Error("NOT OK: Couldn't add INFO field", resultRow)
+		}
+
+		// missingness
+		// denominator does not exclude missingness
+		if resultRow[11] == "0" {
+			t.Log("OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		} else {
+			t.Error("NOT OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		}
+
+		if index == 0 {
+			// heterozygosity
+			if resultRow[7] == strconv.FormatFloat(float64(2)/float64(5), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			// homozygosity
+			// the denominator excludes the missing samples
+			if resultRow[9] == "0" {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(2)/float64(10), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 1|1 and 0 in denominator for .|.
+			if ac == 2 && an == 10 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		} else if index == 1 {
+			// heterozygosity: 1 het for 2|0
+			// the denominator excludes the missing samples
+			if resultRow[7] == strconv.FormatFloat(float64(1)/float64(5), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			// homozygosity: 1 homozygote (2|2)
+			if resultRow[9] == strconv.FormatFloat(float64(1)/float64(5), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(3)/float64(10), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 2|2
+			if ac == 3 && an == 10 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		}
+	}
+
+	if index != 1 {
+		t.Error("NOT OK: Expected to parse 2 alleles, parsed fewer")
+	}
+
+	// Test with no missing alleles, "/" delimiter and stuff after the genotype
+	header = strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL",
+		"FILTER", "INFO", "FORMAT", "Sample1", "Sample2", "Sample3", "Sample4", "Sample5"}, "\t")
+	record = strings.Join([]string{"15", "1001", "rs457", "C", "T,G", "100", "PASS",
+		"AC=2", "GT:GL", "0/1:4,5,6", "2/0:7,8,9", "2/2:1,2,3", "0/0:.,.,.", "1/0:1,2,5"}, "\t")
+
+	lines = versionLine + "\n" + header + "\n" + record + "\n"
+
+	reader = bufio.NewReader(strings.NewReader(lines))
+
+	index = -1
+	byteBuf = new(bytes.Buffer)
+	w = bufio.NewWriter(byteBuf)
+
+	results = bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		resultRow := strings.Split(results.Text(), "\t")
+		index++
+
+		if resultRow[0] != "chr15" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		if resultRow[len(resultRow)-4] != "1001" {
+			t.Error("with keepPos, should get original input position as first optional field")
+		}
+
+		if resultRow[len(resultRow)-3] == "rs457" {
+			t.Log("OK: add ID field correctly for multiple field, index", altIdx)
+		} else {
+			t.Error("NOT OK: Couldn't add ID field", altIdx, resultRow)
+		}
+
+		altIdx, err := strconv.Atoi(resultRow[len(resultRow)-2])
+
+		if err != nil {
+			t.Error("NOT OK: The 9th column should be numeric")
+		}
+
+		if altIdx == index {
+			t.Log("OK: Multiallelic index is in 10th column when keepInfo is true")
+		} else {
+			t.Error("NOT OK: Multiallelic index isn't in 10th column when keepInfo is true", resultRow)
+		}
+
+		if resultRow[len(resultRow)-1] == "AC=2" {
+			t.Log("OK: add INFO field correctly for multiallelic field in column 10")
+		} else {
+			t.Error("NOT OK: Couldn't add INFO field", resultRow)
+		}
+
+		// missingness
+		// denominator does not exclude missingness
+		if resultRow[11] == "0" {
+			t.Log("OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		} else {
+			t.Error("NOT OK: Missingness is identical for each allele in multiallelic output", resultRow)
+		}
+
+		if index == 0 {
+			// heterozygosity
+			if resultRow[7] == strconv.FormatFloat(float64(2)/float64(5), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			// homozygosity
+			// the denominator excludes the missing samples
+			if resultRow[9] == "0" {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 1st allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(2)/float64(10), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 1|1 and 0 in denominator for .|.
+			if ac == 2 && an == 10 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		} else if index == 1 {
+			// heterozygosity: 1 het for 2|0
+			// the denominator excludes the missing samples
+			if resultRow[7] == strconv.FormatFloat(float64(1)/float64(5), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			// homozygosity: 1 homozygote (2|2)
+			if resultRow[9] == strconv.FormatFloat(float64(1)/float64(5), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(3)/float64(10), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 2|2
+			if ac == 3 && an == 10 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 2nd allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			}
+		}
+	}
+
+	if index != 1 {
+		t.Error("NOT OK: Expected to parse 2 alleles, parsed fewer")
+	}
+}
+
+func TestOutputMultiallelic(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO",
+		"Format", "Sample1", "Sample2", "Sample3", "Sample4"}, "\t")
+	//Test example 5.2.4 https://samtools.github.io/hts-specs/VCFv4.2.pdf
+	//Except use A as last base, to properly distinguish first and last base of reference
+	record := strings.Join([]string{"20", "4", ".", "GCACG", "G,GTCACACG", ".", "PASS", "DP=100",
+		"GT", "0|0", "0|1", "2|2", ".|."}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + record + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters}
+
+	expHeader := strings.Split(StringHeader(&config), string(tabByte))
+	expLen := 15
+
+	if len(expHeader) != expLen {
+		t.Errorf("Expect %d fields in base header %v", expLen, expHeader)
+	}
+
+	index := -1
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	results := bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		index++
+		resultRow := strings.Split(results.Text(), "\t")
+
+		if resultRow[0] != "chr20" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if resultRow[5] != "0" {
+			t.Error("Multiallelics should be called neither transitions nor transversions with value 0", resultRow)
+		}
+
+		if len(resultRow) != expLen {
+			t.Errorf("NOT OK: Expected %d fields: %v", expLen, resultRow)
+		}
+
+		if index == 0 {
+			if resultRow[altIdx] == "-4" && resultRow[posIdx] == "5" && resultRow[refIdx] == "C" {
+				t.Log("OK: 4 base deletion recapitulated", resultRow)
+			} else {
+				t.Error("NOT OK: 4 base deletion not recapitulated", resultRow)
+			}
+
+			if resultRow[6] == "Sample2" {
+				t.Log("OK: Recapitualte 1st allele het", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte 1st allele het", resultRow)
+			}
+
+			if resultRow[8] == config.EmptyField {
+				t.Log("OK: Recapitualte 1st allele has no homozygotes", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte 1st allele has no homozygotes", resultRow)
+			}
+
+			if resultRow[10] == "Sample4" {
+				t.Log("OK: Recapitualte 1st allele missing for Sample4", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte 1st allele missing for Sample4", resultRow)
+			}
+
+			// heterozygosity
+			// the denominator excludes the missing samples
+			if resultRow[7] == strconv.FormatFloat(float64(1)/float64(3), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case", resultRow)
+			}
+
+			// homozygosity
+			if resultRow[9] == "0" {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case", resultRow)
+			}
+
+			// missingness
+			// the denominator of missingness does not exclude the missing samples
+			if resultRow[11] == strconv.FormatFloat(float64(1)/float64(4), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the missingness in multialellic case", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the missingness in multiallelic case", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(1)/float64(6), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 0|1 and 0 in denominator for .|.
+			if ac == 1 && an == 6 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 1st allele will count in denominator all multiallelic alleles, but will exclude missing alleles", ac, an, sampleMaf, float64(1)/float64(6), resultRow)
+			}
+		}
+
+		if index == 1 {
+			if resultRow[altIdx] == "+TCA" && resultRow[posIdx] == "4" && resultRow[refIdx] == "G" {
+				t.Log("OK: 3 base insertion recapitulated", resultRow)
+			} else {
+				t.Error("NOT OK: 3 base insertion not recapitulated", resultRow)
+			}
+
+			if resultRow[6] == config.EmptyField {
+				t.Log("OK: Recapitualte 2nd allele het", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte 2nd allele het", resultRow)
+			}
+
+			if resultRow[8] == "Sample3" {
+				t.Log("OK: Recapitualte 2nd allele has Sample3 as homozygous", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte 2nd allele has Sample3 as homozygous", resultRow)
+			}
+
+			if resultRow[10] == "Sample4" {
+				t.Log("OK: Recapitualte 2nd allele is missing for Sample4", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte 2nd allele missing for Sample4", resultRow)
+			}
+
+			// heterozygosity
+			if resultRow[7] == "0" {
+				t.Log("OK: Recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the heterozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			// homozygosity
+			// the denominator excludes the missing samples
+			if resultRow[9] == strconv.FormatFloat(float64(1)/float64(3), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the homozygosity in multiallelic case for 2nd allele", resultRow)
+			}
+
+			// missingness
+			// the denominator of missingness does not exclude the missing samples
+			if resultRow[11] == strconv.FormatFloat(float64(1)/float64(4), 'G', 3, 64) {
+				t.Log("OK: Recapitualte the missingness in multialellic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: Couldn't recapitualte the missingness in multiallelic case for 2nd allele", resultRow)
+			}
+
+			ac, _ := strconv.Atoi(resultRow[12])
+			an, _ := strconv.Atoi(resultRow[13])
+			sampleMaf := resultRow[14]
+			eMaf := strconv.FormatFloat(float64(2)/float64(6), 'G', precision, 64)
+
+			// sampleMaf ; 2 alleles for 2|2 and 0 in denominator for .|.
+			if ac == 2 && an == 6 && sampleMaf == eMaf {
+				t.Log("OK: sampleMaf in multialellic case for 2nd allele", resultRow)
+			} else {
+				t.Error("NOT OK: sampleMaf in multialellic case for 2nd allele", resultRow)
+			}
+		}
+	}
+
+	if index == 1 {
+		t.Log("OK: parsed 2 alleles")
+	} else {
+		t.Error("NOT OK: Expected to parse 2 alleles")
+	}
+}
+
+func TestOutputComplexMultiDel(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL",
+		"FILTER", "INFO"}, "\t")
+	//Test example 5.2.4 https://samtools.github.io/hts-specs/VCFv4.2.pdf
+	//Test from gnomad genomes
+	record := strings.Join([]string{"16", "84034434", "rs141446650", "GAGGGAGACAGAGGGAAGT",
+		"G,GGGGAGACAGAGGGAAGT", ".", "PASS", "DP=100"}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + record + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters}
+
+	index := -1
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	results := bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		index++
+		resultRow := strings.Split(results.Text(), "\t")
+
+		if resultRow[0] != "chr16" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		// heterozygosity
+		if resultRow[9] == "0" {
+			t.Log("OK: When no samples provided, heterozygosity is 0", resultRow)
+		} else {
+			t.Error("NOT OK: When no samples provided, heterozygosity is not 0", resultRow)
+		}
+
+		// homozygosity
+		if resultRow[9] == "0" {
+			t.Log("OK: When no samples provided, homozygosity is 0", resultRow)
+		} else {
+			t.Error("NOT OK: When no samples provided, homozygosity is not 0", resultRow)
+		}
+
+		// missingness
+		if resultRow[11] == "0" {
+			t.Log("OK: When no samples provided, missingness is 0", resultRow)
+		} else {
+			t.Error("NOT OK: When no samples provided, missingness is not 0", resultRow)
+		}
+
+		if index == 0 {
+			if resultRow[refIdx] == "A" && resultRow[posIdx] == strconv.Itoa(84034434+1) && resultRow[altIdx] == "-18" {
+				t.Log("OK: 18 base deletion recapitulated", resultRow)
+			} else {
+				t.Error("NOT OK: 18 base deletion not recapitulated", resultRow)
+			}
+		}
+
+		if index == 1 {
+			if resultRow[refIdx] == "A" && resultRow[posIdx] == strconv.Itoa(84034434+1) && resultRow[altIdx] == "-1" {
+				t.Log("OK: Complex 1 base deletion recapitulated", resultRow)
+			} else {
+				t.Error("NOT OK: 1 base deletion not recapitulated", resultRow)
+			}
+		}
+	}
+
+	if index == 1 {
+		t.Log("OK: parsed 2 alleles")
+	} else {
+		t.Error("NOT OK: Expected to parse 2 alleles")
+	}
+}
+
+func TestOutputComplexDel(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL",
+		"FILTER", "INFO"}, "\t")
+	//Test example 5.2.4 https://samtools.github.io/hts-specs/VCFv4.2.pdf
+	//Test from gnomad genomes
+	record := strings.Join([]string{"1", "874816", "rs200996316",
+		"CCCCCTCATCACCTCCCCAGCCACGGTGAGGACCCACCCTGGCATGATCT",
+		"CCCCCTCATCACCTCCCCAGCCACGGTGAGGACCCACCCTGGCATGATCTCCCCTCATCACCTCCCCAGCCACGGTGAGGACCCACCCTGGCATGATCT,GCCCCTCATCACCTCCCCAGCCACGGTGAGGACCCACCCTGGCATGATCT,C,CTCCCCTCATCACCTCCCCAGCCACGGTGAGGACCCACCCTGGCATGATCT",
+		".", "PASS", "DP=100"}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + record + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters}
+
+	index := -1
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	results := bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		index++
+		resultRow := strings.Split(results.Text(), "\t")
+
+		if resultRow[0] != "chr1" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if index == 0 {
+			if resultRow[refIdx] == "C" && resultRow[posIdx] == "874816" && resultRow[altIdx] == "+CCCCTCATCACCTCCCCAGCCACGGTGAGGACCCACCCTGGCATGATCT" {
+				t.Log("OK: Intercolated insertion +CCCCTCATCACCTCCCCAGCCACGGTGAGGACCCACCCTGGCATGATCT in complex, multiallelic microsatellite recapitulated", resultRow)
+			} else {
+				t.Error("NOT OK: Intercolated insertion +CCCCTCATCACCTCCCCAGCCACGGTGAGGACCCACCCTGGCATGATCT in complex, multiallelic microsatellite not recapitulated", resultRow)
+			}
+		}
+
+		if index == 1 {
+			if resultRow[refIdx] == "C" && resultRow[posIdx] == "874816" && resultRow[altIdx] == "G" {
+				t.Log("OK: SNP in complex ultiallelic microsatellite recapitulated", resultRow)
+			} else {
+				t.Error("NOT OK: SNP in complex multiallelic microsatellite recapitulated", resultRow)
+			}
+		}
+
+		if index == 2 {
+			if resultRow[refIdx] == "C" && resultRow[posIdx] == "874817" && resultRow[altIdx] == "-49" {
+				t.Log("OK: 49bp DEL in complex microsatellite multiallelic recapitulated", resultRow)
+			} else {
+				t.Error("NOT OK: 49bp DEL in complex microsatellite multiallelic recapitulated", resultRow)
+			}
+		}
+
+		if index == 3 {
+			if resultRow[refIdx] == "C" && resultRow[posIdx] == "874816" && resultRow[altIdx] == "+T" {
+				t.Log("OK: Intercolated insertion +T recapitulated", resultRow)
+			} else {
+				t.Error("NOT OK: Intercolated insertion +T not recapitulated", resultRow)
+			}
+		}
+	}
+
+	if index == 3 {
+		t.Log("Ok, recapitulated 4 alleles")
+	} else {
+		t.Error("expected 4 alleles")
+	}
+}
+
+func TestOutputMultiallelicSnp(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL",
+		"FILTER", "INFO"}, "\t")
+	//Test example 5.2.4 https://samtools.github.io/hts-specs/VCFv4.2.pdf
+	//Test from 1000 genomes
+	record := strings.Join([]string{"1", "1265061", "rs138351882;rs563042459",
+		"CGT", "TGT,C", ".", "PASS", "DP=100"}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + record + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters}
+
+	index := -1
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	results := bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		index++
+		resultRow := strings.Split(results.Text(), "\t")
+
+		if resultRow[0] != "chr1" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		fmt.Println(index, resultRow)
+		if index == 0 {
+			if resultRow[refIdx] == "C" && resultRow[posIdx] == "1265061" && resultRow[altIdx] == "T" {
+				t.Log("OK: Complex SNP in multiallelic SNP/DEL annotated correctly", resultRow)
+			} else {
+				t.Error("NOT OK: Complex SNP in multiallelic SNP/DEL annotated correctly", resultRow)
+			}
+		}
+
+		if index == 1 {
+			if resultRow[refIdx] == "G" && resultRow[posIdx] == "1265062" && resultRow[altIdx] == "-2" {
+				t.Log("OK: DEL in multiallelic SNP/DEL annotated correctly", resultRow)
+			} else {
+				t.Error("NOT OK: DEL in multiallelic SNP/DEL not annotated correctly", resultRow)
+			}
+		}
+	}
+
+	if index == 1 {
+		t.Log("Ok, recapitulated 4 alleles")
+	} else {
+		t.Error("expected 4 alleles")
+	}
+}
+
+func TestComplexSnp(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL",
+		"FILTER", "INFO"}, "\t")
+	//Test example 5.2.4 https://samtools.github.io/hts-specs/VCFv4.2.pdf
+	//Hypothetical, where a silly site lists the T->C 2 bases before it occurs
+	record := strings.Join([]string{"1", "1265062", "rs138351882;rs563042459",
+		"CGT", "CGA", ".", "PASS", "DP=100"}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + record + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters}
+
+	index := -1
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	results := bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		index++
+		resultRow := strings.Split(results.Text(), "\t")
+
+		if resultRow[0] != "chr1" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if index == 0 {
+			if resultRow[refIdx] == "T" && resultRow[posIdx] == "1265064" && resultRow[altIdx] == "A" {
+				t.Log("OK: Complex SNP annotated correctly", resultRow)
+			} else {
+				t.Error("NOT OK: Complex SNP not annotated correctly", resultRow)
+			}
+		}
+	}
+
+	if index == 0 {
+		t.Log("Ok, recapitulated 1 alleles")
+	} else {
+		t.Error("expected 1 alleles")
+	}
+}
+
+func TestMNP(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL",
+		"FILTER", "INFO"}, "\t")
+	//Hypothetical
+	record := strings.Join([]string{"1", "1000", "rs138351882;rs563042459",
+		"ACGT", "GATC", ".", "PASS", "DP=100"}, "\t")
+
+	test := "Finds MNPs"
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + record + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters}
+
+	index := -1
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	results := bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	for results.Scan() {
+		index++
+		resultRow := strings.Split(results.Text(), "\t")
+
+		if resultRow[0] != "chr1" {
+			t.Error("chromosome should have chr appended", resultRow)
+		}
+
+		if index == 0 {
+			if resultRow[refIdx] == "A" && resultRow[posIdx] == "1000" && resultRow[altIdx] == "G" {
+				t.Logf("OK: %s", test)
+			} else {
+				t.Errorf("NOT OK: %s", test)
+			}
+		}
+
+		if index == 1 {
+			if resultRow[refIdx] == "C" && resultRow[posIdx] == "1001" && resultRow[altIdx] == "A" {
+				t.Logf("OK: %s", test)
+			} else {
+				t.Errorf("NOT OK: %s", test)
+			}
+		}
+
+		if index == 2 {
+			if resultRow[refIdx] == "G" && resultRow[posIdx] == "1002" && resultRow[altIdx] == "T" {
+				t.Logf("OK: %s", test)
+			} else {
+				t.Errorf("NOT OK: %s", test)
+			}
+		}
+
+		if index == 3 {
+			if resultRow[refIdx] == "T" && resultRow[posIdx] == "1003" && resultRow[altIdx] == "C" {
+				t.Logf("OK: %s", test)
+			} else {
+				t.Errorf("NOT OK: %s", test)
+			}
+		}
+	}
+
+	if index == 3 {
+		t.Logf("OK: %s", test)
+	} else {
+		t.Errorf("NOT OK: %s", test)
+	}
+}
+
+func TestManyAlleles(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S1_2", "S2", "S3", "S4", "S5", "S6", "S7", "S8", "S9", "S10", "S11", "S11_HAPLOID"}, "\t")
+	record := strings.Join([]string{"1", "1000", "rs1", "A", "AA,AC,AG,AT,C,G,T,ATA,ATC,ATG,ATT", ".", "PASS", "DP=100", "GT", "1|1", "1|1", "2|2", "3|3", "4|4", "5|5", "6|6", "7|7", "8|8", "9|9", "10|10", "11|11", "11"}, "\t")
+
+	expectedAlleles := []string{"+A", "+C", "+G", "+T", "C", "G", "T", "+TA", "+TC", "+TG", "+TT", "+TT"}
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + record + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters}
+
+	index := -1
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	results := bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	// Example Row
+	//[chr1 1000 MULTIALLELIC A +TT 0 ! 0 S11;S11_HAPLOID 0.167 ! 0 3 23 0.13]
+
+	expectedGtCount := "25" // 2 * 12 + 1 for the haploid genotype
+	expectedAltDosages := []string{"4", "2", "2", "2", "2", "2", "2", "2", "2", "2", "3"}
+	expectHomozygotes := []string{"S1;S1_2", "S2", "S3", "S4", "S5", "S6", "S7", "S8", "S9", "S10", "S11;S11_HAPLOID"}
+	for results.Scan() {
+		index++
+
+		fields := strings.Split(results.Text(), "\t")
+
+		if fields[8] != expectHomozygotes[index] {
+			t.Errorf("Expected %s, got %s", expectHomozygotes[index], fields[8])
+		}
+
+		if fields[12] != expectedAltDosages[index] {
+			t.Errorf("Expected %s, got %s", expectedAltDosages[index], fields[12])
+		}
+
+		if fields[13] != expectedGtCount {
+			t.Errorf("Expected %s, got %s", expectedGtCount, fields[13])
+		}
+
+		if fields[altIdx] != expectedAlleles[index] {
+			t.Errorf("alt should be %s, but is %s", expectedAlleles[index], fields[altIdx])
+		}
+	}
+
+	if index+1 != 11 {
+		t.Errorf("NOT OK: 11 results not found. Found %d", index+1)
+	}
+}
+
+// test that we can write a genotype matrix
+func TestGenotypeMatrix(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "./test_genotype_matrix.feather")
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3"}, "\t")
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T", ".", "PASS", "DP=100", "GT", "1|1", "0|1", "0|0"}, "\t")
+	row2 := strings.Join([]string{"2", "200", "rs2", "C", "G", ".", "PASS", "DP=100", "GT", "0|1", "0|0", "1|1"}, "\t")
+	row3 := strings.Join([]string{"22", "300", "rs2", "G", "T", ".", "PASS", "DP=100", "GT", "0|.", "0|.", "1|1"}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + row1 + "\n" + row2 + "\n" + row3 + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters,
+		DosageMatrixOutPath: filePath}
+
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+
+	// Read dosage matrix
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// Create a new IPC reader
+	arrowReader, err := ipc.NewFileReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer arrowReader.Close()
+
+	for i := 0; i < arrowReader.NumRecords(); i++ {
+		record, err := arrowReader.Record(i)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for rowIdx := 0; rowIdx < int(record.NumRows()); rowIdx++ {
+			genotypeS1 := record.Column(1).(*array.Int8).Value(rowIdx)
+			genotypeS2 := record.Column(2).(*array.Int8).Value(rowIdx)
+			genotypeS3 := record.Column(3).(*array.Int8).Value(rowIdx)
+
+			switch record.Column(0).(*array.String).Value(rowIdx) {
+			case "chr1:1000:A:T":
+				if genotypeS1 != 2 || genotypeS2 != 1 || genotypeS3 != 0 {
+					t.Error("NOT OK: Expected 2,1,0, got", genotypeS1, genotypeS2, genotypeS3)
+				}
+			case "chr2:200:C:G":
+				if genotypeS1 != 1 || genotypeS2 != 0 || genotypeS3 != 2 {
+					t.Error("NOT OK: Expected 1,0,2, got", genotypeS1, genotypeS2, genotypeS3)
+				}
+			case "chr22:300:G:T":
+				if genotypeS1 != -1 && genotypeS2 != -1 && genotypeS3 != 2 {
+					t.Error("NOT OK: Expected dosage of 2 for S3 got ", genotypeS3)
+				}
+			default:
+				t.Fatal("Unknown row")
+			}
+		}
+	}
+}
+
+// test that we can write a genotype matrix
+func TestNoOut(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "./test_genotype_matrix.feather")
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3"}, "\t")
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T", ".", "PASS", "DP=100", "GT", "1|1", "0|1", "0|0"}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + row1 + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters,
+		DosageMatrixOutPath: filePath, NoOut: true}
+
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	results := bufio.NewScanner(byteBuf)
+
+	ReadVcf(context.Background(), &config, reader, w)
+	w.Flush()
+
+	index := -1
+	for results.Scan() {
+		index++
+	}
+
+	if index != -1 {
+		t.Error("NOT OK: Expected no output")
+	}
+
+	// Read dosage matrix
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// Create a new IPC reader
+	arrowReader, err := ipc.NewFileReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer arrowReader.Close()
+
+	if arrowReader.NumRecords() == 0 {
+		t.Error("NOT OK: Expected to write dosage matrix")
+	}
+}
+
+// test that we can write PLINK .bed/.bim/.fam files
+func TestPlinkOutput(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "test_plink")
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3"}, "\t")
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T", ".", "PASS", "DP=100", "GT", "1|1", "0|1", "0|0"}, "\t")
+	row2 := strings.Join([]string{"2", "200", "rs2", "C", "G", ".", "PASS", "DP=100", "GT", "0|1", "0|0", "1|1"}, "\t")
+	row3 := strings.Join([]string{"22", "300", "rs2", "G", "T", ".", "PASS", "DP=100", "GT", "0|.", "0|.", "1|1"}, "\t")
+	// A deletion, and an MNP, are written with the VCF's POS, REF and ALT, the MNP once
+	row4 := strings.Join([]string{"3", "400", "rs4", "AG", "A", ".", "PASS", "DP=100", "GT", "0|1", "0|0", "0|0"}, "\t")
+	row5 := strings.Join([]string{"4", "500", "rs5", "AC", "GT", ".", "PASS", "DP=100", "GT", "0|1", "1|1", "0|0"}, "\t")
+	// Triploid and tetraploid genotypes can't be written, whatever their alt count
+	row6 := strings.Join([]string{"5", "600", "rs6", "A", "T", ".", "PASS", "DP=100", "GT", "0/1/1", "0|0", "0|1"}, "\t")
+	row7 := strings.Join([]string{"5", "700", "rs7", "C", "G,T", ".", "PASS", "DP=100", "GT", "0/0/0/2", "1|0", "./."},
+		"\t")
+	// Haploid calls, e.g. of males on chrX, are written as homozygous
+	row8 := strings.Join([]string{"X", "800", "rs8", "A", "G", ".", "PASS", "DP=100", "GT", "1", "0/1", "0"}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + strings.Join([]string{row1, row2, row3, row4, row5, row6, row7, row8}, "\n") +
+		"\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	rejectsPath := filepath.Join(t.TempDir(), "rejects.tsv")
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters,
+		PlinkOutPrefix: prefix, NoOut: true, RejectsPath: rejectsPath}
+
+	if err := ReadVcf(context.Background(), &config, reader, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	bim, err := os.ReadFile(prefix + ".bim")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bed, err := os.ReadFile(prefix + ".bed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bimLines := strings.Split(strings.TrimSpace(string(bim)), "\n")
+
+	if len(bed) != 3+len(bimLines) {
+		t.Fatalf("NOT OK: Expected 1 .bed byte per .bim line, got %d bytes for %d lines", len(bed)-3, len(bimLines))
+	}
+
+	// Rows may be written in any order, but .bed and .bim rows must correspond
+	expected := map[string]byte{
+		// 2,1,0
+		"chr1\tchr1:1000:A:T\t0\t1000\tT\tA": 0x38,
+		// 1,0,2
+		"chr2\tchr2:200:C:G\t0\t200\tG\tC": 0x0e,
+		// -1,-1,2
+		"chr22\tchr22:300:G:T\t0\t300\tT\tG": 0x05,
+		// 1,0,0
+		"chr3\tchr3:400:AG:A\t0\t400\tA\tAG": 0x3e,
+		// 1,2,0
+		"chr4\tchr4:500:AC:GT\t0\t500\tGT\tAC": 0x32,
+		// 1 (haploid), 1, 0 (haploid)
+		"chrX\tchrX:800:A:G\t0\t800\tG\tA": 0x38,
+	}
+
+	if len(bimLines) != len(expected) {
+		t.Errorf("NOT OK: Expected %d .bim lines, got %q", len(expected), bimLines)
+	}
+
+	for i, line := range bimLines {
+		expectedByte, ok := expected[line]
+		if !ok {
+			t.Fatalf("NOT OK: Unexpected .bim line %q", line)
+		}
+
+		if bed[3+i] != expectedByte {
+			t.Errorf("NOT OK: Expected %08b for %q, got %08b", expectedByte, line, bed[3+i])
+		}
+	}
+
+	fam, err := os.ReadFile(prefix + ".fam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(fam) != "S1\tS1\t0\t0\t0\t-9\nS2\tS2\t0\t0\t0\t-9\nS3\tS3\t0\t0\t0\t-9\n" {
+		t.Errorf("NOT OK: Unexpected .fam %q", string(fam))
+	}
+
+	report, err := os.ReadFile(rejectsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rejected := strings.Split(strings.TrimSpace(string(report)), "\n")[1:]
+	sort.Strings(rejected)
+
+	expectedRejected := []string{"5\t600\tA\tT\t0\t8\tploidyError", "5\t700\tC\tG\t0\t9\tploidyError",
+		"5\t700\tC\tT\t1\t9\tploidyError"}
+	if !reflect.DeepEqual(rejected, expectedRejected) {
+		t.Errorf("NOT OK: Expected rejects %q, got %q", expectedRejected, rejected)
+	}
+}
+
+// test that we can write a BGEN file, keeping phase
+func TestBgenOutput(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "test.bgen")
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3"}, "\t")
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T", ".", "PASS", "DP=100", "GT", "1|1", "0|1", "0|0"}, "\t")
+	row2 := strings.Join([]string{"2", "200", "rs2", "C", "G", ".", "PASS", "DP=100", "GT", "0|1", "0/0", "1|1"}, "\t")
+	// A deletion is written with the VCF's POS, REF and ALT, and a missing unphased genotype doesn't unphase it
+	row3 := strings.Join([]string{"3", "300", "rs3", "AG", "A", ".", "PASS", "DP=100", "GT", "0|1", "./.", "1|1"}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + row1 + "\n" + row2 + "\n" + row3 + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters,
+		BgenOutPath: filePath, BgenCompression: "none", NoOut: true}
+
+	if err := ReadVcf(context.Background(), &config, reader, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data[16:20]) != "bgen" {
+		t.Fatal("NOT OK: Expected bgen magic number")
+	}
+
+	if numVariants := binary.LittleEndian.Uint32(data[8:12]); numVariants != 3 {
+		t.Errorf("NOT OK: Expected 3 variants, got %d", numVariants)
+	}
+
+	// Each uncompressed probability block ends with: phased flag, bits per probability (8), 6 probabilities
+	expectedTails := []struct {
+		locus string
+		rsid  string
+		chrom string
+		pos   uint32
+		ref   string
+		alt   string
+		tail  []byte
+	}{
+		// phased, P(ref) for each haplotype
+		{"chr1:1000:A:T", "rs1", "chr1", 1000, "A", "T", []byte{1, 8, 0, 0, 255, 0, 255, 255}},
+		// unphased, P(homref), P(het) for each sample
+		{"chr2:200:C:G", "rs2", "chr2", 200, "C", "G", []byte{0, 8, 0, 255, 255, 0, 0, 0}},
+		// phased, with the missing sample's probabilities set to 0
+		{"chr3:300:AG:A", "rs3", "chr3", 300, "AG", "A", []byte{1, 8, 255, 0, 0, 0, 0, 0}},
+	}
+
+	for _, expected := range expectedTails {
+		idx := bytes.Index(data, []byte(expected.locus))
+		if idx == -1 {
+			t.Fatalf("NOT OK: Expected to find variant %s", expected.locus)
+		}
+
+		// id, rsid, chrom, then pos, K, ref, alt
+		start := idx + len(expected.locus) + 2 + len(expected.rsid) + 2 + len(expected.chrom)
+		if pos := binary.LittleEndian.Uint32(data[start : start+4]); pos != expected.pos {
+			t.Errorf("NOT OK: Expected %s at %d, got %d", expected.locus, expected.pos, pos)
+		}
+
+		alleles := string(data[start+4+2+4:start+4+2+4+len(expected.ref)]) +
+			string(data[start+4+2+4+len(expected.ref)+4:start+4+2+4+len(expected.ref)+4+len(expected.alt)])
+		if alleles != expected.ref+expected.alt {
+			t.Errorf("NOT OK: Expected %s alleles %s, %s, got %s", expected.locus, expected.ref, expected.alt, alleles)
+		}
+
+		// C, then 4 + 2 + 2 + 3 bytes before the phased flag
+		start += 4 + 2 + 4 + len(expected.ref) + 4 + len(expected.alt) + 4 + 11
+		if !bytes.Equal(data[start:start+len(expected.tail)], expected.tail) {
+			t.Errorf("NOT OK: Expected %s probabilities %v, got %v", expected.locus, expected.tail,
+				data[start:start+len(expected.tail)])
+		}
+	}
+
+	if _, err := os.Stat(filePath + ".idx"); err != nil {
+		t.Error("NOT OK: Expected BGEN offset index", err)
+	}
+}
+
+// test that we can write a phased haplotype matrix
+func TestHaplotypeMatrix(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "./test_haplotype_matrix.feather")
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3"}, "\t")
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T", ".", "PASS", "DP=100", "GT", "1|0", "0|1", "0|0"}, "\t")
+	row2 := strings.Join([]string{"2", "200", "rs2", "C", "G", ".", "PASS", "DP=100", "GT", "1", "./1", "1|."}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + row1 + "\n" + row2 + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters,
+		HaplotypeOutPath: filePath, NoOut: true}
+
+	if err := ReadVcf(context.Background(), &config, reader, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	arrowReader, err := ipc.NewFileReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer arrowReader.Close()
+
+	expectedNames := []string{"locus", "S1_hap0", "S1_hap1", "S2_hap0", "S2_hap1", "S3_hap0", "S3_hap1"}
+	for i, field := range arrowReader.Schema().Fields() {
+		if field.Name != expectedNames[i] {
+			t.Errorf("NOT OK: Expected field %s, got %s", expectedNames[i], field.Name)
+		}
+	}
+
+	expected := map[string][]any{
+		"chr1:1000:A:T": {int8(1), int8(0), int8(0), int8(1), int8(0), int8(0)},
+		// haploid S1 has no 2nd haplotype, missing alleles are null
+		"chr2:200:C:G": {int8(1), nil, nil, int8(1), int8(1), nil},
+	}
+
+	numRows := 0
+	for i := 0; i < arrowReader.NumRecords(); i++ {
+		record, err := arrowReader.Record(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for rowIdx := 0; rowIdx < int(record.NumRows()); rowIdx++ {
+			numRows++
+
+			locus := record.Column(0).(*array.String).Value(rowIdx)
+			expectedRow, ok := expected[locus]
+			if !ok {
+				t.Fatal("Unknown row", locus)
+			}
+
+			for col := 1; col < int(record.NumCols()); col++ {
+				var val any
+				if !record.Column(col).IsNull(rowIdx) {
+					val = record.Column(col).(*array.Int8).Value(rowIdx)
+				}
+
+				if val != expectedRow[col-1] {
+					t.Errorf("NOT OK: %s %s expected %v, got %v", locus, expectedNames[col], expectedRow[col-1], val)
+				}
+			}
+		}
+	}
+
+	if numRows != 2 {
+		t.Errorf("NOT OK: Expected 2 rows, got %d", numRows)
+	}
+}
+
+// test that we can write a sparse dosage matrix, which reconstructs the dense one
+func TestSparseDosageMatrix(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "test_sparse")
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3"}, "\t")
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T", ".", "PASS", "DP=100", "GT", "1|1", "0|1", "0|0"}, "\t")
+	row2 := strings.Join([]string{"2", "200", "rs2", "C", "G", ".", "PASS", "DP=100", "GT", "0|0", "0|0", "1|1"}, "\t")
+	row3 := strings.Join([]string{"22", "300", "rs2", "G", "T", ".", "PASS", "DP=100", "GT", "0|.", "0|0", "0|1"}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + row1 + "\n" + row2 + "\n" + row3 + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters,
+		SparseDosagePrefix: prefix, NoOut: true}
+
+	if err := ReadVcf(context.Background(), &config, reader, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	readRecords := func(path string, fn func(record arrow.Record, rowIdx int)) {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		arrowReader, err := ipc.NewFileReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer arrowReader.Close()
+
+		for i := 0; i < arrowReader.NumRecords(); i++ {
+			record, err := arrowReader.Record(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for rowIdx := 0; rowIdx < int(record.NumRows()); rowIdx++ {
+				fn(record, rowIdx)
+			}
+		}
+	}
+
+	var samples []string
+	readRecords(prefix+".samples.feather", func(record arrow.Record, rowIdx int) {
+		if record.Column(0).(*array.Uint32).Value(rowIdx) != uint32(len(samples)) {
+			t.Error("NOT OK: Expected samples in sample index order")
+		}
+
+		samples = append(samples, record.Column(1).(*array.String).Value(rowIdx))
+	})
+
+	if !reflect.DeepEqual(samples, []string{"S1", "S2", "S3"}) {
+		t.Error("NOT OK: Unexpected samples", samples)
+	}
+
+	loci := make(map[uint32]string)
+	readRecords(prefix+".variants.feather", func(record arrow.Record, rowIdx int) {
+		loci[record.Column(0).(*array.Uint32).Value(rowIdx)] = record.Column(1).(*array.String).Value(rowIdx)
+	})
+
+	dense := make(map[string][]int8)
+	for _, locus := range loci {
+		dense[locus] = make([]int8, len(samples))
+	}
+
+	numTriples := 0
+	readRecords(prefix+".dosages.feather", func(record arrow.Record, rowIdx int) {
+		numTriples++
+
+		locus := loci[record.Column(0).(*array.Uint32).Value(rowIdx)]
+		sampleIdx := record.Column(1).(*array.Uint32).Value(rowIdx)
+		dense[locus][sampleIdx] = record.Column(2).(*array.Int8).Value(rowIdx)
+	})
+
+	expected := map[string][]int8{
+		"chr1:1000:A:T": {2, 1, 0},
+		"chr2:200:C:G":  {0, 0, 2},
+		"chr22:300:G:T": {-1, 0, 1},
+	}
+
+	if !reflect.DeepEqual(dense, expected) {
+		t.Error("NOT OK: Expected", expected, "got", dense)
+	}
+
+	// Only non-zero dosages are stored
+	if numTriples != 5 {
+		t.Errorf("NOT OK: Expected 5 non-zero dosages, got %d", numTriples)
+	}
+}
+
+// test that we can write a sample-major dosage matrix, transposing in several batches
+func TestSampleMajorDosageMatrix(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "test_sample_major")
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3"}, "\t")
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T", ".", "PASS", "DP=100", "GT", "1|1", "0|1", "0|0"}, "\t")
+	row2 := strings.Join([]string{"2", "200", "rs2", "C", "G", ".", "PASS", "DP=100", "GT", "0|1", "0|0", "1|1"}, "\t")
+	row3 := strings.Join([]string{"22", "300", "rs2", "G", "T", ".", "PASS", "DP=100", "GT", "0|.", "0|.", "1|1"}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + row1 + "\n" + row2 + "\n" + row3 + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters,
+		SampleMajorPrefix: prefix, NoOut: true}
+
+	// 2 samples per transposition batch, and tiles of 2 variants
+	defaultBufferSize := transposeBufferSize
+	defaultTileSize := tileBufferSize
+	transposeBufferSize = 6
+	tileBufferSize = 6
+	defer func() {
+		transposeBufferSize = defaultBufferSize
+		tileBufferSize = defaultTileSize
+	}()
+
+	if err := ReadVcf(context.Background(), &config, reader, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	lociFile, err := os.Open(prefix + ".loci.feather")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lociFile.Close()
+
+	lociReader, err := ipc.NewFileReader(lociFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lociReader.Close()
+
+	loci := make(map[uint32]string)
+	for i := 0; i < lociReader.NumRecords(); i++ {
+		record, err := lociReader.Record(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for rowIdx := 0; rowIdx < int(record.NumRows()); rowIdx++ {
+			loci[record.Column(0).(*array.Uint32).Value(rowIdx)] = record.Column(1).(*array.String).Value(rowIdx)
+		}
+	}
+
+	if len(loci) != 3 {
+		t.Fatalf("NOT OK: Expected 3 loci, got %d", len(loci))
+	}
+
+	samplesFile, err := os.Open(prefix + ".samples.feather")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer samplesFile.Close()
+
+	samplesReader, err := ipc.NewFileReader(samplesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer samplesReader.Close()
+
+	if samplesReader.NumRecords() != 2 {
+		t.Errorf("NOT OK: Expected 2 batches of samples, got %d", samplesReader.NumRecords())
+	}
+
+	expected := map[string]map[string]int8{
+		"S1": {"chr1:1000:A:T": 2, "chr2:200:C:G": 1, "chr22:300:G:T": -1},
+		"S2": {"chr1:1000:A:T": 1, "chr2:200:C:G": 0, "chr22:300:G:T": -1},
+		"S3": {"chr1:1000:A:T": 0, "chr2:200:C:G": 2, "chr22:300:G:T": 2},
+	}
+
+	var samples []string
+	for i := 0; i < samplesReader.NumRecords(); i++ {
+		record, err := samplesReader.Record(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lists := record.Column(1).(*array.List)
+		values := lists.ListValues().(*array.Int8)
+
+		for rowIdx := 0; rowIdx < int(record.NumRows()); rowIdx++ {
+			sample := record.Column(0).(*array.String).Value(rowIdx)
+			samples = append(samples, sample)
+
+			start, end := lists.ValueOffsets(rowIdx)
+			if end-start != 3 {
+				t.Fatalf("NOT OK: Expected 3 dosages for %s, got %d", sample, end-start)
+			}
+
+			for variantIdx := start; variantIdx < end; variantIdx++ {
+				locus := loci[uint32(variantIdx-start)]
+
+				if values.Value(int(variantIdx)) != expected[sample][locus] {
+					t.Errorf("NOT OK: %s %s expected %d, got %d", sample, locus, expected[sample][locus], values.Value(int(variantIdx)))
+				}
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(samples, []string{"S1", "S2", "S3"}) {
+		t.Error("NOT OK: Expected samples in header order, got", samples)
+	}
+
+	// The spill file should be removed
+	matches, err := filepath.Glob(prefix + ".*.spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) != 0 {
+		t.Error("NOT OK: Expected spill file to be removed", matches)
+	}
+}
+
+func TestGenotypeAlleleCounts(t *testing.T) {
+	// Diploid, 3 alleles: 0/0, 0/1, 1/1, 0/2, 1/2, 2/2
+	if counts := genotypeAlleleCounts(3, 2, 1); !reflect.DeepEqual(counts, []int{0, 1, 2, 0, 1, 0}) {
+		t.Error("NOT OK: Expected diploid counts of allele 1 [0 1 2 0 1 0], got", counts)
+	}
+
+	if counts := genotypeAlleleCounts(3, 2, 2); !reflect.DeepEqual(counts, []int{0, 0, 0, 1, 1, 2}) {
+		t.Error("NOT OK: Expected diploid counts of allele 2 [0 0 0 1 1 2], got", counts)
+	}
+
+	// Haploid: 0, 1, 2
+	if counts := genotypeAlleleCounts(3, 1, 2); !reflect.DeepEqual(counts, []int{0, 0, 1}) {
+		t.Error("NOT OK: Expected haploid counts of allele 2 [0 0 1], got", counts)
+	}
+
+	// Triploid, 2 alleles: 0/0/0, 0/0/1, 0/1/1, 1/1/1
+	if counts := genotypeAlleleCounts(2, 3, 1); !reflect.DeepEqual(counts, []int{0, 1, 2, 3}) {
+		t.Error("NOT OK: Expected triploid counts of allele 1 [0 1 2 3], got", counts)
+	}
+
+	if inferPloidy(3, 2) != 2 || inferPloidy(6, 3) != 2 || inferPloidy(3, 3) != 1 || inferPloidy(5, 2) != 4 || inferPloidy(5, 3) != 0 {
+		t.Error("NOT OK: Couldn't infer ploidy from the number of genotypes")
+	}
+}
+
+func TestExpectedDosage(t *testing.T) {
+	tests := []struct {
+		value      string
+		source     string
+		alleleNum  int
+		numAlleles int
+		expected   float32
+	}{
+		{"1.25", dosageSourceDS, 1, 2, 1.25},
+		{"0.5,1.5", dosageSourceDS, 2, 3, 1.5},
+		{"0.25,0.5,0.25", dosageSourceGP, 1, 2, 1},
+		{"0,0.2,0.8", dosageSourceGP, 1, 2, 1.8},
+		// 0/0, 0/1, 1/1, 0/2, 1/2, 2/2: allele 2 is in 0/2 (1 copy), 1/2 (1 copy) and 2/2 (2 copies)
+		{"0.1,0.1,0.1,0.2,0.3,0.2", dosageSourceGP, 2, 3, 0.9},
+		{"0.1,0.1,0.1,0.2,0.3,0.2", dosageSourceGP, 1, 3, 0.6},
+		// haploid
+		{"0.4,0.6", dosageSourceGP, 1, 2, 0.6},
+		// unnormalized likelihoods
+		{"0,-1,-1", dosageSourceGL, 1, 2, float32(3.0 / 12.0)},
+		{"0,10,10", dosageSourcePL, 1, 2, float32(3.0 / 12.0)},
+		{"10,0,10", dosageSourcePL, 1, 2, 1},
+	}
+
+	expectedDosageOf := func(value string, source string, alleleNum int, numAlleles int) (float32, error) {
+		values, err := parseDosageValues(value, source, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		return expectedDosage(values, source, newGenotypeCounts(alleleNum, numAlleles))
+	}
+
+	for _, test := range tests {
+		dosage, err := expectedDosageOf(test.value, test.source, test.alleleNum, test.numAlleles)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if math.Abs(float64(dosage-test.expected)) > 1e-6 {
+			t.Errorf("NOT OK: %s %s allele %d: expected %f, got %f", test.source, test.value, test.alleleNum, test.expected, dosage)
+		}
+	}
+
+	if _, err := expectedDosageOf("0.1,0.9", dosageSourceDS, 3, 3); err == nil {
+		t.Error("NOT OK: Expected error when DS has too few values")
+	}
+
+	if _, err := expectedDosageOf("0.1,0.2,0.3,0.4,0.5", dosageSourceGP, 1, 3); err == nil {
+		t.Error("NOT OK: Expected error when GP values don't match any ploidy")
+	}
+
+	if _, err := expectedDosageOf("0.1,a,0.3", dosageSourceGP, 1, 2); err == nil {
+		t.Error("NOT OK: Expected error when GP values aren't numbers")
+	}
+
+	// Only the allele whose DS value isn't a number is missing
+	if _, err := expectedDosageOf("0.1,.", dosageSourceDS, 2, 3); err == nil {
+		t.Error("NOT OK: Expected error when the allele's DS value isn't a number")
+	}
+
+	if dosage, err := expectedDosageOf("0.1,.", dosageSourceDS, 1, 3); err != nil || dosage != float32(0.1) {
+		t.Errorf("NOT OK: Expected 0.1 for the allele whose DS value is a number, got %f, %v", dosage, err)
+	}
+}
+
+func TestMakeExpectedDosages(t *testing.T) {
+	header := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3", "S4"}
+	fields := []string{"10", "1000", "rs#", "C", "T,G", "100", "PASS", "AC=1", "GT:DS:GP", "0|1:0.9,0.1:0.05,0.9,0.05,0,0,0", ".|.:.:.", "1|1", "0|2:0,1.1:0,0,0,1,0,0"}
+
+	keyIdx := formatKeyIndex(fields[formatIdx], dosageSourceDS)
+	if keyIdx != 1 {
+		t.Fatalf("NOT OK: Expected DS at FORMAT index 1, got %d", keyIdx)
+	}
+
+	dosages := makeExpectedDosages(fields, header, dosageSourceDS, keyIdx, 3)
+	expected := [][]any{
+		{float32(0.9), float32(-1), float32(-1), float32(0)},
+		{float32(0.1), float32(-1), float32(-1), float32(1.1)},
+	}
+	if !reflect.DeepEqual(dosages, expected) {
+		t.Error("NOT OK: Expected DS dosages", expected, "got", dosages)
+	}
+
+	// 0/0, 0/1, 1/1, 0/2, 1/2, 2/2, marginalized for each alt allele
+	dosages = makeExpectedDosages(fields, header, dosageSourceGP, formatKeyIndex(fields[formatIdx], dosageSourceGP), 3)
+	expected = [][]any{
+		{float32(1), float32(-1), float32(-1), float32(0)},
+		{float32(0), float32(-1), float32(-1), float32(1)},
+	}
+	if !reflect.DeepEqual(dosages, expected) {
+		t.Error("NOT OK: Expected GP dosages", expected, "got", dosages)
+	}
+
+	dosages = makeExpectedDosages(fields, header, dosageSourcePL, formatKeyIndex(fields[formatIdx], dosageSourcePL), 3)
+	missing := []any{float32(-1), float32(-1), float32(-1), float32(-1)}
+	if !reflect.DeepEqual(dosages, [][]any{missing, missing}) {
+		t.Error("NOT OK: Expected missing dosages when PL absent", missing, "got", dosages)
+	}
+}
+
+// test that we can write a float32 dosage matrix from DS
+func TestExpectedDosageMatrix(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "./test_expected_dosage_matrix.feather")
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2"}, "\t")
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T,C", ".", "PASS", "DP=100", "GT:DS", "0|1:0.9,0.2", "2|2:0.1,1.75"}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + header + "\n" + row1 + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters,
+		DosageMatrixOutPath: filePath, DosageSource: dosageSourceDS, NoOut: true}
+
+	if err := ReadVcf(context.Background(), &config, reader, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	arrowReader, err := ipc.NewFileReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer arrowReader.Close()
+
+	expected := map[string][]float32{
+		"chr1:1000:A:T": {0.9, 0.1},
+		"chr1:1000:A:C": {0.2, 1.75},
+	}
+
+	numRows := 0
+	for i := 0; i < arrowReader.NumRecords(); i++ {
+		record, err := arrowReader.Record(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for rowIdx := 0; rowIdx < int(record.NumRows()); rowIdx++ {
+			numRows++
+
+			locus := record.Column(0).(*array.String).Value(rowIdx)
+			s1 := record.Column(1).(*array.Float32).Value(rowIdx)
+			s2 := record.Column(2).(*array.Float32).Value(rowIdx)
+
+			if s1 != expected[locus][0] || s2 != expected[locus][1] {
+				t.Errorf("NOT OK: %s expected %v, got %f %f", locus, expected[locus], s1, s2)
+			}
+		}
+	}
+
+	if numRows != 2 {
+		t.Errorf("NOT OK: Expected 2 rows, got %d", numRows)
+	}
+}
+
+// test that imputed alleles are kept without a GT carrier, and that records without GT are read
+func TestExpectedDosageMatrixWithoutCarriers(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "./test_expected_dosage_matrix.feather")
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2"}, "\t")
+	// Nobody's GT carries C, and the second record has no GT at all
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T,C", ".", "PASS", ".", "GT:DS", "0|1:0.9,0.2", "0|0:0.1,0.4"}, "\t")
+	row2 := strings.Join([]string{"1", "2000", "rs2", "G", "A", ".", "PASS", ".", "DS:GP", "0.3:0.7,0.3,0", ".:."}, "\t")
+
+	lines := versionLine + "\n" + header + "\n" + row1 + "\n" + row2 + "\n"
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: map[string]bool{"PASS": true, ".": true},
+		DosageMatrixOutPath: filePath, DosageSource: dosageSourceDS, NoOut: true}
+
+	if err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(lines)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	arrowReader, err := ipc.NewFileReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer arrowReader.Close()
+
+	expected := map[string][]float32{
+		"chr1:1000:A:T": {0.9, 0.1},
+		"chr1:1000:A:C": {0.2, 0.4},
+		"chr1:2000:G:A": {0.3, -1},
+	}
+
+	found := make(map[string]bool)
+	for i := 0; i < arrowReader.NumRecords(); i++ {
+		record, err := arrowReader.Record(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for rowIdx := 0; rowIdx < int(record.NumRows()); rowIdx++ {
+			locus := record.Column(0).(*array.String).Value(rowIdx)
+			s1 := record.Column(1).(*array.Float32).Value(rowIdx)
+			s2 := record.Column(2).(*array.Float32).Value(rowIdx)
+
+			if _, ok := expected[locus]; !ok || s1 != expected[locus][0] || s2 != expected[locus][1] {
+				t.Errorf("NOT OK: %s expected %v, got %f %f", locus, expected[locus], s1, s2)
+			}
+
+			found[locus] = true
+		}
+	}
+
+	if len(found) != len(expected) {
+		t.Errorf("NOT OK: Expected loci %v, got %v", expected, found)
+	}
+}
+
+// test that alleles kept for their imputed dosages are left out of the TSV output, the rejects and the stats
+func TestExpectedDosageMatrixKeepsOutputs(t *testing.T) {
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2"}, "\t")
+	// Nobody's GT carries C, nor rs2's A
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T,C", ".", "PASS", ".", "GT:DS", "0|1:0.9,0.2", "0|0:0.1,0.4"}, "\t")
+	row2 := strings.Join([]string{"1", "2000", "rs2", "G", "A", ".", "PASS", ".", "GT:DS", "0|0:0.3", "0|0:0"}, "\t")
+
+	lines := versionLine + "\n" + header + "\n" + row1 + "\n" + row2 + "\n"
+
+	var outputs []string
+	var stats []*runStats
+	var rejects []string
+	for _, dosageSource := range []string{dosageSourceGT, dosageSourceDS} {
+		dir := t.TempDir()
+
+		config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: map[string]bool{"PASS": true, ".": true},
+			DosageMatrixOutPath: filepath.Join(dir, "dosages.feather"), DosageSource: dosageSource,
+			StatsPath: filepath.Join(dir, "stats.json"), RejectsPath: filepath.Join(dir, "rejects.tsv")}
+
+		var out bytes.Buffer
+		w := bufio.NewWriter(&out)
+
+		if err := ReadVcf(context.Background(), &config, bufio.NewReader(strings.NewReader(lines)), w); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+
+		outputs = append(outputs, out.String())
+
+		data, err := os.ReadFile(config.StatsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		summary := &runStats{}
+		if err := json.Unmarshal(data, summary); err != nil {
+			t.Fatal(err)
+		}
+
+		stats = append(stats, summary)
+
+		report, err := os.ReadFile(config.RejectsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rejects = append(rejects, string(report))
+
+		if dosageSource == dosageSourceDS {
+			if loci := readSplitLoci(t, config.DosageMatrixOutPath); len(loci) != 3 {
+				t.Errorf("NOT OK: Expected the DS matrix to keep the alleles nobody carries, got %v", loci)
+			}
+		}
+	}
+
+	if outputs[0] != outputs[1] || strings.Count(outputs[0], "\n") != 1 {
+		t.Errorf("NOT OK: Expected the same TSV output with and without DS, got %q and %q", outputs[0], outputs[1])
+	}
+
+	if rejects[0] != rejects[1] {
+		t.Errorf("NOT OK: Expected the same rejects with and without DS, got %q and %q", rejects[0], rejects[1])
+	}
+
+	for _, summary := range stats {
+		if summary.Sites != 1 || summary.Alleles != 1 || summary.ACZero != 2 {
+			t.Errorf("NOT OK: Expected 1 site, 1 allele and 2 alleles nobody carries, got %d, %d and %d", summary.Sites,
+				summary.Alleles, summary.ACZero)
+		}
+	}
+}
+
+// test that partial samples are written, and the dosage matrix keeps polyploid allele counts
+func TestOutputsPartial(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "./test_polyploid_matrix.feather")
+
+	versionLine := "##fileformat=VCFv4.x"
+	vcfHeader := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3", "S4", "S5"}, "\t")
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T", ".", "PASS", "DP=100", "GT", "0/1/1/1", "1/1/1/1", "0/1", "0/0/0/0", "0/0/0/1"}, "\t")
+
+	allowedFilters := map[string]bool{"PASS": true, ".": true}
+
+	lines := versionLine + "\n" + vcfHeader + "\n" + row1 + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: allowedFilters,
+		LabelPartials: true, DosageMatrixOutPath: filePath}
+
+	byteBuf := new(bytes.Buffer)
+	w := bufio.NewWriter(byteBuf)
+
+	if err := ReadVcf(context.Background(), &config, reader, w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	outputHeader := Header(&config)
+	if outputHeader[len(outputHeader)-2] != "partial" || outputHeader[len(outputHeader)-1] != "partiality" {
+		t.Error("NOT OK: Expected partial and partiality header fields", outputHeader)
+	}
+
+	fields := strings.Split(strings.TrimSpace(byteBuf.String()), "\t")
+
+	if len(fields) != len(outputHeader) {
+		t.Fatalf("NOT OK: Expected %d fields, got %d", len(outputHeader), len(fields))
+	}
+
+	if fields[6] != "S1;S3" || fields[8] != "S2" {
+		t.Error("NOT OK: Expected S1 and S3 heterozygous and S2 homozygous", fields)
+	}
+
+	if fields[len(fields)-2] != "S5" || fields[len(fields)-1] != "0.2" {
+		t.Error("NOT OK: Expected S5 partial, with partiality 0.2", fields)
+	}
+
+	// 3 + 4 + 1 + 1, over 4 + 4 + 2 + 4 + 4
+	if fields[12] != "9" || fields[13] != "18" {
+		t.Error("NOT OK: Expected ac == 9 and an == 18", fields[12], fields[13])
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	arrowReader, err := ipc.NewFileReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer arrowReader.Close()
+
+	record, err := arrowReader.Record(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []int8{3, 4, 1, 0, 1} {
+		if dosage := record.Column(i + 1).(*array.Int8).Value(0); dosage != expected {
+			t.Errorf("NOT OK: Expected S%d dosage %d, got %d", i+1, expected, dosage)
+		}
+	}
+}
+
+// test that the dosage matrix can be streamed to stdout
+func TestDosageMatrixStream(t *testing.T) {
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+
+	realStdout := os.Stdout
+	os.Stdout = stdout
+	defer func() { os.Stdout = realStdout }()
+
+	versionLine := "##fileformat=VCFv4.x"
+	header := strings.Join([]string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT", "S1", "S2", "S3"}, "\t")
+	row1 := strings.Join([]string{"1", "1000", "rs1", "A", "T", ".", "PASS", "DP=100", "GT", "1|1", "0|1", "0|0"}, "\t")
+	row2 := strings.Join([]string{"1", "1001", "rs2", "G", "C", ".", "PASS", "DP=100", "GT", "0|1", ".|.", "0|0"}, "\t")
+
+	lines := versionLine + "\n" + header + "\n" + row1 + "\n" + row2 + "\n"
+	reader := bufio.NewReader(strings.NewReader(lines))
+
+	config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: map[string]bool{"PASS": true, ".": true},
+		DosageMatrixOutPath: "-", NoOut: true}
+
+	if err := ReadVcf(context.Background(), &config, reader, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := stdout.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	matrixReader, err := bystroArrow.NewArrowIPCStreamReader(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer matrixReader.Close()
+
+	matrix, err := bystroArrow.ReadDosageMatrix(matrixReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dosages := make(map[string][]int8)
+	for _, locus := range matrix.Loci {
+		for sampleIdx := range matrix.Samples {
+			dosage, _ := matrix.Dosage(sampleIdx, locus)
+			dosages[locus] = append(dosages[locus], dosage)
+		}
+	}
+
+	if fmt.Sprint(dosages["chr1:1000:A:T"]) != "[2 1 0]" || fmt.Sprint(dosages["chr1:1001:G:C"]) != "[1 -1 0]" {
+		t.Errorf("NOT OK: Unexpected streamed dosages %v", dosages)
+	}
+}
+
+func TestFillWorkQueue(t *testing.T) {
+	var lines []string
+	for i := 0; i < 5000; i++ {
+		lines = append(lines, fmt.Sprintf("chr1\t%d\t.\tA\tT\r\n", i))
+	}
+
+	// Longer than a block, and at a block's end
+	lines[10] = "chr1\t10\t.\tA\t" + strings.Repeat("T", 3*blockSize) + "\r\n"
+	lines[4000] = "chr1\t4000\t.\tA\t" + strings.Repeat("T", blockSize-200) + "\r\n"
+
+	// The incomplete last line is skipped
+	input := strings.Join(lines, "") + "chr2\t1\t.\tA"
+
+	queue := make(chan batch, 10000)
+	if err := fillWorkQueue(context.Background(), bufio.NewReader(strings.NewReader(input)), '\n', 3, nil, queue); err != nil {
+		t.Fatal(err)
+	}
+	close(queue)
+
+	var read []string
+	var rows [][]byte
+	var numBytes int64
+	seq := 0
+
+	for b := range queue {
+		if b.seq != seq || b.firstLine != 3+len(read) || b.numRows > batchRows {
+			t.Errorf("NOT OK: Unexpected batch %d of %d rows, from line %d", b.seq, b.numRows, b.firstLine)
+		}
+
+		rows = b.splitRows(rows)
+		if len(rows) != b.numRows {
+			t.Errorf("NOT OK: Expected %d rows in batch %d, got %d", b.numRows, b.seq, len(rows))
+		}
+
+		for _, row := range rows {
+			read = append(read, string(row))
+		}
+
+		numBytes += b.numBytes
+		seq++
+
+		b.release()
+	}
+
+	if !reflect.DeepEqual(read, lines) {
+		t.Errorf("NOT OK: Expected the %d complete lines to be read, got %d", len(lines), len(read))
+	}
+
+	if numBytes != int64(len(input)-len("chr2\t1\t.\tA")) {
+		t.Errorf("NOT OK: Expected the batches to hold every complete line, got %d bytes", numBytes)
+	}
+}
+
+// test that the output doesn't depend on the number of threads, other than in its order
+func TestReadVcfConcurrency(t *testing.T) {
+	var outputs []string
+
+	for _, concurrency := range []int{1, 4} {
+		inFh, err := os.Open("../examples/test.query.vcf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer inFh.Close()
+
+		config := Options{EmptyField: "!", FieldDelimiter: ";", AllowedFilters: map[string]bool{"PASS": true, ".": true},
+			Concurrency: concurrency}
+
+		var out bytes.Buffer
+		w := bufio.NewWriter(&out)
+
+		if err := ReadVcf(context.Background(), &config, bufio.NewReader(inFh), w); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		sort.Strings(lines)
+
+		outputs = append(outputs, strings.Join(lines, "\n"))
+	}
+
+	if outputs[0] != outputs[1] || outputs[0] == "" {
+		t.Error("NOT OK: Expected the same output with 1 and 4 threads")
+	}
+}